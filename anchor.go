@@ -1,48 +1,210 @@
 package junkboy
 
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAnchorNotFound is returned by every anchorRepository when no anchor
+// has the requested ID.
+var ErrAnchorNotFound = errors.New("anchor not found")
+
+// ErrAnchorVersionMismatch is returned when an anchor is updated or
+// deleted at a version other than its current one.
+var ErrAnchorVersionMismatch = errors.New("anchor has been modified")
+
 type Anchor struct {
 	ID  int    `json:"id"`
 	URL string `json:"url"`
+	// Version starts at 1 and goes up by one with every update.
+	Version int `json:"version,omitempty"`
 }
 
 type anchorRepository interface {
-	AddAnchor(a Anchor) (int, error)
-	UpdateAnchor(a Anchor) error
-	GetAnchor(id int) (Anchor, error)
-	GetAnchors() ([]Anchor, error)
-	DeleteAnchor(id int) error
+	AddAnchor(ctx context.Context, a Anchor) (int, error)
+	// UpdateAnchor stores a and returns it with its new version. Unless
+	// a.Version is 0, the update only happens if the anchor is still at
+	// that version.
+	UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error)
+	GetAnchor(ctx context.Context, id int) (Anchor, error)
+	GetAnchors(ctx context.Context) ([]Anchor, error)
+	// ListAnchors returns up to limit anchors with an ID greater than
+	// after, in ID order. A limit of 0 or less means no limit.
+	ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error)
+	// DeleteAnchor moves the anchor to the trash, only if it is at version
+	// unless version is 0. Anchors in the trash are not found by the other
+	// methods.
+	DeleteAnchor(ctx context.Context, id, version int) error
+	// ListTrash returns the anchors in the trash, most recently deleted
+	// first.
+	ListTrash(ctx context.Context) ([]TrashedAnchor, error)
+	// RestoreAnchor takes an anchor out of the trash and returns it with
+	// its version bumped.
+	RestoreAnchor(ctx context.Context, id int) (Anchor, error)
+	// PurgeAnchor permanently deletes an anchor in the trash.
+	PurgeAnchor(ctx context.Context, id int) error
+	// PurgeTrash permanently deletes the anchors moved to the trash before
+	// before and returns how many there were.
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	// AddRevision stores rev as the next revision of its anchor and
+	// returns it with its number and creation time set. Purging an anchor
+	// deletes its revisions.
+	AddRevision(ctx context.Context, rev Revision) (Revision, error)
+	// ListRevisions returns the revisions of an anchor, oldest first.
+	ListRevisions(ctx context.Context, anchorID int) ([]Revision, error)
+	GetRevision(ctx context.Context, anchorID, number int) (Revision, error)
+	// AddEvent appends e to the event log and returns it with its ID, one
+	// more than that of the last event. It is called in the transaction of
+	// the change e records, so the log holds every change that commits,
+	// in the order they commit, and no other.
+	AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error)
+	// ListEvents returns up to limit events with an ID greater than after,
+	// oldest first. A limit of 0 or less means no limit.
+	ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error)
+	// LastEventID returns the ID of the latest event, or 0 if there are
+	// none.
+	LastEventID(ctx context.Context) (int, error)
+	// PruneEvents deletes the events with an ID of at most upTo, which is
+	// always below the latest ID.
+	PruneEvents(ctx context.Context, upTo int) error
+}
+
+// TrashedAnchor is an anchor in the trash.
+type TrashedAnchor struct {
+	Anchor
+	DeletedAt time.Time `json:"deleted_at"`
 }
 
 type AnchorService struct {
-	Repository anchorRepository
+	// repos holds the anchors, and runs changes that must happen together
+	// in one transaction. It is unexported so that every write goes
+	// through the service and gets its revision.
+	repos Repositories
+
+	// timeout is the deadline for each repository call, as nanoseconds so
+	// it can be changed while requests are being served.
+	timeout int64
+
+	// maxEvents is how many events the event log keeps.
+	maxEvents int64
+
+	listeners []AnchorListener
 }
 
 func NewAnchorService(r anchorRepository) *AnchorService {
-	return &AnchorService{
-		Repository: r,
+	return NewAnchorServiceWithRepositories(Repositories{Anchors: r})
+}
+
+// NewAnchorServiceWithRepositories returns a service that can also make
+// several changes in one transaction, if repos support them.
+func NewAnchorServiceWithRepositories(repos Repositories) *AnchorService {
+	s := &AnchorService{
+		repos:     repos,
+		maxEvents: DefaultMaxEvents,
 	}
+
+	if r, ok := repos.Anchors.(reloadingRepository); ok {
+		r.SetReloadFunc(s.reloaded)
+	}
+
+	return s
+}
+
+// reloadingRepository is a repository that other programs can change
+// behind the service's back, and that reports those changes so that they
+// get a revision and an event too. It reports to the last service created
+// over it.
+type reloadingRepository interface {
+	SetReloadFunc(fn func(AnchorFileChange))
 }
 
-func (s *AnchorService) AddAnchor(a Anchor) (int, error) {
-	id, err := s.Repository.AddAnchor(a)
+// reloaded records a change made by another program, which the repository
+// has already stored, as made by FileActor.
+func (s *AnchorService) reloaded(c AnchorFileChange) {
+	ctx, cancel := s.withTimeout(WithActor(context.Background(), FileActor))
+	defer cancel()
+
+	_, err := s.change(ctx, c.Type, func(r anchorRepository) (Anchor, error) {
+		if c.Type == AnchorDeleted {
+			return c.Anchor, nil
+		}
+
+		var before map[string]interface{}
+		if c.Type == AnchorUpdated {
+			before = anchorFields(c.Before)
+		}
+
+		_, err := r.AddRevision(ctx, Revision{
+			AnchorID: c.Anchor.ID,
+			Actor:    FileActor,
+			Anchor:   c.Anchor,
+			Changes:  diffFields(before, anchorFields(c.Anchor)),
+		})
+
+		return c.Anchor, err
+	})
 	if err != nil {
-		return 0, err
+		log.Printf("failed to record the change to anchor %d made on disk: %v", c.Anchor.ID, err)
+	}
+}
+
+// SetTimeout sets the deadline for each repository call. Zero means no
+// deadline beyond the caller's.
+func (s *AnchorService) SetTimeout(d time.Duration) {
+	atomic.StoreInt64(&s.timeout, int64(d))
+}
+
+// SetMaxEvents sets how many of the latest events the event log keeps.
+// Older ones are dropped by the next change; less than 1 means the
+// default.
+func (s *AnchorService) SetMaxEvents(n int) {
+	if n < 1 {
+		n = DefaultMaxEvents
+	}
+
+	atomic.StoreInt64(&s.maxEvents, int64(n))
+}
+
+func (s *AnchorService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(atomic.LoadInt64(&s.timeout))
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
 
-	return id, nil
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (s *AnchorService) UpdateAnchor(a Anchor) error {
-	err := s.Repository.UpdateAnchor(a)
+func (s *AnchorService) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	added, err := s.change(ctx, AnchorCreated, func(r anchorRepository) (Anchor, error) {
+		return addAnchor(ctx, r, a)
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return added.ID, nil
 }
 
-func (s *AnchorService) GetAnchor(id int) (Anchor, error) {
-	anchor, err := s.Repository.GetAnchor(id)
+func (s *AnchorService) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.change(ctx, AnchorUpdated, func(r anchorRepository) (Anchor, error) {
+		return updateAnchor(ctx, r, a)
+	})
+}
+
+func (s *AnchorService) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	anchor, err := s.repos.Anchors.GetAnchor(ctx, id)
 	if err != nil {
 		return anchor, err
 	}
@@ -50,8 +212,46 @@ func (s *AnchorService) GetAnchor(id int) (Anchor, error) {
 	return anchor, nil
 }
 
-func (s *AnchorService) GetAnchors() ([]Anchor, error) {
-	anchors, err := s.Repository.GetAnchors()
+func (s *AnchorService) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	anchors, err := s.repos.Anchors.GetAnchors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+func (s *AnchorService) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	anchors, err := s.repos.Anchors.ListAnchors(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+func (s *AnchorService) DeleteAnchor(ctx context.Context, id, version int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.change(ctx, AnchorDeleted, func(r anchorRepository) (Anchor, error) {
+		return Anchor{ID: id}, r.DeleteAnchor(ctx, id, version)
+	})
+
+	return err
+}
+
+func (s *AnchorService) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	anchors, err := s.repos.Anchors.ListTrash(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -59,11 +259,52 @@ func (s *AnchorService) GetAnchors() ([]Anchor, error) {
 	return anchors, nil
 }
 
-func (s *AnchorService) DeleteAnchor(id int) error {
-	err := s.Repository.DeleteAnchor(id)
+func (s *AnchorService) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.change(ctx, AnchorRestored, func(r anchorRepository) (Anchor, error) {
+		return restoreAnchor(ctx, r, id)
+	})
+}
+
+func (s *AnchorService) PurgeAnchor(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.repos.Anchors.PurgeAnchor(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (s *AnchorService) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	n, err := s.repos.Anchors.PurgeTrash(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// NewTrashPurgeJob returns a job that permanently deletes anchors that
+// have been in the trash for longer than retention.
+func NewTrashPurgeJob(s *AnchorService, retention, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_trash",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			n, err := s.PurgeTrash(ctx, time.Now().Add(-retention))
+			if n > 0 {
+				log.Printf("Purged %d anchors from the trash", n)
+			}
+
+			return err
+		},
+	}
+}
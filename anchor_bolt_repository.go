@@ -0,0 +1,656 @@
+package junkboy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltAnchor is the stored form of an anchor.
+type boltAnchor struct {
+	Anchor
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// boltTrashedAnchor is the stored form of an anchor in the trash.
+type boltTrashedAnchor struct {
+	boltAnchor
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// AnchorBoltRepository stores anchors in a bbolt database, keyed by ID,
+// with indexes on URL and on last update time. IDs come from the bucket
+// sequence, so like SQLite with AUTOINCREMENT they are never reused.
+// Deleted anchors move to a trash bucket indexed by deletion time.
+// Revisions are keyed by anchor ID and revision number, and events by
+// their ID, which comes from the sequence of the events bucket.
+type AnchorBoltRepository struct {
+	db  *bolt.DB
+	tx  *bolt.Tx
+	now func() time.Time
+}
+
+func NewAnchorBoltRepository(db *bolt.DB) *AnchorBoltRepository {
+	return &AnchorBoltRepository{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// inTx returns a copy of r whose calls go through tx.
+func (r *AnchorBoltRepository) inTx(tx *bolt.Tx) *AnchorBoltRepository {
+	return &AnchorBoltRepository{
+		db:  r.db,
+		tx:  tx,
+		now: r.now,
+	}
+}
+
+func (r *AnchorBoltRepository) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	return r.db.View(fn)
+}
+
+func (r *AnchorBoltRepository) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	return r.db.Update(fn)
+}
+
+func (r *AnchorBoltRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	var id int
+
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		seq, err := tx.Bucket(boltAnchors).NextSequence()
+		if err != nil {
+			return err
+		}
+
+		id = int(seq)
+		now := r.now().UTC()
+
+		return putBoltAnchor(tx, nil, boltAnchor{
+			Anchor:    Anchor{ID: id, URL: a.URL, Version: 1},
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *AnchorBoltRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	var updated boltAnchor
+
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		old, err := getBoltAnchor(tx, a.ID)
+		if err != nil {
+			return err
+		}
+
+		if a.Version != 0 && a.Version != old.Version {
+			return ErrAnchorVersionMismatch
+		}
+
+		updated = *old
+		updated.URL = a.URL
+		updated.Version++
+		updated.UpdatedAt = r.now().UTC()
+
+		return putBoltAnchor(tx, old, updated)
+	})
+	if err != nil {
+		return a, err
+	}
+
+	return updated.Anchor, nil
+}
+
+func (r *AnchorBoltRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	var anchor Anchor
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		stored, err := getBoltAnchor(tx, id)
+		if err != nil {
+			return err
+		}
+
+		anchor = stored.Anchor
+
+		return nil
+	})
+
+	return anchor, err
+}
+
+func (r *AnchorBoltRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return r.ListAnchors(ctx, 0, 0)
+}
+
+func (r *AnchorBoltRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	anchors := []Anchor{}
+
+	if after < 0 {
+		after = 0
+	}
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltAnchors).Cursor()
+
+		for k, v := c.Seek(boltKey(after + 1)); k != nil; k, v = c.Next() {
+			if limit > 0 && len(anchors) == limit {
+				break
+			}
+
+			var stored boltAnchor
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+
+			anchors = append(anchors, stored.Anchor)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+func (r *AnchorBoltRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	return r.update(ctx, func(tx *bolt.Tx) error {
+		old, err := getBoltAnchor(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if version != 0 && version != old.Version {
+			return ErrAnchorVersionMismatch
+		}
+
+		if err := deleteBoltIndexes(tx, old); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(boltAnchors).Delete(boltKey(id)); err != nil {
+			return err
+		}
+
+		trashed := boltTrashedAnchor{boltAnchor: *old, DeletedAt: r.now().UTC()}
+
+		v, err := json.Marshal(trashed)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(boltTrash).Put(boltKey(id), v); err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltTrashByDeleted).Put(boltTrashKey(&trashed), nil)
+	})
+}
+
+func (r *AnchorBoltRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	anchors := []TrashedAnchor{}
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltTrashByDeleted).Cursor()
+
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			trashed, err := getBoltTrashedAnchor(tx, int(binary.BigEndian.Uint64(k[8:])))
+			if err != nil {
+				return err
+			}
+
+			anchors = append(anchors, TrashedAnchor{Anchor: trashed.Anchor, DeletedAt: trashed.DeletedAt})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+func (r *AnchorBoltRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	var restored boltAnchor
+
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		trashed, err := removeBoltTrashedAnchor(tx, id)
+		if err != nil {
+			return err
+		}
+
+		restored = trashed.boltAnchor
+		restored.Version++
+		restored.UpdatedAt = r.now().UTC()
+
+		return putBoltAnchor(tx, nil, restored)
+	})
+	if err != nil {
+		return Anchor{}, err
+	}
+
+	return restored.Anchor, nil
+}
+
+func (r *AnchorBoltRepository) PurgeAnchor(ctx context.Context, id int) error {
+	return r.update(ctx, func(tx *bolt.Tx) error {
+		return purgeBoltAnchor(tx, id)
+	})
+}
+
+func (r *AnchorBoltRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	var n int
+
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		n = 0
+
+		// Collect the keys first, as deleting while iterating skips keys.
+		var ids []int
+
+		end := boltTimeKey(before)
+		c := tx.Bucket(boltTrashByDeleted).Cursor()
+
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.Next() {
+			ids = append(ids, int(binary.BigEndian.Uint64(k[8:])))
+		}
+
+		for _, id := range ids {
+			if err := purgeBoltAnchor(tx, id); err != nil {
+				return err
+			}
+
+			n++
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (r *AnchorBoltRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltRevisions).Cursor()
+
+		// The last revision of the anchor is just before the first key of
+		// the next one.
+		k, _ := c.Seek(boltKey(rev.AnchorID + 1))
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+
+		rev.Number = 1
+		if k != nil && bytes.HasPrefix(k, boltKey(rev.AnchorID)) {
+			rev.Number = int(binary.BigEndian.Uint64(k[8:])) + 1
+		}
+
+		rev.CreatedAt = r.now().UTC()
+
+		v, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltRevisions).Put(boltRevisionKey(rev.AnchorID, rev.Number), v)
+	})
+
+	return rev, err
+}
+
+func (r *AnchorBoltRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	revisions := []Revision{}
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		prefix := boltKey(anchorID)
+		c := tx.Bucket(boltRevisions).Cursor()
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rev Revision
+			if err := json.Unmarshal(v, &rev); err != nil {
+				return err
+			}
+
+			revisions = append(revisions, rev)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (r *AnchorBoltRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	var rev Revision
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		if anchorID <= 0 || number <= 0 {
+			return ErrRevisionNotFound
+		}
+
+		v := tx.Bucket(boltRevisions).Get(boltRevisionKey(anchorID, number))
+		if v == nil {
+			return ErrRevisionNotFound
+		}
+
+		return json.Unmarshal(v, &rev)
+	})
+
+	return rev, err
+}
+
+func (r *AnchorBoltRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	logged := LoggedEvent{AnchorEvent: e}
+
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		seq, err := tx.Bucket(boltEvents).NextSequence()
+		if err != nil {
+			return err
+		}
+
+		logged.ID = int(seq)
+
+		v, err := json.Marshal(logged)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltEvents).Put(boltKey(logged.ID), v)
+	})
+
+	return logged, err
+}
+
+func (r *AnchorBoltRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	events := []LoggedEvent{}
+
+	if after < 0 {
+		after = 0
+	}
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltEvents).Cursor()
+
+		for k, v := c.Seek(boltKey(after + 1)); k != nil; k, v = c.Next() {
+			if limit > 0 && len(events) == limit {
+				break
+			}
+
+			var e LoggedEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			events = append(events, e)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (r *AnchorBoltRepository) LastEventID(ctx context.Context) (int, error) {
+	var id int
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		id = int(tx.Bucket(boltEvents).Sequence())
+		return nil
+	})
+
+	return id, err
+}
+
+func (r *AnchorBoltRepository) PruneEvents(ctx context.Context, upTo int) error {
+	return r.update(ctx, func(tx *bolt.Tx) error {
+		end := boltKey(upTo + 1)
+		c := tx.Bucket(boltEvents).Cursor()
+
+		// Seek again after each delete, as deleting while iterating skips
+		// keys.
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *AnchorBoltRepository) CountAnchors(ctx context.Context) (int, error) {
+	var count int
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		count = tx.Bucket(boltAnchors).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+// FindAnchorsByURL returns the anchors with exactly this URL, in ID order.
+func (r *AnchorBoltRepository) FindAnchorsByURL(ctx context.Context, url string) ([]Anchor, error) {
+	prefix := append([]byte(url), 0)
+
+	// A URL containing a zero byte could share the prefix, but its keys
+	// are longer.
+	return r.scanIndex(ctx, boltAnchorsByURL, prefix, prefix, func(k []byte) bool {
+		return len(k) == len(prefix)+8
+	})
+}
+
+// AnchorsUpdatedSince returns the anchors added or changed at or after
+// since, least recently updated first.
+func (r *AnchorBoltRepository) AnchorsUpdatedSince(ctx context.Context, since time.Time) ([]Anchor, error) {
+	return r.scanIndex(ctx, boltAnchorsByUpdated, boltTimeKey(since), nil, func(k []byte) bool {
+		return true
+	})
+}
+
+// scanIndex looks up the anchors referenced by the keys of bucket that
+// follow seek and start with prefix, skipping those valid rejects. Index
+// keys end in the anchor key.
+func (r *AnchorBoltRepository) scanIndex(ctx context.Context, bucket, seek, prefix []byte, valid func(k []byte) bool) ([]Anchor, error) {
+	anchors := []Anchor{}
+
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+
+		for k, _ := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if !valid(k) {
+				continue
+			}
+
+			stored, err := getBoltAnchor(tx, int(binary.BigEndian.Uint64(k[len(k)-8:])))
+			if err != nil {
+				return err
+			}
+
+			anchors = append(anchors, stored.Anchor)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return anchors, nil
+}
+
+func getBoltTrashedAnchor(tx *bolt.Tx, id int) (*boltTrashedAnchor, error) {
+	v := tx.Bucket(boltTrash).Get(boltKey(id))
+	if v == nil {
+		return nil, ErrAnchorNotFound
+	}
+
+	var trashed boltTrashedAnchor
+	if err := json.Unmarshal(v, &trashed); err != nil {
+		return nil, err
+	}
+
+	return &trashed, nil
+}
+
+// removeBoltTrashedAnchor deletes the anchor id from the trash and returns
+// it.
+func removeBoltTrashedAnchor(tx *bolt.Tx, id int) (*boltTrashedAnchor, error) {
+	if id <= 0 {
+		return nil, ErrAnchorNotFound
+	}
+
+	trashed, err := getBoltTrashedAnchor(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Bucket(boltTrashByDeleted).Delete(boltTrashKey(trashed)); err != nil {
+		return nil, err
+	}
+
+	return trashed, tx.Bucket(boltTrash).Delete(boltKey(id))
+}
+
+// purgeBoltAnchor permanently deletes the anchor id from the trash, along
+// with its revisions.
+func purgeBoltAnchor(tx *bolt.Tx, id int) error {
+	if _, err := removeBoltTrashedAnchor(tx, id); err != nil {
+		return err
+	}
+
+	return deleteBoltRevisions(tx, id)
+}
+
+// boltRevisionKey is the anchor key and the revision number.
+func boltRevisionKey(anchorID, number int) []byte {
+	return append(boltKey(anchorID), boltKey(number)...)
+}
+
+func deleteBoltRevisions(tx *bolt.Tx, anchorID int) error {
+	prefix := boltKey(anchorID)
+	c := tx.Bucket(boltRevisions).Cursor()
+
+	// Seek again after each delete, as deleting while iterating skips keys.
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// boltTrashKey is the deletion time and the anchor key.
+func boltTrashKey(a *boltTrashedAnchor) []byte {
+	return append(boltTimeKey(a.DeletedAt), boltKey(a.ID)...)
+}
+
+func getBoltAnchor(tx *bolt.Tx, id int) (*boltAnchor, error) {
+	if id <= 0 {
+		return nil, ErrAnchorNotFound
+	}
+
+	v := tx.Bucket(boltAnchors).Get(boltKey(id))
+	if v == nil {
+		return nil, ErrAnchorNotFound
+	}
+
+	var stored boltAnchor
+	if err := json.Unmarshal(v, &stored); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// putBoltAnchor stores a and its index entries, replacing those of old if
+// it is not nil.
+func putBoltAnchor(tx *bolt.Tx, old *boltAnchor, a boltAnchor) error {
+	if old != nil {
+		if err := deleteBoltIndexes(tx, old); err != nil {
+			return err
+		}
+	}
+
+	v, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(boltAnchors).Put(boltKey(a.ID), v); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(boltAnchorsByURL).Put(boltURLKey(a.URL, a.ID), nil); err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltAnchorsByUpdated).Put(append(boltTimeKey(a.UpdatedAt), boltKey(a.ID)...), nil)
+}
+
+func deleteBoltIndexes(tx *bolt.Tx, a *boltAnchor) error {
+	if err := tx.Bucket(boltAnchorsByURL).Delete(boltURLKey(a.URL, a.ID)); err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltAnchorsByUpdated).Delete(append(boltTimeKey(a.UpdatedAt), boltKey(a.ID)...))
+}
+
+// boltURLKey is the URL, a zero byte and the anchor key.
+func boltURLKey(url string, id int) []byte {
+	key := make([]byte, 0, len(url)+9)
+	key = append(key, url...)
+	key = append(key, 0)
+
+	return append(key, boltKey(id)...)
+}
+
+// boltTimeKey encodes t so that keys sort in time order. Times before
+// 1970 are stored as 1970.
+func boltTimeKey(t time.Time) []byte {
+	var nanos uint64
+	if t.After(time.Unix(0, 0)) {
+		nanos = uint64(t.UnixNano())
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, nanos)
+
+	return key
+}
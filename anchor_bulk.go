@@ -0,0 +1,193 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrBulkRolledBack is the result of the operations of a transactional
+// bulk request that were undone, or never run, because another failed.
+var ErrBulkRolledBack = errors.New("not applied: another operation in the transaction failed")
+
+// BulkOperation is one change in a bulk request. Create takes URL,
+// update takes ID, URL and optionally Version, and delete takes ID and
+// optionally Version.
+type BulkOperation struct {
+	Op      string `json:"op"`
+	ID      int    `json:"id,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Version int    `json:"version,omitempty"`
+}
+
+// BulkOperationError is returned for an operation that is malformed,
+// without touching the repository.
+type BulkOperationError struct {
+	msg string
+}
+
+func (e *BulkOperationError) Error() string {
+	return e.msg
+}
+
+// Validate checks that op has the fields its kind needs.
+func (op BulkOperation) Validate() error {
+	switch op.Op {
+	case "create":
+		if op.URL == "" {
+			return &BulkOperationError{"create requires a url"}
+		}
+	case "update":
+		if op.ID <= 0 || op.URL == "" {
+			return &BulkOperationError{"update requires an id and a url"}
+		}
+	case "delete":
+		if op.ID <= 0 {
+			return &BulkOperationError{"delete requires an id"}
+		}
+	default:
+		return &BulkOperationError{fmt.Sprintf("unknown op %q", op.Op)}
+	}
+
+	if op.Version < 0 {
+		return &BulkOperationError{"version must not be negative"}
+	}
+
+	return nil
+}
+
+// BulkResult is the outcome of one bulk operation: the anchor as it was
+// left, or why the operation failed.
+type BulkResult struct {
+	Anchor Anchor
+	Err    error
+}
+
+// Bulk runs ops in order. In a transaction the first failure, or any
+// malformed operation, rolls back the others, whose results are
+// ErrBulkRolledBack; otherwise every operation is tried on its own. The
+// error is only for failures of the request as a whole, such as
+// repositories without transactions.
+func (s *AnchorService) Bulk(ctx context.Context, ops []BulkOperation, transaction bool) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+
+	for i, op := range ops {
+		results[i].Err = op.Validate()
+	}
+
+	if !transaction {
+		for i, op := range ops {
+			if results[i].Err != nil {
+				continue
+			}
+
+			var e AnchorEvent
+
+			// Each operation still goes in with its revision and event.
+			err := s.inTx(ctx, func(r anchorRepository) error {
+				results[i] = s.bulkOperation(ctx, r, op)
+				if results[i].Err != nil {
+					return results[i].Err
+				}
+
+				var err error
+				e, err = s.recordEvent(ctx, r, bulkEventTypes[op.Op], results[i].Anchor)
+
+				return err
+			})
+			if results[i].Err == nil && err != nil {
+				results[i] = BulkResult{Err: err}
+			}
+
+			if results[i].Err == nil {
+				s.notify(ctx, e)
+			}
+		}
+
+		return results, nil
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			return rollBackBulk(results), nil
+		}
+	}
+
+	var (
+		failed bool
+		events []AnchorEvent
+	)
+
+	err := s.repos.WithTx(ctx, func(repos Repositories) error {
+		// The transaction may be retried from the start.
+		failed = false
+		events = events[:0]
+
+		for i, op := range ops {
+			results[i] = s.bulkOperation(ctx, repos.Anchors, op)
+			if results[i].Err != nil {
+				failed = true
+				return results[i].Err
+			}
+
+			e, err := s.recordEvent(ctx, repos.Anchors, bulkEventTypes[op.Op], results[i].Anchor)
+			if err != nil {
+				return err
+			}
+
+			events = append(events, e)
+		}
+
+		return nil
+	})
+
+	switch {
+	case failed:
+		return rollBackBulk(results), nil
+	case err != nil:
+		return nil, err
+	}
+
+	for _, e := range events {
+		s.notify(ctx, e)
+	}
+
+	return results, nil
+}
+
+// bulkEventTypes are the types of the events of each kind of operation.
+var bulkEventTypes = map[string]string{
+	"create": AnchorCreated,
+	"update": AnchorUpdated,
+	"delete": AnchorDeleted,
+}
+
+func (s *AnchorService) bulkOperation(ctx context.Context, r anchorRepository, op BulkOperation) BulkResult {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	switch op.Op {
+	case "create":
+		anchor, err := addAnchor(ctx, r, Anchor{URL: op.URL})
+		return BulkResult{Anchor: anchor, Err: err}
+	case "update":
+		anchor, err := updateAnchor(ctx, r, Anchor{ID: op.ID, URL: op.URL, Version: op.Version})
+		return BulkResult{Anchor: anchor, Err: err}
+	case "delete":
+		err := r.DeleteAnchor(ctx, op.ID, op.Version)
+		return BulkResult{Anchor: Anchor{ID: op.ID}, Err: err}
+	}
+
+	return BulkResult{Err: op.Validate()}
+}
+
+// rollBackBulk marks every result that did not fail as rolled back.
+func rollBackBulk(results []BulkResult) []BulkResult {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BulkResult{Err: ErrBulkRolledBack}
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,115 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAnchorServiceBulk(t *testing.T) {
+	stores := []struct {
+		name  string
+		repos func(t *testing.T) Repositories
+	}{
+		{"Memory", func(t *testing.T) Repositories { return NewMemoryStore().Repositories() }},
+		{"SQLite", func(t *testing.T) Repositories { return newTestSQLiteStore(t).Repositories() }},
+		{"Bolt", func(t *testing.T) Repositories { return newTestBoltStore(t).Repositories() }},
+	}
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewAnchorServiceWithRepositories(store.repos(t))
+
+			id, err := s.AddAnchor(ctx, testAnchor)
+			assertNoError(t, err)
+
+			results, err := s.Bulk(ctx, []BulkOperation{
+				{Op: "create", URL: "https://example.com/a"},
+				{Op: "update", ID: id, URL: "https://example.com/b", Version: 1},
+				{Op: "delete", ID: id, Version: 2},
+			}, true)
+			assertNoError(t, err)
+			assertEqual(t, 3, len(results))
+
+			for _, result := range results {
+				assertNoError(t, result.Err)
+			}
+
+			created := results[0].Anchor
+			assertEqual(t, Anchor{ID: created.ID, URL: "https://example.com/a", Version: 1}, created)
+			assertEqual(t, 2, results[1].Anchor.Version)
+
+			// A failure rolls back the whole transaction.
+			results, err = s.Bulk(ctx, []BulkOperation{
+				{Op: "update", ID: created.ID, URL: "https://example.com/c"},
+				{Op: "delete", ID: id},
+			}, true)
+			assertNoError(t, err)
+			assertEqual(t, ErrBulkRolledBack, results[0].Err)
+			assertEqual(t, ErrAnchorNotFound, results[1].Err)
+
+			anchor, err := s.GetAnchor(ctx, created.ID)
+			assertNoError(t, err)
+			assertEqual(t, created, anchor)
+
+			// Best effort carries on past failures.
+			results, err = s.Bulk(ctx, []BulkOperation{
+				{Op: "delete", ID: id},
+				{Op: "update", ID: created.ID, URL: "https://example.com/c"},
+			}, false)
+			assertNoError(t, err)
+			assertEqual(t, ErrAnchorNotFound, results[0].Err)
+			assertNoError(t, results[1].Err)
+
+			anchor, err = s.GetAnchor(ctx, created.ID)
+			assertNoError(t, err)
+			assertEqual(t, "https://example.com/c", anchor.URL)
+		})
+	}
+}
+
+func TestAnchorServiceBulkInvalid(t *testing.T) {
+	ctx := context.Background()
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+
+	ops := []BulkOperation{
+		{Op: "create", URL: "https://example.com"},
+		{Op: "create"},
+		{Op: "update", URL: "https://example.com"},
+		{Op: "delete"},
+		{Op: "tag", ID: 1},
+		{Op: "delete", ID: 1, Version: -1},
+	}
+
+	// Invalid operations fail a transaction before it starts.
+	results, err := s.Bulk(ctx, ops, true)
+	assertNoError(t, err)
+	assertEqual(t, ErrBulkRolledBack, results[0].Err)
+
+	for i, result := range results[1:] {
+		var opErr *BulkOperationError
+		if !errors.As(result.Err, &opErr) {
+			t.Errorf("operation %d: expected a BulkOperationError, got %v", i+1, result.Err)
+		}
+	}
+
+	anchors, err := s.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(anchors))
+
+	results, err = s.Bulk(ctx, ops, false)
+	assertNoError(t, err)
+	assertNoError(t, results[0].Err)
+
+	anchors, err = s.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+}
+
+func TestAnchorServiceBulkNoTx(t *testing.T) {
+	s := NewAnchorService(NewAnchorMemoryRepository())
+
+	_, err := s.Bulk(context.Background(), []BulkOperation{{Op: "create", URL: "https://example.com"}}, true)
+	assertEqual(t, ErrTxUnsupported, err)
+}
@@ -0,0 +1,95 @@
+package junkboy
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Types of AnchorEvent.
+const (
+	AnchorCreated  = "anchor.created"
+	AnchorUpdated  = "anchor.updated"
+	AnchorDeleted  = "anchor.deleted"
+	AnchorRestored = "anchor.restored"
+)
+
+// AnchorEventTypes lists every type of AnchorEvent.
+var AnchorEventTypes = []string{AnchorCreated, AnchorUpdated, AnchorDeleted, AnchorRestored}
+
+// AnchorEvent is a change made through an AnchorService. Anchor is the
+// anchor as the change left it; for deletions only its ID is set.
+type AnchorEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor,omitempty"`
+	Anchor Anchor    `json:"anchor"`
+}
+
+// AnchorListener is called with every change once it has been stored. It
+// runs on the goroutine that made the change, so it must not block.
+type AnchorListener func(ctx context.Context, e AnchorEvent)
+
+// AddListener registers fn to be called after every change. Listeners
+// must be added before the service is used.
+func (s *AnchorService) AddListener(fn AnchorListener) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// change runs fn, which makes a change to an anchor and returns the
+// anchor as it left it, in a transaction along with the event of the
+// change, and tells the listeners once it has committed.
+func (s *AnchorService) change(ctx context.Context, eventType string, fn func(r anchorRepository) (Anchor, error)) (Anchor, error) {
+	var (
+		anchor Anchor
+		e      AnchorEvent
+	)
+
+	err := s.inTx(ctx, func(r anchorRepository) error {
+		var err error
+		if anchor, err = fn(r); err != nil {
+			return err
+		}
+
+		e, err = s.recordEvent(ctx, r, eventType, anchor)
+
+		return err
+	})
+	if err != nil {
+		return anchor, err
+	}
+
+	s.notify(ctx, e)
+
+	return anchor, nil
+}
+
+// recordEvent adds the event of a change to the event log of r, which is
+// in the transaction of the change, and drops the events that are no
+// longer kept.
+func (s *AnchorService) recordEvent(ctx context.Context, r anchorRepository, eventType string, a Anchor) (AnchorEvent, error) {
+	logged, err := r.AddEvent(ctx, AnchorEvent{
+		Type:   eventType,
+		Time:   time.Now().UTC(),
+		Actor:  ActorFromContext(ctx),
+		Anchor: a,
+	})
+	if err != nil {
+		return AnchorEvent{}, err
+	}
+
+	if expired := logged.ID - int(atomic.LoadInt64(&s.maxEvents)); expired > 0 {
+		if err := r.PruneEvents(ctx, expired); err != nil {
+			return AnchorEvent{}, err
+		}
+	}
+
+	return logged.AnchorEvent, nil
+}
+
+// notify tells the listeners about a change that has been stored.
+func (s *AnchorService) notify(ctx context.Context, e AnchorEvent) {
+	for _, fn := range s.listeners {
+		fn(ctx, e)
+	}
+}
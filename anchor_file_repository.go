@@ -0,0 +1,1078 @@
+package junkboy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+type FileOptions struct {
+	// Format of new anchor files: json, yaml or markdown. Existing files
+	// keep their format when updated.
+	Format string
+	// Watch reloads anchors edited, added or removed by other programs.
+	Watch bool
+}
+
+func DefaultFileOptions() FileOptions {
+	return FileOptions{
+		Format: "yaml",
+		Watch:  true,
+	}
+}
+
+func (o FileOptions) Validate() error {
+	if _, ok := anchorFileExtensions[o.Format]; !ok {
+		return fmt.Errorf("invalid format %q, expected json, yaml or markdown", o.Format)
+	}
+
+	return nil
+}
+
+var anchorFileExtensions = map[string]string{
+	"json":     ".json",
+	"yaml":     ".yaml",
+	"markdown": ".md",
+}
+
+// anchorFileName matches the files holding anchors, <id>.<ext>.
+var anchorFileName = regexp.MustCompile(`^([1-9][0-9]*)\.(json|ya?ml|md)$`)
+
+// anchorFile is an anchor file as read from disk. Fields other than url
+// and version, and the body of a Markdown file, are kept when the anchor
+// is updated.
+type anchorFile struct {
+	path   string
+	fields map[string]interface{}
+	body   []byte
+}
+
+func (f *anchorFile) url() string {
+	url, _ := f.fields["url"].(string)
+	return url
+}
+
+// version returns the version field, 1 if it is missing. JSON numbers
+// decode as float64 and YAML ones as int.
+func (f *anchorFile) version() int {
+	switch v := f.fields["version"].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 1
+	}
+}
+
+func (f *anchorFile) anchor(id int) Anchor {
+	return Anchor{ID: id, URL: f.url(), Version: f.version()}
+}
+
+// deletedAt returns when an anchor in the trash was deleted. YAML may
+// decode the field as a time, JSON always leaves it a string.
+func (f *anchorFile) deletedAt() time.Time {
+	switch v := f.fields["deleted_at"].(type) {
+	case time.Time:
+		return v
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	default:
+		return time.Time{}
+	}
+}
+
+// clone returns a copy of f whose fields can be changed.
+func (f *anchorFile) clone() *anchorFile {
+	c := &anchorFile{
+		path:   f.path,
+		fields: make(map[string]interface{}, len(f.fields)),
+		body:   f.body,
+	}
+
+	for k, v := range f.fields {
+		c.fields[k] = v
+	}
+
+	return c
+}
+
+// sameContent reports whether f and g differ in at most their version.
+func (f *anchorFile) sameContent(g *anchorFile) bool {
+	if !bytes.Equal(f.body, g.body) {
+		return false
+	}
+
+	// A file edited by hand may have no version, while its index entry
+	// has the one it was given.
+	for _, fields := range [][2]map[string]interface{}{{f.fields, g.fields}, {g.fields, f.fields}} {
+		for k, v := range fields[0] {
+			if k == "version" {
+				continue
+			}
+
+			if w, ok := fields[1][k]; !ok || !reflect.DeepEqual(v, w) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// AnchorFileRepository keeps each anchor in its own small file named after
+// its ID, so that a directory of anchors can live in a Git repository. The
+// files are indexed in memory when the repository is created, and every
+// write replaces a file atomically. IDs are never reused while the
+// repository is open, but after a restart the ID of a purged newest
+// anchor may be given out again. Deleted anchors move to a .trash
+// subdirectory with a deleted_at field, which is only read at startup.
+// Revisions are appended to a JSON Lines file per anchor in .revisions,
+// and events to .events.jsonl, whose kept events are also held in memory.
+type AnchorFileRepository struct {
+	dir  string
+	opts FileOptions
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	files  map[int]*anchorFile
+	trash  map[int]*anchorFile
+	lastID int
+
+	events      []LoggedEvent
+	eventLines  int
+	lastEventID int
+
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	onReload func(AnchorFileChange)
+}
+
+// FileActor is the actor of changes made to anchor files by other
+// programs.
+const FileActor = "file"
+
+// AnchorFileChange is a change to an anchor made by another program
+// editing, adding or removing its file. Before is the anchor as it was,
+// unless it was just added, and Anchor the anchor as the change left it;
+// for removals only its ID is set.
+type AnchorFileChange struct {
+	Type   string
+	Before Anchor
+	Anchor Anchor
+}
+
+// SetReloadFunc sets fn to be called with every change the watcher finds,
+// once it has been indexed. Changes found before it is set, including
+// those made while the repository was closed, are only indexed.
+func (r *AnchorFileRepository) SetReloadFunc(fn func(AnchorFileChange)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onReload = fn
+}
+
+// NewAnchorFileRepository indexes the anchor files in dir, creating it if
+// needed. Files that cannot be parsed are logged and skipped.
+func NewAnchorFileRepository(dir string, opts FileOptions) (*AnchorFileRepository, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory required")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &AnchorFileRepository{
+		dir:   dir,
+		opts:  opts,
+		now:   time.Now,
+		files: map[int]*anchorFile{},
+		trash: map[int]*anchorFile{},
+	}
+
+	if opts.Watch {
+		// Watch before the initial scan so no edit is missed in between.
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+
+		r.watcher = watcher
+		r.done = make(chan struct{})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	// The trash directory is only created by the first delete.
+	trashEntries, err := os.ReadDir(filepath.Join(dir, anchorTrashDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		r.Close()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	for _, entry := range entries {
+		r.reload(entry.Name())
+	}
+
+	for _, entry := range trashEntries {
+		r.loadTrash(entry.Name())
+	}
+
+	err = r.loadEvents()
+	r.mu.Unlock()
+
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if r.watcher != nil {
+		go r.watch()
+	}
+
+	return r, nil
+}
+
+// Close stops watching the directory.
+func (r *AnchorFileRepository) Close() error {
+	if r.watcher == nil {
+		return nil
+	}
+
+	err := r.watcher.Close()
+	<-r.done
+
+	return err
+}
+
+func (r *AnchorFileRepository) watch() {
+	defer close(r.done)
+
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+
+			r.mu.Lock()
+			change, changed := r.reload(filepath.Base(event.Name))
+			onReload := r.onReload
+			r.mu.Unlock()
+
+			// The callback records the change through the repository,
+			// so it runs without r.mu.
+			if changed && onReload != nil {
+				onReload(change)
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Printf("watching %s: %v", r.dir, err)
+		}
+	}
+}
+
+// reload brings the index entry for the file name up to date with the
+// disk, and returns the change to its anchor, if any. The repository's
+// own writes are indexed as they are made, so they are not changes here.
+// The caller must hold r.mu.
+func (r *AnchorFileRepository) reload(name string) (AnchorFileChange, bool) {
+	m := anchorFileName.FindStringSubmatch(name)
+	if m == nil {
+		return AnchorFileChange{}, false
+	}
+
+	id, err := strconv.Atoi(m[1])
+	if err != nil {
+		return AnchorFileChange{}, false
+	}
+
+	// Never hand out the ID of a file on disk, even one that is broken.
+	if id > r.lastID {
+		r.lastID = id
+	}
+
+	path := filepath.Join(r.dir, name)
+
+	f, err := readAnchorFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Only forget the anchor if this was the file it was read from, as
+		// it may have been rewritten in another format.
+		if current, ok := r.files[id]; ok && current.path == path {
+			delete(r.files, id)
+			return AnchorFileChange{Type: AnchorDeleted, Before: current.anchor(id), Anchor: Anchor{ID: id}}, true
+		}
+
+		return AnchorFileChange{}, false
+	}
+
+	if err != nil {
+		log.Printf("skipping anchor file %s: %v", path, err)
+		return AnchorFileChange{}, false
+	}
+
+	current, ok := r.files[id]
+
+	// Someone editing a file by hand is unlikely to bump its version, but
+	// the edit must still invalidate the versions clients hold. Reading
+	// the same edit again must not bump it twice, or take it back.
+	if ok && f.version() <= current.version() {
+		if f.sameContent(current) {
+			f.fields["version"] = current.version()
+		} else {
+			f.fields["version"] = current.version() + 1
+		}
+	}
+
+	r.files[id] = f
+
+	switch {
+	case !ok:
+		return AnchorFileChange{Type: AnchorCreated, Anchor: f.anchor(id)}, true
+	case f.anchor(id) != current.anchor(id):
+		return AnchorFileChange{Type: AnchorUpdated, Before: current.anchor(id), Anchor: f.anchor(id)}, true
+	default:
+		return AnchorFileChange{}, false
+	}
+}
+
+const (
+	// anchorTrashDir is the subdirectory deleted anchors are moved to.
+	anchorTrashDir = ".trash"
+	// anchorRevisionsDir is the subdirectory revisions are kept in.
+	anchorRevisionsDir = ".revisions"
+	// anchorEventsFile is the file events are appended to.
+	anchorEventsFile = ".events.jsonl"
+)
+
+// loadTrash indexes the file name in the trash directory. The caller must
+// hold r.mu.
+func (r *AnchorFileRepository) loadTrash(name string) {
+	m := anchorFileName.FindStringSubmatch(name)
+	if m == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(m[1])
+	if err != nil {
+		return
+	}
+
+	if id > r.lastID {
+		r.lastID = id
+	}
+
+	path := filepath.Join(r.dir, anchorTrashDir, name)
+
+	f, err := readAnchorFile(path)
+	if err != nil {
+		log.Printf("skipping trashed anchor file %s: %v", path, err)
+		return
+	}
+
+	r.trash[id] = f
+}
+
+func readAnchorFile(path string) (*anchorFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &anchorFile{path: path, fields: map[string]interface{}{}}
+
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(b, &f.fields)
+	case ".md":
+		var frontmatter []byte
+
+		frontmatter, f.body, err = splitFrontmatter(b)
+		if err == nil {
+			err = yaml.Unmarshal(frontmatter, &f.fields)
+		}
+	default:
+		err = yaml.Unmarshal(b, &f.fields)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := f.fields["url"].(string); !ok {
+		return nil, fmt.Errorf("url missing or not a string")
+	}
+
+	return f, nil
+}
+
+var frontmatterDelimiter = []byte("---\n")
+
+// splitFrontmatter splits a Markdown file into its YAML frontmatter,
+// between two --- lines at the start of the file, and the rest.
+func splitFrontmatter(b []byte) (frontmatter, body []byte, err error) {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+
+	if !bytes.HasPrefix(b, frontmatterDelimiter) {
+		return nil, nil, fmt.Errorf("missing frontmatter")
+	}
+
+	rest := b[len(frontmatterDelimiter):]
+
+	end := bytes.Index(rest, append([]byte("\n"), frontmatterDelimiter...))
+	if end < 0 {
+		if bytes.HasSuffix(rest, []byte("\n---")) {
+			return rest[:len(rest)-3], nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("unterminated frontmatter")
+	}
+
+	return rest[:end+1], rest[end+1+len(frontmatterDelimiter):], nil
+}
+
+func (f *anchorFile) encode() ([]byte, error) {
+	switch filepath.Ext(f.path) {
+	case ".json":
+		b, err := json.MarshalIndent(f.fields, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return append(b, '\n'), nil
+	case ".md":
+		frontmatter, err := yaml.Marshal(f.fields)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.Write(frontmatterDelimiter)
+		buf.Write(frontmatter)
+		buf.Write(frontmatterDelimiter)
+		buf.Write(f.body)
+
+		return buf.Bytes(), nil
+	default:
+		return yaml.Marshal(f.fields)
+	}
+}
+
+// writeFileAtomic replaces path with b through a temporary file in the
+// same directory, so readers never see a partial file. The file gets mode
+// perm, which is set before the rename so it is never readable by more.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// Remove is a no-op once the rename has succeeded.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *AnchorFileRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.lastID + 1
+
+	f := &anchorFile{
+		path:   filepath.Join(r.dir, strconv.Itoa(id)+anchorFileExtensions[r.opts.Format]),
+		fields: map[string]interface{}{"url": a.URL, "version": 1},
+	}
+
+	if err := r.write(f); err != nil {
+		return 0, err
+	}
+
+	r.files[id] = f
+	r.lastID = id
+
+	return id, nil
+}
+
+func (r *AnchorFileRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return a, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.files[a.ID]
+	if !ok {
+		return a, ErrAnchorNotFound
+	}
+
+	if a.Version != 0 && a.Version != current.version() {
+		return a, ErrAnchorVersionMismatch
+	}
+
+	f := current.clone()
+	f.fields["url"] = a.URL
+	f.fields["version"] = current.version() + 1
+
+	if err := r.write(f); err != nil {
+		return a, err
+	}
+
+	r.files[a.ID] = f
+
+	return f.anchor(a.ID), nil
+}
+
+func (r *AnchorFileRepository) write(f *anchorFile) error {
+	b, err := f.encode()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.path, b, 0o644)
+}
+
+func (r *AnchorFileRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return Anchor{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, ok := r.files[id]
+	if !ok {
+		return Anchor{}, ErrAnchorNotFound
+	}
+
+	return f.anchor(id), nil
+}
+
+func (r *AnchorFileRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return r.ListAnchors(ctx, 0, 0)
+}
+
+func (r *AnchorFileRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	anchors := []Anchor{}
+
+	for id, f := range r.files {
+		if id > after {
+			anchors = append(anchors, f.anchor(id))
+		}
+	}
+
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].ID < anchors[j].ID })
+
+	if limit > 0 && len(anchors) > limit {
+		anchors = anchors[:limit]
+	}
+
+	return anchors, nil
+}
+
+func (r *AnchorFileRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.files[id]
+	if !ok {
+		return ErrAnchorNotFound
+	}
+
+	if version != 0 && version != f.version() {
+		return ErrAnchorVersionMismatch
+	}
+
+	trashed := f.clone()
+	trashed.path = filepath.Join(r.dir, anchorTrashDir, filepath.Base(f.path))
+	trashed.fields["deleted_at"] = r.now().UTC().Format(time.RFC3339Nano)
+
+	if err := os.MkdirAll(filepath.Dir(trashed.path), 0o755); err != nil {
+		return err
+	}
+
+	if err := r.write(trashed); err != nil {
+		return err
+	}
+
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		os.Remove(trashed.path)
+		return err
+	}
+
+	delete(r.files, id)
+	r.trash[id] = trashed
+
+	return nil
+}
+
+func (r *AnchorFileRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	anchors := make([]TrashedAnchor, 0, len(r.trash))
+	for id, f := range r.trash {
+		anchors = append(anchors, TrashedAnchor{Anchor: f.anchor(id), DeletedAt: f.deletedAt()})
+	}
+
+	sort.Slice(anchors, func(i, j int) bool {
+		if !anchors[i].DeletedAt.Equal(anchors[j].DeletedAt) {
+			return anchors[i].DeletedAt.After(anchors[j].DeletedAt)
+		}
+
+		return anchors[i].ID > anchors[j].ID
+	})
+
+	return anchors, nil
+}
+
+func (r *AnchorFileRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return Anchor{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trashed, ok := r.trash[id]
+	if !ok {
+		return Anchor{}, ErrAnchorNotFound
+	}
+
+	if current, ok := r.files[id]; ok {
+		return Anchor{}, fmt.Errorf("cannot restore anchor %d over %s", id, current.path)
+	}
+
+	f := trashed.clone()
+	f.path = filepath.Join(r.dir, filepath.Base(trashed.path))
+	f.fields["version"] = trashed.version() + 1
+	delete(f.fields, "deleted_at")
+
+	if err := r.write(f); err != nil {
+		return Anchor{}, err
+	}
+
+	if err := os.Remove(trashed.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Anchor{}, err
+	}
+
+	delete(r.trash, id)
+	r.files[id] = f
+
+	return f.anchor(id), nil
+}
+
+func (r *AnchorFileRepository) PurgeAnchor(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purge(id)
+}
+
+func (r *AnchorFileRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+
+	for id, f := range r.trash {
+		if !f.deletedAt().Before(before) {
+			continue
+		}
+
+		if err := r.purge(id); err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// purge removes the anchor id from the trash. The caller must hold r.mu.
+func (r *AnchorFileRepository) purge(id int) error {
+	f, ok := r.trash[id]
+	if !ok {
+		return ErrAnchorNotFound
+	}
+
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	delete(r.trash, id)
+
+	// The ID may be given out again after a restart, so the revisions must
+	// go too.
+	if err := os.Remove(r.revisionsPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (r *AnchorFileRepository) revisionsPath(anchorID int) string {
+	return filepath.Join(r.dir, anchorRevisionsDir, strconv.Itoa(anchorID)+".jsonl")
+}
+
+func (r *AnchorFileRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return rev, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revisions, err := r.readRevisions(rev.AnchorID)
+	if err != nil {
+		return rev, err
+	}
+
+	rev.Number = len(revisions) + 1
+	rev.CreatedAt = r.now().UTC()
+
+	line, err := json.Marshal(rev)
+	if err != nil {
+		return rev, err
+	}
+
+	path := r.revisionsPath(rev.AnchorID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return rev, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return rev, err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return rev, err
+	}
+
+	return rev, f.Close()
+}
+
+func (r *AnchorFileRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.readRevisions(anchorID)
+}
+
+func (r *AnchorFileRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	revisions, err := r.ListRevisions(ctx, anchorID)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if number < 1 || number > len(revisions) {
+		return Revision{}, ErrRevisionNotFound
+	}
+
+	return revisions[number-1], nil
+}
+
+// readRevisions reads every revision of the anchor. The caller must hold
+// r.mu.
+func (r *AnchorFileRepository) readRevisions(anchorID int) ([]Revision, error) {
+	revisions := []Revision{}
+
+	if anchorID <= 0 {
+		return revisions, nil
+	}
+
+	b, err := os.ReadFile(r.revisionsPath(anchorID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return revisions, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	for dec.More() {
+		var rev Revision
+		if err := dec.Decode(&rev); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.revisionsPath(anchorID), err)
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+func (r *AnchorFileRepository) eventsPath() string {
+	return filepath.Join(r.dir, anchorEventsFile)
+}
+
+// loadEvents reads the events file, if there is one. The latest event is
+// never pruned, so the last ID is always in it. The caller must hold r.mu.
+func (r *AnchorFileRepository) loadEvents() error {
+	b, err := os.ReadFile(r.eventsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	for dec.More() {
+		var e LoggedEvent
+		if err := dec.Decode(&e); err != nil {
+			return fmt.Errorf("%s: %w", r.eventsPath(), err)
+		}
+
+		r.events = append(r.events, e)
+		r.eventLines++
+		r.lastEventID = e.ID
+	}
+
+	return nil
+}
+
+func (r *AnchorFileRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return LoggedEvent{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logged := LoggedEvent{ID: r.lastEventID + 1, AnchorEvent: e}
+
+	line, err := json.Marshal(logged)
+	if err != nil {
+		return logged, err
+	}
+
+	f, err := os.OpenFile(r.eventsPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return logged, err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return logged, err
+	}
+
+	if err := f.Close(); err != nil {
+		return logged, err
+	}
+
+	r.events = append(r.events, logged)
+	r.eventLines++
+	r.lastEventID = logged.ID
+
+	return logged, nil
+}
+
+func (r *AnchorFileRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].ID > after })
+	events := r.events[i:]
+
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	return append([]LoggedEvent{}, events...), nil
+}
+
+func (r *AnchorFileRepository) LastEventID(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastEventID, nil
+}
+
+// PruneEvents drops the events from memory, and rewrites the file once
+// it holds twice as many lines as there are events kept. The anchor files
+// have already changed by then, so failing to rewrite it is only logged.
+func (r *AnchorFileRepository) PruneEvents(ctx context.Context, upTo int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Copy rather than reslice so the dropped events can be freed.
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].ID > upTo })
+	r.events = append([]LoggedEvent(nil), r.events[i:]...)
+
+	if r.eventLines < 2*len(r.events) {
+		return nil
+	}
+
+	if err := r.compactEvents(); err != nil {
+		log.Printf("failed to compact %s: %v", r.eventsPath(), err)
+	}
+
+	return nil
+}
+
+// compactEvents rewrites the events file with only the events kept. The
+// caller must hold r.mu.
+func (r *AnchorFileRepository) compactEvents() error {
+	var b []byte
+
+	for _, e := range r.events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		b = append(append(b, line...), '\n')
+	}
+
+	if err := writeFileAtomic(r.eventsPath(), b, 0o644); err != nil {
+		return err
+	}
+
+	r.eventLines = len(r.events)
+
+	return nil
+}
+
+func (r *AnchorFileRepository) CountAnchors(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.files), nil
+}
+
+// FileStore holds the flat-file repositories. Files cannot be changed
+// together atomically, so it does not support transactions.
+type FileStore struct {
+	Anchors *AnchorFileRepository
+}
+
+func NewFileStore(dir string, opts FileOptions) (*FileStore, error) {
+	anchors, err := NewAnchorFileRepository(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		Anchors: anchors,
+	}, nil
+}
+
+// Repositories returns the repositories. Their WithTx always fails.
+func (s *FileStore) Repositories() Repositories {
+	return Repositories{
+		Anchors: s.Anchors,
+	}
+}
+
+// Close stops watching for external edits.
+func (s *FileStore) Close() error {
+	return s.Anchors.Close()
+}
@@ -0,0 +1,277 @@
+package junkboy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAnchorFileRepository(t *testing.T, dir string, opts FileOptions) *AnchorFileRepository {
+	t.Helper()
+
+	r, err := NewAnchorFileRepository(dir, opts)
+	assertNoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	assertNoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	assertNoError(t, err)
+
+	return string(b)
+}
+
+func TestAnchorFileRepositoryFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		file   string
+		want   string
+	}{
+		{"json", "1.json", "{\n  \"url\": \"https://example.com\",\n  \"version\": 1\n}\n"},
+		{"yaml", "1.yaml", "url: https://example.com\nversion: 1\n"},
+		{"markdown", "1.md", "---\nurl: https://example.com\nversion: 1\n---\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			r := newTestAnchorFileRepository(t, dir, FileOptions{Format: tt.format})
+
+			id, err := r.AddAnchor(context.Background(), Anchor{URL: "https://example.com"})
+			assertNoError(t, err)
+			assertEqual(t, 1, id)
+			assertEqual(t, tt.want, readTestFile(t, filepath.Join(dir, tt.file)))
+
+			entries, err := os.ReadDir(dir)
+			assertNoError(t, err)
+			assertEqual(t, 1, len(entries))
+		})
+	}
+}
+
+func TestAnchorFileRepositoryIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(dir, "3.md"), "---\nurl: https://example.com/md\ntags: [go]\n---\n# Notes\n\nKeep me.\n")
+	writeTestFile(t, filepath.Join(dir, "7.json"), `{"url": "https://example.com/json"}`)
+	writeTestFile(t, filepath.Join(dir, "8.yml"), "title: no url\n")
+	writeTestFile(t, filepath.Join(dir, "9.yaml"), "url: [not, a, string]\n")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "# My bookmarks\n")
+
+	r := newTestAnchorFileRepository(t, dir, FileOptions{Format: "yaml"})
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(anchors))
+	assertEqual(t, Anchor{ID: 3, URL: "https://example.com/md", Version: 1}, anchors[0])
+	assertEqual(t, Anchor{ID: 7, URL: "https://example.com/json", Version: 1}, anchors[1])
+
+	// New IDs follow the highest one on disk, including skipped files.
+	id, err := r.AddAnchor(ctx, Anchor{URL: "https://example.com/new"})
+	assertNoError(t, err)
+	assertEqual(t, 10, id)
+
+	// Updates keep the format, other frontmatter fields and the body.
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: 3, URL: "https://example.com/updated"})
+	assertNoError(t, err)
+	assertEqual(t, "---\ntags:\n    - go\nurl: https://example.com/updated\nversion: 2\n---\n# Notes\n\nKeep me.\n",
+		readTestFile(t, filepath.Join(dir, "3.md")))
+
+	assertNoError(t, r.DeleteAnchor(ctx, 7, 1))
+
+	if _, err := os.Stat(filepath.Join(dir, "7.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected 7.json to be moved to the trash, got %v", err)
+	}
+}
+
+func TestAnchorFileRepositoryTrash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(dir, "3.md"), "---\nurl: https://example.com/md\n---\n# Notes\n")
+
+	r := newTestAnchorFileRepository(t, dir, FileOptions{Format: "yaml"})
+	r.now = func() time.Time { return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	assertNoError(t, r.DeleteAnchor(ctx, 3, 0))
+	assertEqual(t, "---\ndeleted_at: \"2021-06-01T12:00:00Z\"\nurl: https://example.com/md\n---\n# Notes\n",
+		readTestFile(t, filepath.Join(dir, ".trash", "3.md")))
+
+	// The trash is read back on startup and its IDs are not given out again.
+	r.Close()
+	r = newTestAnchorFileRepository(t, dir, FileOptions{Format: "yaml"})
+
+	trash, err := r.ListTrash(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(trash))
+	assertEqual(t, Anchor{ID: 3, URL: "https://example.com/md", Version: 1}, trash[0].Anchor)
+	assertEqual(t, true, trash[0].DeletedAt.Equal(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)))
+
+	id, err := r.AddAnchor(ctx, Anchor{URL: "https://example.com/new"})
+	assertNoError(t, err)
+	assertEqual(t, 4, id)
+
+	_, err = r.RestoreAnchor(ctx, 3)
+	assertNoError(t, err)
+	assertEqual(t, "---\nurl: https://example.com/md\nversion: 2\n---\n# Notes\n", readTestFile(t, filepath.Join(dir, "3.md")))
+
+	if _, err := os.Stat(filepath.Join(dir, ".trash", "3.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected .trash/3.md to be removed, got %v", err)
+	}
+}
+
+func TestAnchorFileRepositoryWatch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	r := newTestAnchorFileRepository(t, dir, FileOptions{Format: "yaml", Watch: true})
+
+	id, err := r.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	// eventually polls until the watcher has caught up with an edit.
+	eventually := func(what string, ok func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(dir, "1.yaml"), "url: https://example.com/edited\n")
+	eventually("edit", func() bool {
+		anchor, err := r.GetAnchor(ctx, id)
+		return err == nil && anchor.URL == "https://example.com/edited"
+	})
+
+	writeTestFile(t, filepath.Join(dir, "5.json"), `{"url": "https://example.com/added"}`)
+	eventually("add", func() bool {
+		_, err := r.GetAnchor(ctx, 5)
+		return err == nil
+	})
+
+	assertNoError(t, os.Remove(filepath.Join(dir, "1.yaml")))
+	eventually("remove", func() bool {
+		_, err := r.GetAnchor(ctx, id)
+		return err == ErrAnchorNotFound
+	})
+
+	id, err = r.AddAnchor(ctx, Anchor{URL: "https://example.com/next"})
+	assertNoError(t, err)
+	assertEqual(t, 6, id)
+}
+
+// TestAnchorFileRepositoryWatchEvents checks that edits made by other
+// programs get a revision and an event, and that the repository's own
+// writes are not seen as edits.
+func TestAnchorFileRepositoryWatchEvents(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewAnchorService(newTestAnchorFileRepository(t, dir, FileOptions{Format: "yaml", Watch: true}))
+	l := NewEventLog(s)
+
+	id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	waitForEvents := func(n int) []LoggedEvent {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			events, err := l.Since(ctx, 0, 0)
+			assertNoError(t, err)
+
+			if len(events) >= n {
+				return events
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %d events, got %d", n, len(events))
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(dir, "1.yaml"), "url: https://example.com/edited\n")
+	waitForEvents(2)
+
+	writeTestFile(t, filepath.Join(dir, "5.json"), `{"url": "https://example.com/added"}`)
+	waitForEvents(3)
+
+	assertNoError(t, os.Remove(filepath.Join(dir, "1.yaml")))
+	events := waitForEvents(4)
+
+	want := []struct {
+		eventType string
+		actor     string
+		anchor    Anchor
+	}{
+		{AnchorCreated, "", Anchor{ID: id, URL: "https://example.com", Version: 1}},
+		{AnchorUpdated, FileActor, Anchor{ID: id, URL: "https://example.com/edited", Version: 2}},
+		{AnchorCreated, FileActor, Anchor{ID: 5, URL: "https://example.com/added", Version: 1}},
+		{AnchorDeleted, FileActor, Anchor{ID: id}},
+	}
+
+	assertEqual(t, len(want), len(events))
+
+	for i, w := range want {
+		assertEqual(t, w.eventType, events[i].Type)
+		assertEqual(t, w.actor, events[i].Actor)
+		assertEqual(t, w.anchor, events[i].Anchor)
+	}
+
+	revisions, err := s.ListRevisions(ctx, 5)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(revisions))
+	assertEqual(t, FileActor, revisions[0].Actor)
+	assertEqual(t, FieldChange{Field: "url", New: "https://example.com/added"}, revisions[0].Changes[0])
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		frontmatter string
+		body        string
+		errExpected bool
+	}{
+		{"With body", "---\nurl: x\n---\nbody\n", "url: x\n", "body\n", false},
+		{"No body", "---\nurl: x\n---\n", "url: x\n", "", false},
+		{"No trailing newline", "---\nurl: x\n---", "url: x\n", "", false},
+		{"CRLF", "---\r\nurl: x\r\n---\r\nbody\r\n", "url: x\n", "body\n", false},
+		{"Missing", "url: x\n", "", "", true},
+		{"Unterminated", "---\nurl: x\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontmatter, body, err := splitFrontmatter([]byte(tt.in))
+			if tt.errExpected {
+				assertError(t, err)
+				return
+			}
+
+			assertNoError(t, err)
+			assertEqual(t, tt.frontmatter, string(frontmatter))
+			assertEqual(t, tt.body, string(body))
+		})
+	}
+}
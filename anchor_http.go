@@ -1,35 +1,98 @@
 package junkboy
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type anchorService interface {
-	AddAnchor(a Anchor) (int, error)
-	UpdateAnchor(a Anchor) error
-	GetAnchor(id int) (Anchor, error)
-	GetAnchors() ([]Anchor, error)
-	DeleteAnchor(id int) error
+	AddAnchor(ctx context.Context, a Anchor) (int, error)
+	UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error)
+	GetAnchor(ctx context.Context, id int) (Anchor, error)
+	GetAnchors(ctx context.Context) ([]Anchor, error)
+	ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error)
+	DeleteAnchor(ctx context.Context, id, version int) error
+	Bulk(ctx context.Context, ops []BulkOperation, transaction bool) ([]BulkResult, error)
+	ListTrash(ctx context.Context) ([]TrashedAnchor, error)
+	RestoreAnchor(ctx context.Context, id int) (Anchor, error)
+	PurgeAnchor(ctx context.Context, id int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	ListRevisions(ctx context.Context, id int) ([]Revision, error)
+	GetRevision(ctx context.Context, id, number int) (Revision, error)
+	DiffRevisions(ctx context.Context, id, from, to int) ([]FieldChange, error)
+	RevertAnchor(ctx context.Context, id, number, version int) (Anchor, error)
 }
 
 type AnchorHTTPHandler struct {
 	service anchorService
+
+	requireIfMatch bool
+
+	// adminToken is needed to empty the trash.
+	adminToken string
+
+	maxBulkOperations int
+	maxBulkBodyBytes  int64
 }
 
+// Default limits for POST /anchors/bulk.
+const (
+	DefaultMaxBulkOperations = 1000
+	DefaultMaxBulkBodyBytes  = 10 << 20
+)
+
 func NewAnchorHTTPHandler(s anchorService) *AnchorHTTPHandler {
 	return &AnchorHTTPHandler{
-		service: s,
+		service:           s,
+		maxBulkOperations: DefaultMaxBulkOperations,
+		maxBulkBodyBytes:  DefaultMaxBulkBodyBytes,
 	}
 }
 
+// SetBulkLimits sets the most operations and the largest body accepted by
+// POST /anchors/bulk.
+func (h *AnchorHTTPHandler) SetBulkLimits(maxOperations int, maxBodyBytes int64) {
+	h.maxBulkOperations = maxOperations
+	h.maxBulkBodyBytes = maxBodyBytes
+}
+
+// RequireIfMatch makes PUT, PATCH and DELETE fail with 428 Precondition
+// Required unless the client sends If-Match, so that no one overwrites a
+// change they have not seen.
+func (h *AnchorHTTPHandler) RequireIfMatch(require bool) {
+	h.requireIfMatch = require
+}
+
+// SetAdminToken sets the bearer token needed to empty the whole trash at
+// once. Without one, the trash can only be emptied anchor by anchor.
+func (h *AnchorHTTPHandler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
 func (h *AnchorHTTPHandler) RegisterRoutes(r *Router) {
 	r.AddRoute([]string{"POST", "OPTIONS"}, "/anchor", h.addAnchorHandler)
 	r.AddRoute([]string{"GET", "OPTIONS"}, "/anchors", h.getAnchorsHandler)
+	r.AddRoute([]string{"POST", "OPTIONS"}, "/anchors/bulk", h.bulkAnchorsHandler)
 	r.AddRoute([]string{"GET", "OPTIONS"}, "/anchor/([^/]+)", h.getAnchorHandler)
 	r.AddRoute([]string{"PUT", "OPTIONS"}, "/anchor", h.updateAnchorHandler)
+	r.AddRoute([]string{"PATCH", "OPTIONS"}, "/anchor/([^/]+)", h.patchAnchorHandler)
 	r.AddRoute([]string{"DELETE", "OPTIONS"}, "/anchor/([^/]+)", h.deleteAnchorHandler)
+	r.AddRoute([]string{"GET", "OPTIONS"}, "/anchor/([^/]+)/revisions", h.getRevisionsHandler)
+	r.AddRoute([]string{"GET", "OPTIONS"}, "/anchor/([^/]+)/revisions/([^/]+)", h.getRevisionHandler)
+	r.AddRoute([]string{"GET", "OPTIONS"}, "/anchor/([^/]+)/diff", h.diffRevisionsHandler)
+	r.AddRoute([]string{"POST", "OPTIONS"}, "/anchor/([^/]+)/revert/([^/]+)", h.revertAnchorHandler)
+	r.AddRoute([]string{"GET", "OPTIONS"}, "/trash", h.getTrashHandler)
+	r.AddRoute([]string{"DELETE", "OPTIONS"}, "/trash", h.emptyTrashHandler)
+	r.AddRoute([]string{"POST", "OPTIONS"}, "/trash/([^/]+)/restore", h.restoreAnchorHandler)
+	r.AddRoute([]string{"DELETE", "OPTIONS"}, "/trash/([^/]+)", h.purgeAnchorHandler)
 }
 
 func (h *AnchorHTTPHandler) addAnchorHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,23 +114,188 @@ func (h *AnchorHTTPHandler) addAnchorHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	id, err := h.service.AddAnchor(anchor)
+	id, err := h.service.AddAnchor(r.Context(), anchor)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeServiceError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", anchorETag(1))
 	writeJSON(w, http.StatusCreated, Response{ID: id})
 }
 
+// maxAnchorsPageSize is the largest limit accepted by GET /anchors.
+const maxAnchorsPageSize = 1000
+
+// getAnchorsHandler lists every anchor, or a page of them if after or
+// limit is given. A full page links to the next one in the Link header.
 func (h *AnchorHTTPHandler) getAnchorsHandler(w http.ResponseWriter, r *http.Request) {
-	anchors, err := h.service.GetAnchors()
+	query := r.URL.Query()
+	if query.Get("after") == "" && query.Get("limit") == "" {
+		anchors, err := h.service.GetAnchors(r.Context())
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		writeJSONWithETag(w, r, http.StatusOK, anchors)
+
+		return
+	}
+
+	after, err := queryInt(query, "after", 0)
+	if err != nil || after < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid after '%s'", query.Get("after")))
+		return
+	}
+
+	limit, err := queryInt(query, "limit", maxAnchorsPageSize)
+	if err != nil || limit < 1 || limit > maxAnchorsPageSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAnchorsPageSize))
+		return
+	}
+
+	anchors, err := h.service.ListAnchors(r.Context(), after, limit)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	if len(anchors) == limit {
+		next := url.Values{}
+		next.Set("after", strconv.Itoa(anchors[len(anchors)-1].ID))
+		next.Set("limit", strconv.Itoa(limit))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	writeJSONWithETag(w, r, http.StatusOK, anchors)
+}
+
+// bulkAnchorsHandler runs a batch of creates, updates and deletes, either
+// all in one transaction or each on its own, and reports the outcome of
+// each in a result at the same index.
+func (h *AnchorHTTPHandler) bulkAnchorsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	type Request struct {
+		Mode       string          `json:"mode"`
+		Operations []BulkOperation `json:"operations"`
+	}
+
+	type Result struct {
+		Status  int    `json:"status"`
+		ID      int    `json:"id,omitempty"`
+		Version int    `json:"version,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	type Response struct {
+		Results []Result `json:"results"`
+	}
+
+	if !contentTypeIsValid(w, r, "application/json") {
+		return
+	}
+
+	var req Request
+	if err := readJSONLimit(w, r, &req, h.maxBulkBodyBytes); err != nil {
+		var tooLarge *bodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	var transaction bool
+
+	switch req.Mode {
+	case "", "transaction":
+		transaction = true
+	case "best-effort":
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("mode must be 'transaction' or 'best-effort', got '%s'", req.Mode))
+		return
+	}
+
+	switch {
+	case len(req.Operations) == 0:
+		writeError(w, http.StatusBadRequest, "operations must not be empty")
+		return
+	case len(req.Operations) > h.maxBulkOperations:
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d operations are allowed per request", h.maxBulkOperations))
+		return
+	}
+
+	results, err := h.service.Bulk(r.Context(), req.Operations, transaction)
+	if errors.Is(err, ErrTxUnsupported) {
+		writeError(w, http.StatusNotImplemented, "storage does not support transactions, use best-effort mode")
+		return
+	}
+
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeServiceError(w, r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, anchors)
+	resp := Response{Results: make([]Result, len(results))}
+
+	for i, result := range results {
+		if result.Err != nil {
+			resp.Results[i] = Result{Status: bulkErrorStatus(result.Err), ID: req.Operations[i].ID, Error: result.Err.Error()}
+			continue
+		}
+
+		status := http.StatusOK
+
+		switch req.Operations[i].Op {
+		case "create":
+			status = http.StatusCreated
+		case "delete":
+			status = http.StatusNoContent
+		}
+
+		resp.Results[i] = Result{Status: status, ID: result.Anchor.ID, Version: result.Anchor.Version}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// bulkErrorStatus is the status reported for a bulk operation that
+// failed with err, matching what the single-anchor endpoints would return.
+func bulkErrorStatus(err error) int {
+	var opErr *BulkOperationError
+
+	switch {
+	case errors.As(err, &opErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAnchorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAnchorVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrBulkRolledBack):
+		return http.StatusFailedDependency
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queryInt returns the integer query parameter key, or def if it is
+// missing.
+func queryInt(query url.Values, key string, def int) (int, error) {
+	v := query.Get(key)
+	if v == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(v)
 }
 
 func (h *AnchorHTTPHandler) getAnchorHandler(w http.ResponseWriter, r *http.Request) {
@@ -79,13 +307,20 @@ func (h *AnchorHTTPHandler) getAnchorHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	anchors, err := h.service.GetAnchor(id)
+	anchor, err := h.service.GetAnchor(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeServiceError(w, r, err)
+		return
+	}
+
+	etag := anchorETag(anchor.Version)
+	if !etagNoneMatch(r, etag) {
+		writeNotModified(w, etag)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, anchors)
+	w.Header().Set("ETag", etag)
+	writeJSON(w, http.StatusOK, anchor)
 }
 
 func (h *AnchorHTTPHandler) updateAnchorHandler(w http.ResponseWriter, r *http.Request) {
@@ -99,15 +334,172 @@ func (h *AnchorHTTPHandler) updateAnchorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err := h.service.UpdateAnchor(anchor)
+	// If-Match takes precedence over a version in the body.
+	if r.Header.Get("If-Match") != "" || h.requireIfMatch {
+		version, ok := h.ifMatchVersion(w, r, anchor.ID)
+		if !ok {
+			return
+		}
+
+		anchor.Version = version
+	}
+
+	updated, err := h.service.UpdateAnchor(r.Context(), anchor)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writePreconditionError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", anchorETag(updated.Version))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// patchAnchorHandler changes an anchor with a JSON Merge Patch (RFC 7396)
+// or a JSON Patch (RFC 6902), leaving the fields it does not mention
+// alone.
+func (h *AnchorHTTPHandler) patchAnchorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", mergePatchMediaType+", "+jsonPatchMediaType)
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	if !contentTypeIsValid(w, r, mergePatchMediaType, jsonPatchMediaType) {
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		var tooLarge *bodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	var apply func(doc interface{}) (interface{}, error)
+
+	if mediaType, _ := requestMediaType(r); mediaType == jsonPatchMediaType {
+		ops, err := parseJSONPatch(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		apply = func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, ops)
+		}
+	} else {
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			writeError(w, http.StatusBadRequest, "body contains badly-formed JSON")
+			return
+		}
+
+		apply = func(doc interface{}) (interface{}, error) {
+			return mergePatch(doc, patch), nil
+		}
+	}
+
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	anchor, err := h.service.GetAnchor(r.Context(), id)
+	if err != nil {
+		writePreconditionError(w, r, err)
+		return
+	}
+
+	if version != 0 && version != anchor.Version {
+		writeError(w, http.StatusPreconditionFailed, ErrAnchorVersionMismatch.Error())
+		return
+	}
+
+	patched, err := patchAnchor(anchor, apply)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// The patch was applied to the version just read, so only store it if
+	// that is still the current one.
+	updated, err := h.service.UpdateAnchor(r.Context(), patched)
+	if errors.Is(err, ErrAnchorVersionMismatch) && r.Header.Get("If-Match") == "" {
+		writeError(w, http.StatusConflict, "anchor was modified concurrently, try again")
+		return
+	}
+
+	if err != nil {
+		writePreconditionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", anchorETag(updated.Version))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// patchAnchor applies a patch to the JSON form of a and checks that the
+// result is still an anchor with the same ID and version.
+func patchAnchor(a Anchor, apply func(doc interface{}) (interface{}, error)) (Anchor, error) {
+	var doc interface{}
+
+	js, err := json.Marshal(a)
+	if err == nil {
+		err = json.Unmarshal(js, &doc)
+	}
+
+	if err != nil {
+		return a, err
+	}
+
+	if doc, err = apply(doc); err != nil {
+		return a, err
+	}
+
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return a, errors.New("patched anchor must be a JSON object")
+	}
+
+	if js, err = json.Marshal(doc); err != nil {
+		return a, err
+	}
+
+	var patched Anchor
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&patched); err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		if errors.As(err, &unmarshalTypeError) {
+			return a, fmt.Errorf("patched anchor has incorrect JSON type field %q", unmarshalTypeError.Field)
+		}
+
+		return a, fmt.Errorf("patched anchor is invalid: %s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	switch {
+	case patched.ID != a.ID:
+		return a, errors.New("id cannot be changed")
+	case patched.Version != a.Version:
+		return a, errors.New("version cannot be changed")
+	case patched.URL == "":
+		return a, errors.New("url must not be empty")
+	}
+
+	return patched, nil
+}
+
 func (h *AnchorHTTPHandler) deleteAnchorHandler(w http.ResponseWriter, r *http.Request) {
 	idField := getField(r, 0)
 	id, err := strconv.Atoi(idField)
@@ -117,11 +509,302 @@ func (h *AnchorHTTPHandler) deleteAnchorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = h.service.DeleteAnchor(id)
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	err = h.service.DeleteAnchor(r.Context(), id, version)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writePreconditionError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *AnchorHTTPHandler) getRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	revisions, err := h.service.ListRevisions(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSONWithETag(w, r, http.StatusOK, revisions)
+}
+
+func (h *AnchorHTTPHandler) getRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	revisionField := getField(r, 1)
+	number, err := strconv.Atoi(revisionField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid revision '%s'", revisionField))
+		return
+	}
+
+	revision, err := h.service.GetRevision(r.Context(), id, number)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, revision)
+}
+
+// diffRevisionsHandler compares the anchor as two revisions left it, given
+// by the from and to query parameters.
+func (h *AnchorHTTPHandler) diffRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	type Response struct {
+		From    int           `json:"from"`
+		To      int           `json:"to"`
+		Changes []FieldChange `json:"changes"`
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from '%s'", query.Get("from")))
+		return
+	}
+
+	to, err := strconv.Atoi(query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to '%s'", query.Get("to")))
+		return
+	}
+
+	changes, err := h.service.DiffRevisions(r.Context(), id, from, to)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{From: from, To: to, Changes: changes})
+}
+
+// revertAnchorHandler sets the anchor back to how a revision left it. Like
+// PUT, it takes the version the anchor must be at from If-Match.
+func (h *AnchorHTTPHandler) revertAnchorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	revisionField := getField(r, 1)
+	number, err := strconv.Atoi(revisionField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid revision '%s'", revisionField))
+		return
+	}
+
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	anchor, err := h.service.RevertAnchor(r.Context(), id, number, version)
+	if err != nil {
+		writePreconditionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", anchorETag(anchor.Version))
+	writeJSON(w, http.StatusOK, anchor)
+}
+
+func (h *AnchorHTTPHandler) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	anchors, err := h.service.ListTrash(r.Context())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSONWithETag(w, r, http.StatusOK, anchors)
+}
+
+// emptyTrashHandler permanently deletes every anchor in the trash. As it
+// cannot be undone, it needs the admin token.
+func (h *AnchorHTTPHandler) emptyTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if !adminAuthorized(w, r, h.adminToken) {
+		return
+	}
+
+	type Response struct {
+		Purged int `json:"purged"`
+	}
+
+	n, err := h.service.PurgeTrash(r.Context(), time.Now())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Purged: n})
+}
+
+func (h *AnchorHTTPHandler) restoreAnchorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	anchor, err := h.service.RestoreAnchor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", anchorETag(anchor.Version))
+	writeJSON(w, http.StatusOK, anchor)
+}
+
+func (h *AnchorHTTPHandler) purgeAnchorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	idField := getField(r, 0)
+	id, err := strconv.Atoi(idField)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid anchor id '%s'", idField))
+		return
+	}
+
+	if err := h.service.PurgeAnchor(r.Context(), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// anchorETag is the entity tag of an anchor at version.
+func anchorETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion returns the version the If-Match header of r requires
+// the anchor id to be at, 0 for any. It writes the response and returns
+// false if the request cannot go ahead.
+func (h *AnchorHTTPHandler) ifMatchVersion(w http.ResponseWriter, r *http.Request, id int) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if h.requireIfMatch {
+			writeError(w, http.StatusPreconditionRequired, "If-Match header required")
+			return 0, false
+		}
+
+		return 0, true
+	}
+
+	var versions []int
+
+	for _, tag := range parseETags(header) {
+		if tag == "*" {
+			return 0, true
+		}
+
+		// If-Match uses the strong comparison, which weak tags never pass.
+		version, err := strconv.Atoi(strings.Trim(tag, `"`))
+		if err == nil && strings.HasPrefix(tag, `"`) {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 1 {
+		return versions[0], true
+	}
+
+	// With several tags, check which one is current and make the change
+	// conditional on it, so a concurrent update still fails.
+	if len(versions) > 1 {
+		anchor, err := h.service.GetAnchor(r.Context(), id)
+		if err != nil {
+			writePreconditionError(w, r, err)
+			return 0, false
+		}
+
+		for _, version := range versions {
+			if version == anchor.Version {
+				return version, true
+			}
+		}
+	}
+
+	writeError(w, http.StatusPreconditionFailed, ErrAnchorVersionMismatch.Error())
+
+	return 0, false
+}
+
+// writePreconditionError writes the response for an error from a
+// conditional request. If-Match fails rather than 404s when there is no
+// anchor, as RFC 7232 requires.
+func writePreconditionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrAnchorNotFound) && r.Header.Get("If-Match") != "" {
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+
+	writeServiceError(w, r, err)
+}
@@ -6,22 +6,74 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 type mockAnchorService struct {
-	AddAnchorFunc    func(a Anchor) (int, error)
-	UpdateAnchorFunc func(a Anchor) error
-	GetAnchorFunc    func(id int) (Anchor, error)
-	GetAnchorsFunc   func() ([]Anchor, error)
-	DeleteAnchorFunc func(id int) error
+	AddAnchorFunc     func(a Anchor) (int, error)
+	UpdateAnchorFunc  func(a Anchor) (Anchor, error)
+	GetAnchorFunc     func(id int) (Anchor, error)
+	GetAnchorsFunc    func() ([]Anchor, error)
+	ListAnchorsFunc   func(after, limit int) ([]Anchor, error)
+	DeleteAnchorFunc  func(id, version int) error
+	BulkFunc          func(ops []BulkOperation, transaction bool) ([]BulkResult, error)
+	ListTrashFunc     func() ([]TrashedAnchor, error)
+	RestoreFunc       func(id int) (Anchor, error)
+	PurgeAnchorFunc   func(id int) error
+	PurgeTrashFunc    func(before time.Time) (int, error)
+	ListRevisionsFunc func(id int) ([]Revision, error)
+	GetRevisionFunc   func(id, number int) (Revision, error)
+	DiffRevisionsFunc func(id, from, to int) ([]FieldChange, error)
+	RevertAnchorFunc  func(id, number, version int) (Anchor, error)
 }
 
-func (ar *mockAnchorService) AddAnchor(a Anchor) (int, error)  { return ar.AddAnchorFunc(a) }
-func (ar *mockAnchorService) UpdateAnchor(a Anchor) error      { return ar.UpdateAnchorFunc(a) }
-func (ar *mockAnchorService) GetAnchor(id int) (Anchor, error) { return ar.GetAnchorFunc(id) }
-func (ar *mockAnchorService) GetAnchors() ([]Anchor, error)    { return ar.GetAnchorsFunc() }
-func (ar *mockAnchorService) DeleteAnchor(id int) error        { return ar.DeleteAnchorFunc(id) }
+func (ar *mockAnchorService) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	return ar.AddAnchorFunc(a)
+}
+func (ar *mockAnchorService) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	return ar.UpdateAnchorFunc(a)
+}
+func (ar *mockAnchorService) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	return ar.GetAnchorFunc(id)
+}
+func (ar *mockAnchorService) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return ar.GetAnchorsFunc()
+}
+func (ar *mockAnchorService) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	return ar.ListAnchorsFunc(after, limit)
+}
+func (ar *mockAnchorService) DeleteAnchor(ctx context.Context, id, version int) error {
+	return ar.DeleteAnchorFunc(id, version)
+}
+func (ar *mockAnchorService) Bulk(ctx context.Context, ops []BulkOperation, transaction bool) ([]BulkResult, error) {
+	return ar.BulkFunc(ops, transaction)
+}
+func (ar *mockAnchorService) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	return ar.ListTrashFunc()
+}
+func (ar *mockAnchorService) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	return ar.RestoreFunc(id)
+}
+func (ar *mockAnchorService) PurgeAnchor(ctx context.Context, id int) error {
+	return ar.PurgeAnchorFunc(id)
+}
+func (ar *mockAnchorService) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return ar.PurgeTrashFunc(before)
+}
+func (ar *mockAnchorService) ListRevisions(ctx context.Context, id int) ([]Revision, error) {
+	return ar.ListRevisionsFunc(id)
+}
+func (ar *mockAnchorService) GetRevision(ctx context.Context, id, number int) (Revision, error) {
+	return ar.GetRevisionFunc(id, number)
+}
+func (ar *mockAnchorService) DiffRevisions(ctx context.Context, id, from, to int) ([]FieldChange, error) {
+	return ar.DiffRevisionsFunc(id, from, to)
+}
+func (ar *mockAnchorService) RevertAnchor(ctx context.Context, id, number, version int) (Anchor, error) {
+	return ar.RevertAnchorFunc(id, number, version)
+}
 
 var anchorJSON = []byte(`{"id":1,"url":"https://example.com"}`)
 
@@ -101,6 +153,12 @@ func TestGetAnchorsHandler(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			responseBody:   anchorsJSON,
 		},
+		{
+			name:           "Get anchors timeout",
+			method:         func() ([]Anchor, error) { return nil, context.DeadlineExceeded },
+			expectedStatus: http.StatusGatewayTimeout,
+			responseBody:   []byte(`{"status":504,"message":"request timed out"}`),
+		},
 		{
 			name:           "Get anchors internal error",
 			method:         func() ([]Anchor, error) { return nil, errors.New("internal server error") },
@@ -127,6 +185,80 @@ func TestGetAnchorsHandler(t *testing.T) {
 	}
 }
 
+func TestGetAnchorsHandlerPage(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		link           string
+		responseBody   []byte
+	}{
+		{
+			name:           "Full page",
+			query:          "?after=1&limit=3",
+			expectedStatus: http.StatusOK,
+			link:           `</v1/anchors?after=4&limit=3>; rel="next"`,
+			responseBody:   anchorsJSON,
+		},
+		{
+			name:           "Last page",
+			query:          "?after=1",
+			expectedStatus: http.StatusOK,
+			responseBody:   anchorsJSON,
+		},
+		{
+			name:           "Bad after",
+			query:          "?after=x",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   []byte(`{"status":400,"message":"invalid after 'x'"}`),
+		},
+		{
+			name:           "Limit too large",
+			query:          "?limit=1001",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   []byte(`{"status":400,"message":"limit must be between 1 and 1000"}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockAnchorService{ListAnchorsFunc: func(after, limit int) ([]Anchor, error) {
+				assertEqual(t, 1, after)
+				return testAnchors, nil
+			}}
+			anchorHandler := NewAnchorHTTPHandler(s)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(anchorHandler.getAnchorsHandler)
+
+			req, err := http.NewRequest(http.MethodGet, "/v1/anchors"+tt.query, http.NoBody)
+			assertNoError(t, err)
+
+			handler.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.link, rr.Header().Get("Link"))
+			assertBytesEqual(t, tt.responseBody, rr.Body.Bytes())
+		})
+	}
+}
+
+func TestGetAnchorsHandlerCancelled(t *testing.T) {
+	s := &mockAnchorService{GetAnchorsFunc: func() ([]Anchor, error) { return nil, context.Canceled }}
+	anchorHandler := NewAnchorHTTPHandler(s)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(anchorHandler.getAnchorsHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/anchors", http.NoBody)
+	assertNoError(t, err)
+
+	handler.ServeHTTP(rr, req)
+
+	assertEqual(t, statusClientClosedRequest, rr.Code)
+}
+
 func TestGetAnchorHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -149,6 +281,13 @@ func TestGetAnchorHandler(t *testing.T) {
 			responseBody:   []byte(`{"status":500,"message":"internal server error"}`),
 			pathID:         "1",
 		},
+		{
+			name:           "Get anchor not found",
+			method:         func(id int) (Anchor, error) { return Anchor{}, ErrAnchorNotFound },
+			expectedStatus: http.StatusNotFound,
+			responseBody:   []byte(`{"status":404,"message":"anchor not found"}`),
+			pathID:         "1",
+		},
 		{
 			name:           "Get anchor bad id",
 			method:         func(id int) (Anchor, error) { return testAnchor, errors.New("internal server error") },
@@ -182,7 +321,7 @@ func TestUpdateAnchorHandler(t *testing.T) {
 		name           string
 		reqBody        []byte
 		contentType    string
-		method         func(a Anchor) error
+		method         func(a Anchor) (Anchor, error)
 		responseBody   []byte
 		expectedStatus int
 	}{
@@ -190,14 +329,14 @@ func TestUpdateAnchorHandler(t *testing.T) {
 			name:           "Update anchor ok",
 			reqBody:        anchorJSON,
 			contentType:    "application/json",
-			method:         func(a Anchor) error { return nil },
+			method:         func(a Anchor) (Anchor, error) { return a, nil },
 			expectedStatus: http.StatusNoContent,
 		},
 		{
 			name:           "Update anchor server error",
 			reqBody:        anchorJSON,
 			contentType:    "application/json",
-			method:         func(a Anchor) error { return errors.New("internal server error") },
+			method:         func(a Anchor) (Anchor, error) { return a, errors.New("internal server error") },
 			expectedStatus: http.StatusInternalServerError,
 			responseBody:   []byte(`{"status":500,"message":"internal server error"}`),
 		},
@@ -224,27 +363,27 @@ func TestUpdateAnchorHandler(t *testing.T) {
 func TestDeleteAnchorHandler(t *testing.T) {
 	tests := []struct {
 		name           string
-		method         func(id int) error
+		method         func(id, version int) error
 		expectedStatus int
 		responseBody   []byte
 		pathID         string
 	}{
 		{
 			name:           "Delete anchor ok",
-			method:         func(id int) error { return nil },
+			method:         func(id, version int) error { return nil },
 			expectedStatus: http.StatusNoContent,
 			pathID:         "1",
 		},
 		{
 			name:           "Delete anchor server error",
-			method:         func(id int) error { return errors.New("internal server error") },
+			method:         func(id, version int) error { return errors.New("internal server error") },
 			expectedStatus: http.StatusInternalServerError,
 			pathID:         "1",
 			responseBody:   []byte(`{"status":500,"message":"internal server error"}`),
 		},
 		{
 			name:           "Delete anchor bad id",
-			method:         func(id int) error { return nil },
+			method:         func(id, version int) error { return nil },
 			expectedStatus: http.StatusBadRequest,
 			pathID:         "abc",
 			responseBody:   []byte(`{"status":400,"message":"invalid anchor id 'abc'"}`),
@@ -269,3 +408,362 @@ func TestDeleteAnchorHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestAnchorHTTPHandlerConditional(t *testing.T) {
+	router := NewRouter("/v1")
+	h := NewAnchorHTTPHandler(NewAnchorService(NewAnchorMemoryRepository()))
+	h.RegisterRoutes(router)
+
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assertNoError(t, err)
+		req.Header = header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/v1/anchor", `{"url":"https://example.com"}`, http.Header{})
+	assertEqual(t, http.StatusCreated, rr.Code)
+	assertEqual(t, `"1"`, rr.Header().Get("ETag"))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		header         http.Header
+		expectedStatus int
+		expectedETag   string
+	}{
+		{"Get", http.MethodGet, "/v1/anchor/1", "", http.Header{}, http.StatusOK, `"1"`},
+		{"Get not modified", http.MethodGet, "/v1/anchor/1", "", http.Header{"If-None-Match": {`"0", W/"1"`}}, http.StatusNotModified, `"1"`},
+		{"Get changed", http.MethodGet, "/v1/anchor/1", "", http.Header{"If-None-Match": {`"0"`}}, http.StatusOK, `"1"`},
+		{"Update weak tag", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/a"}`, http.Header{"If-Match": {`W/"1"`}}, http.StatusPreconditionFailed, ""},
+		{"Update stale", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/a"}`, http.Header{"If-Match": {`"2"`}}, http.StatusPreconditionFailed, ""},
+		{"Update", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/a"}`, http.Header{"If-Match": {`"1"`}}, http.StatusNoContent, `"2"`},
+		{"Update body version stale", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/b","version":1}`, http.Header{}, http.StatusPreconditionFailed, ""},
+		{"Update one of several", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/b"}`, http.Header{"If-Match": {`"1", "2"`}}, http.StatusNoContent, `"3"`},
+		{"Update any", http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/c","version":1}`, http.Header{"If-Match": {"*"}}, http.StatusNoContent, `"4"`},
+		{"Update missing", http.MethodPut, "/v1/anchor", `{"id":2,"url":"https://example.com"}`, http.Header{"If-Match": {"*"}}, http.StatusPreconditionFailed, ""},
+		{"Delete stale", http.MethodDelete, "/v1/anchor/1", "", http.Header{"If-Match": {`"3"`}}, http.StatusPreconditionFailed, ""},
+		{"Delete", http.MethodDelete, "/v1/anchor/1", "", http.Header{"If-Match": {`"4"`}}, http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.path, tt.body, tt.header)
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.expectedETag, rr.Header().Get("ETag"))
+
+			if rr.Code == http.StatusNotModified {
+				assertEqual(t, 0, rr.Body.Len())
+			}
+		})
+	}
+
+	// Listings get an ETag from their content.
+	rr = do(http.MethodGet, "/v1/anchors", "", http.Header{})
+	assertEqual(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+
+	rr = do(http.MethodGet, "/v1/anchors", "", http.Header{"If-None-Match": {etag}})
+	assertEqual(t, http.StatusNotModified, rr.Code)
+
+	do(http.MethodPost, "/v1/anchor", `{"url":"https://example.com"}`, http.Header{})
+
+	rr = do(http.MethodGet, "/v1/anchors", "", http.Header{"If-None-Match": {etag}})
+	assertEqual(t, http.StatusOK, rr.Code)
+
+	h.RequireIfMatch(true)
+
+	rr = do(http.MethodDelete, "/v1/anchor/2", "", http.Header{})
+	assertEqual(t, http.StatusPreconditionRequired, rr.Code)
+
+	rr = do(http.MethodPut, "/v1/anchor", `{"id":2,"url":"https://example.com/a","version":1}`, http.Header{})
+	assertEqual(t, http.StatusPreconditionRequired, rr.Code)
+
+	rr = do(http.MethodDelete, "/v1/anchor/2", "", http.Header{"If-Match": {"*"}})
+	assertEqual(t, http.StatusNoContent, rr.Code)
+}
+
+func TestPatchAnchorHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		header         http.Header
+		expectedStatus int
+		responseBody   string
+	}{
+		{"Merge patch", "application/merge-patch+json", `{"url":"https://example.com/a"}`, http.Header{}, http.StatusOK, `{"id":1,"url":"https://example.com/a","version":2}`},
+		{"Merge patch with charset", "application/merge-patch+json; charset=utf-8", `{}`, http.Header{}, http.StatusOK, `{"id":1,"url":"https://example.com","version":2}`},
+		{"JSON patch", "application/json-patch+json", `[{"op":"test","path":"/url","value":"https://example.com"},{"op":"replace","path":"/url","value":"https://example.com/b"}]`, http.Header{}, http.StatusOK, `{"id":1,"url":"https://example.com/b","version":2}`},
+		{"JSON patch test failed", "application/json-patch+json", `[{"op":"test","path":"/url","value":"https://example.com/x"}]`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"operation 0: test failed at \"/url\""}`},
+		{"Remove url", "application/merge-patch+json", `{"url":null}`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"url must not be empty"}`},
+		{"Change id", "application/json-patch+json", `[{"op":"replace","path":"/id","value":2}]`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"id cannot be changed"}`},
+		{"Change version", "application/merge-patch+json", `{"version":5}`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"version cannot be changed"}`},
+		{"Unknown field", "application/merge-patch+json", `{"title":"Example"}`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"patched anchor is invalid: unknown field \"title\""}`},
+		{"Wrong type", "application/merge-patch+json", `{"url":42}`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"patched anchor has incorrect JSON type field \"url\""}`},
+		{"Not an object", "application/merge-patch+json", `["https://example.com"]`, http.Header{}, http.StatusUnprocessableEntity, `{"status":422,"message":"patched anchor must be a JSON object"}`},
+		{"Bad JSON", "application/merge-patch+json", `{"url":`, http.Header{}, http.StatusBadRequest, `{"status":400,"message":"body contains badly-formed JSON"}`},
+		{"Bad JSON patch", "application/json-patch+json", `[{"op":"frobnicate","path":"/url"}]`, http.Header{}, http.StatusBadRequest, `{"status":400,"message":"operation 0: unknown op \"frobnicate\""}`},
+		{"Empty body", "application/merge-patch+json", ``, http.Header{}, http.StatusBadRequest, `{"status":400,"message":"body must not be empty"}`},
+		{"Body too large", "application/merge-patch+json", `{"url":"` + strings.Repeat("a", maxBodyBytes) + `"}`, http.Header{}, http.StatusRequestEntityTooLarge, `{"status":413,"message":"body must not be larger than 1048576 bytes"}`},
+		{"Plain JSON", "application/json", `{"url":"https://example.com/a"}`, http.Header{}, http.StatusUnsupportedMediaType, `{"status":415,"message":"expected 'application/merge-patch+json' or 'application/json-patch+json' Content-Type, got 'application/json'"}`},
+		{"If-Match", "application/merge-patch+json", `{"url":"https://example.com/a"}`, http.Header{"If-Match": {`"1"`}}, http.StatusOK, `{"id":1,"url":"https://example.com/a","version":2}`},
+		{"If-Match stale", "application/merge-patch+json", `{"url":"https://example.com/a"}`, http.Header{"If-Match": {`"2"`}}, http.StatusPreconditionFailed, `{"status":412,"message":"anchor has been modified"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter("/v1")
+			NewAnchorHTTPHandler(NewAnchorService(NewAnchorMemoryRepository())).RegisterRoutes(router)
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/anchor", strings.NewReader(`{"url":"https://example.com"}`))
+			assertNoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			req, err = http.NewRequest(http.MethodPatch, "/v1/anchor/1", strings.NewReader(tt.body))
+			assertNoError(t, err)
+			req.Header = tt.header
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+			assertEqual(t, "application/merge-patch+json, application/json-patch+json", rr.Header().Get("Accept-Patch"))
+		})
+	}
+}
+
+func TestPatchAnchorHandlerConflict(t *testing.T) {
+	s := &mockAnchorService{
+		GetAnchorFunc: func(id int) (Anchor, error) {
+			return Anchor{ID: id, URL: "https://example.com", Version: 1}, nil
+		},
+		UpdateAnchorFunc: func(a Anchor) (Anchor, error) {
+			assertEqual(t, 1, a.Version)
+			return a, ErrAnchorVersionMismatch
+		},
+	}
+	anchorHandler := NewAnchorHTTPHandler(s)
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodPatch, "/anchor/1", strings.NewReader(`{"url":"https://example.com/a"}`))
+	assertNoError(t, err)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	ctx := context.WithValue(req.Context(), ctxKey{}, []string{"1"})
+
+	anchorHandler.patchAnchorHandler(rr, req.WithContext(ctx))
+
+	assertEqual(t, http.StatusConflict, rr.Code)
+}
+
+func TestBulkAnchorsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "Transaction",
+			body:           `{"operations":[{"op":"create","url":"https://example.com/a"},{"op":"update","id":1,"url":"https://example.com/b","version":1},{"op":"delete","id":1}]}`,
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"results":[{"status":201,"id":2,"version":1},{"status":200,"id":1,"version":2},{"status":204,"id":1}]}`,
+		},
+		{
+			name:           "Transaction rolled back",
+			body:           `{"mode":"transaction","operations":[{"op":"create","url":"https://example.com/a"},{"op":"delete","id":9}]}`,
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"results":[{"status":424,"error":"not applied: another operation in the transaction failed"},{"status":404,"id":9,"error":"anchor not found"}]}`,
+		},
+		{
+			name:           "Best effort",
+			body:           `{"mode":"best-effort","operations":[{"op":"update","id":1,"url":"https://example.com/b","version":3},{"op":"tag","id":1},{"op":"create","url":"https://example.com/a"}]}`,
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"results":[{"status":412,"id":1,"error":"anchor has been modified"},{"status":400,"id":1,"error":"unknown op \"tag\""},{"status":201,"id":2,"version":1}]}`,
+		},
+		{
+			name:           "Unknown mode",
+			body:           `{"mode":"yolo","operations":[{"op":"delete","id":1}]}`,
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"mode must be 'transaction' or 'best-effort', got 'yolo'"}`,
+		},
+		{
+			name:           "No operations",
+			body:           `{"operations":[]}`,
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"operations must not be empty"}`,
+		},
+		{
+			name:           "Too many operations",
+			body:           `{"operations":[{"op":"delete","id":1},{"op":"delete","id":2},{"op":"delete","id":3},{"op":"delete","id":4}]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			responseBody:   `{"status":413,"message":"at most 3 operations are allowed per request"}`,
+		},
+		{
+			name:           "Body too large",
+			body:           `{"operations":[{"op":"create","url":"https://example.com/` + strings.Repeat("a", 256) + `"}]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			responseBody:   `{"status":413,"message":"body must not be larger than 256 bytes"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			_, err := store.Anchors.AddAnchor(context.Background(), testAnchor)
+			assertNoError(t, err)
+
+			router := NewRouter("/v1")
+			h := NewAnchorHTTPHandler(NewAnchorServiceWithRepositories(store.Repositories()))
+			h.SetBulkLimits(3, 256)
+			h.RegisterRoutes(router)
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/anchors/bulk", strings.NewReader(tt.body))
+			assertNoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestBulkAnchorsHandlerNoTx(t *testing.T) {
+	h := NewAnchorHTTPHandler(NewAnchorService(NewAnchorMemoryRepository()))
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodPost, "/anchors/bulk", strings.NewReader(`{"operations":[{"op":"create","url":"https://example.com"}]}`))
+	assertNoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	h.bulkAnchorsHandler(rr, req)
+
+	assertEqual(t, http.StatusNotImplemented, rr.Code)
+}
+
+func TestTrashHandlers(t *testing.T) {
+	repo := NewAnchorMemoryRepository()
+	repo.now = func() time.Time { return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		_, err := repo.AddAnchor(context.Background(), Anchor{URL: url})
+		assertNoError(t, err)
+	}
+
+	assertNoError(t, repo.DeleteAnchor(context.Background(), 1, 0))
+	assertNoError(t, repo.DeleteAnchor(context.Background(), 2, 0))
+
+	router := NewRouter("/v1")
+	handler := NewAnchorHTTPHandler(NewAnchorService(repo))
+	handler.SetAdminToken("s3cret")
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "List",
+			method:         http.MethodGet,
+			path:           "/v1/trash",
+			expectedStatus: http.StatusOK,
+			responseBody:   `[{"id":2,"url":"https://example.com/b","version":1,"deleted_at":"2021-06-01T12:00:00Z"},{"id":1,"url":"https://example.com/a","version":1,"deleted_at":"2021-06-01T12:00:00Z"}]`,
+		},
+		{
+			name:           "Restore",
+			method:         http.MethodPost,
+			path:           "/v1/trash/1/restore",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"id":1,"url":"https://example.com/a","version":2}`,
+		},
+		{
+			name:           "Restore not in trash",
+			method:         http.MethodPost,
+			path:           "/v1/trash/1/restore",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"anchor not found"}`,
+		},
+		{
+			name:           "Restore bad id",
+			method:         http.MethodPost,
+			path:           "/v1/trash/a/restore",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid anchor id 'a'"}`,
+		},
+		{
+			name:           "Purge",
+			method:         http.MethodDelete,
+			path:           "/v1/trash/2",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Purge not in trash",
+			method:         http.MethodDelete,
+			path:           "/v1/trash/2",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"anchor not found"}`,
+		},
+		{
+			name:           "Empty without token",
+			method:         http.MethodDelete,
+			path:           "/v1/trash",
+			expectedStatus: http.StatusUnauthorized,
+			responseBody:   `{"status":401,"message":"admin token required"}`,
+		},
+		{
+			name:           "Empty",
+			method:         http.MethodDelete,
+			path:           "/v1/trash",
+			token:          "s3cret",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"purged":0}`,
+		},
+		{
+			name:           "List empty",
+			method:         http.MethodGet,
+			path:           "/v1/trash",
+			expectedStatus: http.StatusOK,
+			responseBody:   `[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			assertNoError(t, err)
+
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+
+	anchor, err := repo.GetAnchor(context.Background(), 1)
+	assertNoError(t, err)
+	assertEqual(t, 2, anchor.Version)
+}
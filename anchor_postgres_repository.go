@@ -0,0 +1,415 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type anchorPostgresStatements struct {
+	add         *sql.Stmt
+	update      *sql.Stmt
+	get         *sql.Stmt
+	list        *sql.Stmt
+	page        *sql.Stmt
+	delete      *sql.Stmt
+	count       *sql.Stmt
+	trash       *sql.Stmt
+	restore     *sql.Stmt
+	purge       *sql.Stmt
+	purgeBefore *sql.Stmt
+
+	addRevision   *sql.Stmt
+	listRevisions *sql.Stmt
+	getRevision   *sql.Stmt
+
+	addEvent    *sql.Stmt
+	listEvents  *sql.Stmt
+	lastEventID *sql.Stmt
+	pruneEvents *sql.Stmt
+}
+
+func prepareAnchorPostgresStatements(ctx context.Context, db *sql.DB) (anchorPostgresStatements, error) {
+	var s anchorPostgresStatements
+
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.add, "INSERT INTO anchors (url) VALUES ($1) RETURNING id"},
+		{&s.update, "UPDATE anchors SET url=$1, version=version+1 WHERE id=$2 AND deleted_at IS NULL AND ($3=0 OR version=$3) RETURNING version"},
+		{&s.get, "SELECT id, url, version FROM anchors WHERE id=$1 AND deleted_at IS NULL"},
+		{&s.list, "SELECT id, url, version FROM anchors WHERE deleted_at IS NULL ORDER BY id"},
+		{&s.page, "SELECT id, url, version FROM anchors WHERE id > $1 AND deleted_at IS NULL ORDER BY id LIMIT $2"},
+		{&s.delete, "UPDATE anchors SET deleted_at=$1 WHERE id=$2 AND deleted_at IS NULL AND ($3=0 OR version=$3)"},
+		{&s.count, "SELECT COUNT(*) FROM anchors WHERE deleted_at IS NULL"},
+		{&s.trash, "SELECT id, url, version, deleted_at FROM anchors WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC"},
+		{&s.restore, "UPDATE anchors SET deleted_at=NULL, version=version+1 WHERE id=$1 AND deleted_at IS NOT NULL RETURNING id, url, version"},
+		{&s.purge, "DELETE FROM anchors WHERE id=$1 AND deleted_at IS NOT NULL"},
+		{&s.purgeBefore, "DELETE FROM anchors WHERE deleted_at < $1"},
+		// Revisions are added after updating the anchor in the same
+		// transaction, whose row lock keeps their numbers apart.
+		{&s.addRevision, "INSERT INTO anchor_revisions (anchor_id, revision, actor, created_at, url, version, changes) " +
+			"SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6 FROM anchor_revisions WHERE anchor_id=$1 RETURNING revision"},
+		{&s.listRevisions, "SELECT anchor_id, revision, actor, created_at, url, version, changes FROM anchor_revisions WHERE anchor_id=$1 ORDER BY revision"},
+		{&s.getRevision, "SELECT anchor_id, revision, actor, created_at, url, version, changes FROM anchor_revisions WHERE anchor_id=$1 AND revision=$2"},
+		// Taking the next ID locks the row it is kept in until the
+		// transaction ends, so events commit in ID order.
+		{&s.addEvent, "WITH next AS (UPDATE anchor_event_ids SET last_id=last_id+1 RETURNING last_id) " +
+			"INSERT INTO anchor_events (id, type, created_at, actor, anchor_id, url, version) " +
+			"SELECT last_id, $1, $2, $3, $4, $5, $6 FROM next RETURNING id"},
+		{&s.listEvents, "SELECT id, type, created_at, actor, anchor_id, url, version FROM anchor_events WHERE id > $1 ORDER BY id LIMIT $2"},
+		{&s.lastEventID, "SELECT last_id FROM anchor_event_ids"},
+		{&s.pruneEvents, "DELETE FROM anchor_events WHERE id <= $1"},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.PrepareContext(ctx, q.query)
+		if err != nil {
+			s.close()
+			return s, err
+		}
+
+		*q.stmt = stmt
+	}
+
+	return s, nil
+}
+
+func (s anchorPostgresStatements) inTx(ctx context.Context, tx *sql.Tx) anchorPostgresStatements {
+	return anchorPostgresStatements{
+		add:         tx.StmtContext(ctx, s.add),
+		update:      tx.StmtContext(ctx, s.update),
+		get:         tx.StmtContext(ctx, s.get),
+		list:        tx.StmtContext(ctx, s.list),
+		page:        tx.StmtContext(ctx, s.page),
+		delete:      tx.StmtContext(ctx, s.delete),
+		count:       tx.StmtContext(ctx, s.count),
+		trash:       tx.StmtContext(ctx, s.trash),
+		restore:     tx.StmtContext(ctx, s.restore),
+		purge:       tx.StmtContext(ctx, s.purge),
+		purgeBefore: tx.StmtContext(ctx, s.purgeBefore),
+
+		addRevision:   tx.StmtContext(ctx, s.addRevision),
+		listRevisions: tx.StmtContext(ctx, s.listRevisions),
+		getRevision:   tx.StmtContext(ctx, s.getRevision),
+
+		addEvent:    tx.StmtContext(ctx, s.addEvent),
+		listEvents:  tx.StmtContext(ctx, s.listEvents),
+		lastEventID: tx.StmtContext(ctx, s.lastEventID),
+		pruneEvents: tx.StmtContext(ctx, s.pruneEvents),
+	}
+}
+
+func (s anchorPostgresStatements) close() error {
+	var firstErr error
+
+	stmts := []*sql.Stmt{
+		s.add, s.update, s.get, s.list, s.page, s.delete, s.count, s.trash, s.restore, s.purge, s.purgeBefore,
+		s.addRevision, s.listRevisions, s.getRevision,
+		s.addEvent, s.listEvents, s.lastEventID, s.pruneEvents,
+	}
+
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// AnchorPostgresRepository is the PostgreSQL implementation of
+// anchorRepository. Close it before closing the database.
+type AnchorPostgresRepository struct {
+	stmts anchorPostgresStatements
+	now   func() time.Time
+}
+
+func NewAnchorPostgresRepository(ctx context.Context, db *sql.DB) (*AnchorPostgresRepository, error) {
+	stmts, err := prepareAnchorPostgresStatements(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AnchorPostgresRepository{
+		stmts: stmts,
+		now:   time.Now,
+	}, nil
+}
+
+// Close closes the prepared statements.
+func (r *AnchorPostgresRepository) Close() error {
+	return r.stmts.close()
+}
+
+// inTx returns a copy of r whose queries go through tx.
+func (r *AnchorPostgresRepository) inTx(ctx context.Context, tx *sql.Tx) *AnchorPostgresRepository {
+	return &AnchorPostgresRepository{
+		stmts: r.stmts.inTx(ctx, tx),
+		now:   r.now,
+	}
+}
+
+func (r *AnchorPostgresRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	var id int
+
+	err := r.stmts.add.QueryRowContext(ctx, a.URL).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *AnchorPostgresRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	err := r.stmts.update.QueryRowContext(ctx, a.URL, a.ID, a.Version).Scan(&a.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, anchorConflict(ctx, r, a.ID)
+	}
+
+	if err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+func (r *AnchorPostgresRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	anchor := Anchor{}
+
+	err := r.stmts.get.QueryRowContext(ctx, id).Scan(&anchor.ID, &anchor.URL, &anchor.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return anchor, ErrAnchorNotFound
+	}
+
+	if err != nil {
+		return anchor, err
+	}
+
+	return anchor, nil
+}
+
+func (r *AnchorPostgresRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return scanAnchors(r.stmts.list.QueryContext(ctx))
+}
+
+func (r *AnchorPostgresRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	// LIMIT NULL means no limit.
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	return scanAnchors(r.stmts.page.QueryContext(ctx, after, limitArg))
+}
+
+func (r *AnchorPostgresRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	res, err := r.stmts.delete.ExecContext(ctx, r.now(), id, version)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return anchorConflict(ctx, r, id)
+	}
+
+	return nil
+}
+
+func (r *AnchorPostgresRepository) CountAnchors(ctx context.Context) (int, error) {
+	var count int
+
+	err := r.stmts.count.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *AnchorPostgresRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	rows, err := r.stmts.trash.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := []TrashedAnchor{}
+
+	for rows.Next() {
+		var anchor TrashedAnchor
+		if err := rows.Scan(&anchor.ID, &anchor.URL, &anchor.Version, &anchor.DeletedAt); err != nil {
+			return nil, err
+		}
+
+		anchors = append(anchors, anchor)
+	}
+
+	return anchors, rows.Err()
+}
+
+func (r *AnchorPostgresRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	var anchor Anchor
+
+	err := r.stmts.restore.QueryRowContext(ctx, id).Scan(&anchor.ID, &anchor.URL, &anchor.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return anchor, ErrAnchorNotFound
+	}
+
+	return anchor, err
+}
+
+func (r *AnchorPostgresRepository) PurgeAnchor(ctx context.Context, id int) error {
+	res, err := r.stmts.purge.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrAnchorNotFound
+	}
+
+	return nil
+}
+
+func (r *AnchorPostgresRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.stmts.purgeBefore.ExecContext(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
+
+func (r *AnchorPostgresRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return rev, err
+	}
+
+	// Postgres keeps microseconds.
+	rev.CreatedAt = r.now().UTC().Truncate(time.Microsecond)
+
+	err = r.stmts.addRevision.QueryRowContext(ctx, rev.AnchorID, rev.Actor, rev.CreatedAt,
+		rev.Anchor.URL, rev.Anchor.Version, changes).Scan(&rev.Number)
+
+	return rev, err
+}
+
+func (r *AnchorPostgresRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	rows, err := r.stmts.listRevisions.QueryContext(ctx, anchorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+
+	for rows.Next() {
+		rev, err := scanPostgresRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (r *AnchorPostgresRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	rev, err := scanPostgresRevision(r.stmts.getRevision.QueryRowContext(ctx, anchorID, number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rev, ErrRevisionNotFound
+	}
+
+	return rev, err
+}
+
+func (r *AnchorPostgresRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	// Postgres keeps microseconds.
+	e.Time = e.Time.UTC().Truncate(time.Microsecond)
+	logged := LoggedEvent{AnchorEvent: e}
+
+	err := r.stmts.addEvent.QueryRowContext(ctx, e.Type, e.Time, e.Actor, e.Anchor.ID, e.Anchor.URL, e.Anchor.Version).Scan(&logged.ID)
+
+	return logged, err
+}
+
+func (r *AnchorPostgresRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := r.stmts.listEvents.QueryContext(ctx, after, limitArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []LoggedEvent{}
+
+	for rows.Next() {
+		var e LoggedEvent
+
+		err := rows.Scan(&e.ID, &e.Type, &e.Time, &e.Actor, &e.Anchor.ID, &e.Anchor.URL, &e.Anchor.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Time = e.Time.UTC()
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *AnchorPostgresRepository) LastEventID(ctx context.Context) (int, error) {
+	var id int
+
+	err := r.stmts.lastEventID.QueryRowContext(ctx).Scan(&id)
+
+	return id, err
+}
+
+func (r *AnchorPostgresRepository) PruneEvents(ctx context.Context, upTo int) error {
+	_, err := r.stmts.pruneEvents.ExecContext(ctx, upTo)
+	return err
+}
+
+func scanPostgresRevision(row rowScanner) (Revision, error) {
+	var (
+		rev     Revision
+		changes []byte
+	)
+
+	err := row.Scan(&rev.AnchorID, &rev.Number, &rev.Actor, &rev.CreatedAt, &rev.Anchor.URL, &rev.Anchor.Version, &changes)
+	if err != nil {
+		return rev, err
+	}
+
+	rev.Anchor.ID = rev.AnchorID
+	rev.CreatedAt = rev.CreatedAt.UTC()
+
+	return rev, json.Unmarshal(changes, &rev.Changes)
+}
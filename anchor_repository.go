@@ -1,24 +1,188 @@
 package junkboy
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
 
+type anchorSQLiteStatements struct {
+	add         *sql.Stmt
+	update      *sql.Stmt
+	get         *sql.Stmt
+	list        *sql.Stmt
+	page        *sql.Stmt
+	delete      *sql.Stmt
+	count       *sql.Stmt
+	trash       *sql.Stmt
+	restore     *sql.Stmt
+	purge       *sql.Stmt
+	purgeBefore *sql.Stmt
+
+	addRevision   *sql.Stmt
+	listRevisions *sql.Stmt
+	getRevision   *sql.Stmt
+
+	addEvent    *sql.Stmt
+	listEvents  *sql.Stmt
+	lastEventID *sql.Stmt
+	pruneEvents *sql.Stmt
+}
+
+func prepareAnchorSQLiteStatements(ctx context.Context, db *sql.DB) (anchorSQLiteStatements, error) {
+	var s anchorSQLiteStatements
+
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.add, "INSERT INTO anchors (url) VALUES (?)"},
+		{&s.update, "UPDATE anchors SET url=?, version=version+1 WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?) RETURNING version"},
+		{&s.get, "SELECT id, url, version FROM anchors WHERE id=? AND deleted_at IS NULL"},
+		{&s.list, "SELECT id, url, version FROM anchors WHERE deleted_at IS NULL ORDER BY id"},
+		{&s.page, "SELECT id, url, version FROM anchors WHERE id > ? AND deleted_at IS NULL ORDER BY id LIMIT ?"},
+		{&s.delete, "UPDATE anchors SET deleted_at=? WHERE id=? AND deleted_at IS NULL AND (?=0 OR version=?)"},
+		{&s.count, "SELECT COUNT(*) FROM anchors WHERE deleted_at IS NULL"},
+		{&s.trash, "SELECT id, url, version, deleted_at FROM anchors WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC"},
+		{&s.restore, "UPDATE anchors SET deleted_at=NULL, version=version+1 WHERE id=? AND deleted_at IS NOT NULL RETURNING id, url, version"},
+		{&s.purge, "DELETE FROM anchors WHERE id=? AND deleted_at IS NOT NULL"},
+		{&s.purgeBefore, "DELETE FROM anchors WHERE deleted_at < ?"},
+		{&s.addRevision, "INSERT INTO anchor_revisions (anchor_id, revision, actor, created_at, url, version, changes) " +
+			"SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ? FROM anchor_revisions WHERE anchor_id=? RETURNING revision"},
+		{&s.listRevisions, "SELECT anchor_id, revision, actor, created_at, url, version, changes FROM anchor_revisions WHERE anchor_id=? ORDER BY revision"},
+		{&s.getRevision, "SELECT anchor_id, revision, actor, created_at, url, version, changes FROM anchor_revisions WHERE anchor_id=? AND revision=?"},
+		{&s.addEvent, "INSERT INTO anchor_events (type, created_at, actor, anchor_id, url, version) VALUES (?, ?, ?, ?, ?, ?)"},
+		{&s.listEvents, "SELECT id, type, created_at, actor, anchor_id, url, version FROM anchor_events WHERE id > ? ORDER BY id LIMIT ?"},
+		// The sequence outlives pruned events.
+		{&s.lastEventID, "SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name='anchor_events'), 0)"},
+		{&s.pruneEvents, "DELETE FROM anchor_events WHERE id <= ?"},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.PrepareContext(ctx, q.query)
+		if err != nil {
+			s.close()
+			return s, err
+		}
+
+		*q.stmt = stmt
+	}
+
+	return s, nil
+}
+
+func (s anchorSQLiteStatements) all() []*sql.Stmt {
+	return []*sql.Stmt{
+		s.add, s.update, s.get, s.list, s.page, s.delete, s.count, s.trash, s.restore, s.purge, s.purgeBefore,
+		s.addRevision, s.listRevisions, s.getRevision,
+		s.addEvent, s.listEvents, s.lastEventID, s.pruneEvents,
+	}
+}
+
+// inTx returns the statements bound to tx, which must belong to the
+// database s was prepared on.
+func (s anchorSQLiteStatements) inTx(ctx context.Context, tx *sql.Tx) anchorSQLiteStatements {
+	return anchorSQLiteStatements{
+		add:         tx.StmtContext(ctx, s.add),
+		update:      tx.StmtContext(ctx, s.update),
+		get:         tx.StmtContext(ctx, s.get),
+		list:        tx.StmtContext(ctx, s.list),
+		page:        tx.StmtContext(ctx, s.page),
+		delete:      tx.StmtContext(ctx, s.delete),
+		count:       tx.StmtContext(ctx, s.count),
+		trash:       tx.StmtContext(ctx, s.trash),
+		restore:     tx.StmtContext(ctx, s.restore),
+		purge:       tx.StmtContext(ctx, s.purge),
+		purgeBefore: tx.StmtContext(ctx, s.purgeBefore),
+
+		addRevision:   tx.StmtContext(ctx, s.addRevision),
+		listRevisions: tx.StmtContext(ctx, s.listRevisions),
+		getRevision:   tx.StmtContext(ctx, s.getRevision),
+
+		addEvent:    tx.StmtContext(ctx, s.addEvent),
+		listEvents:  tx.StmtContext(ctx, s.listEvents),
+		lastEventID: tx.StmtContext(ctx, s.lastEventID),
+		pruneEvents: tx.StmtContext(ctx, s.pruneEvents),
+	}
+}
+
+func (s anchorSQLiteStatements) close() error {
+	var firstErr error
+
+	for _, stmt := range s.all() {
+		if stmt == nil {
+			continue
+		}
+
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// AnchorSQLiteRepository prepares its statements once on each pool, writes
+// on the write pool and reads on the read pool. Inside a transaction both
+// go through the transaction. Close it before closing the database.
 type AnchorSQLiteRepository struct {
-	db *sql.DB
+	db  *SQLiteDB
+	now func() time.Time
+
+	reads  anchorSQLiteStatements
+	writes anchorSQLiteStatements
 }
 
-func NewAnchorSQLiteRepository(db *sql.DB) *AnchorSQLiteRepository {
+func NewAnchorSQLiteRepository(ctx context.Context, db *SQLiteDB) (*AnchorSQLiteRepository, error) {
+	reads, err := prepareAnchorSQLiteStatements(ctx, db.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read statements are also prepared on the write pool, where
+	// transactions run.
+	writes, err := prepareAnchorSQLiteStatements(ctx, db.Write)
+	if err != nil {
+		reads.close()
+		return nil, err
+	}
+
 	return &AnchorSQLiteRepository{
-		db: db,
+		db:     db,
+		now:    time.Now,
+		reads:  reads,
+		writes: writes,
+	}, nil
+}
+
+// Close closes the prepared statements.
+func (r *AnchorSQLiteRepository) Close() error {
+	err := r.reads.close()
+
+	if writeErr := r.writes.close(); err == nil {
+		err = writeErr
 	}
+
+	return err
 }
 
-func (r *AnchorSQLiteRepository) AddAnchor(a Anchor) (int, error) {
-	stmt, err := r.db.Prepare("INSERT INTO anchors (url) VALUES (?)")
-	if err != nil {
-		return 0, err
+// inTx returns a copy of r whose queries go through tx. Its statements are
+// closed with the transaction.
+func (r *AnchorSQLiteRepository) inTx(ctx context.Context, tx *sql.Tx) *AnchorSQLiteRepository {
+	stmts := r.writes.inTx(ctx, tx)
+
+	return &AnchorSQLiteRepository{
+		db:     r.db,
+		now:    r.now,
+		reads:  stmts,
+		writes: stmts,
 	}
+}
 
-	res, err := stmt.Exec(a.URL)
+func (r *AnchorSQLiteRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	res, err := r.writes.add.ExecContext(ctx, a.URL)
 	if err != nil {
 		return 0, err
 	}
@@ -31,76 +195,318 @@ func (r *AnchorSQLiteRepository) AddAnchor(a Anchor) (int, error) {
 	return int(id), nil
 }
 
-func (r *AnchorSQLiteRepository) UpdateAnchor(a Anchor) error {
-	stmt, err := r.db.Prepare("UPDATE anchors SET url=? WHERE id=?")
+func (r *AnchorSQLiteRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	err := r.writes.update.QueryRowContext(ctx, a.URL, a.ID, a.Version, a.Version).Scan(&a.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, anchorConflict(ctx, r, a.ID)
+	}
+
 	if err != nil {
-		return err
+		return a, err
+	}
+
+	return a, nil
+}
+
+func (r *AnchorSQLiteRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	row := r.reads.get.QueryRowContext(ctx, id)
+
+	anchor := Anchor{}
+	err := row.Scan(&anchor.ID, &anchor.URL, &anchor.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return anchor, ErrAnchorNotFound
 	}
 
-	res, err := stmt.Exec(a.URL, a.ID)
+	if err != nil {
+		return anchor, err
+	}
+
+	return anchor, err
+}
+
+func (r *AnchorSQLiteRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return scanAnchors(r.reads.list.QueryContext(ctx))
+}
+
+func (r *AnchorSQLiteRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	if limit <= 0 {
+		// A negative LIMIT means no limit in SQLite.
+		limit = -1
+	}
+
+	return scanAnchors(r.reads.page.QueryContext(ctx, after, limit))
+}
+
+func (r *AnchorSQLiteRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	res, err := r.writes.delete.ExecContext(ctx, sqliteTime(r.now()), id, version, version)
 	if err != nil {
 		return err
 	}
 
-	_, err = res.RowsAffected()
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if n == 0 {
+		return anchorConflict(ctx, r, id)
+	}
+
 	return nil
 }
 
-func (r *AnchorSQLiteRepository) GetAnchor(id int) (Anchor, error) {
-	row := r.db.QueryRow("SELECT id, url FROM anchors WHERE id=?", id)
-
-	anchor := Anchor{}
-	err := row.Scan(&anchor.ID, &anchor.URL)
+func (r *AnchorSQLiteRepository) CountAnchors(ctx context.Context) (int, error) {
+	var count int
 
+	err := r.reads.count.QueryRowContext(ctx).Scan(&count)
 	if err != nil {
-		return anchor, err
+		return 0, err
 	}
 
-	return anchor, err
+	return count, nil
 }
 
-func (r *AnchorSQLiteRepository) GetAnchors() ([]Anchor, error) {
-	rows, err := r.db.Query("SELECT * FROM anchors")
+func (r *AnchorSQLiteRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	rows, err := r.reads.trash.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	anchors := []Anchor{}
+	anchors := []TrashedAnchor{}
 
 	for rows.Next() {
-		anchor := Anchor{}
-		err = rows.Scan(&anchor.ID, &anchor.URL)
+		var (
+			anchor    TrashedAnchor
+			deletedAt string
+		)
 
-		if err != nil {
+		if err := rows.Scan(&anchor.ID, &anchor.URL, &anchor.Version, &deletedAt); err != nil {
+			return nil, err
+		}
+
+		if anchor.DeletedAt, err = time.Parse(sqliteTimeLayout, deletedAt); err != nil {
 			return nil, err
 		}
 
 		anchors = append(anchors, anchor)
 	}
 
-	return anchors, nil
+	return anchors, rows.Err()
+}
+
+func (r *AnchorSQLiteRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	var anchor Anchor
+
+	err := r.writes.restore.QueryRowContext(ctx, id).Scan(&anchor.ID, &anchor.URL, &anchor.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return anchor, ErrAnchorNotFound
+	}
+
+	return anchor, err
 }
 
-func (r *AnchorSQLiteRepository) DeleteAnchor(id int) error {
-	stmt, err := r.db.Prepare("DELETE FROM anchors WHERE id=?")
+func (r *AnchorSQLiteRepository) PurgeAnchor(ctx context.Context, id int) error {
+	res, err := r.writes.purge.ExecContext(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	res, err := stmt.Exec(id)
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	_, err = res.RowsAffected()
+	if n == 0 {
+		return ErrAnchorNotFound
+	}
+
+	return nil
+}
+
+func (r *AnchorSQLiteRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.writes.purgeBefore.ExecContext(ctx, sqliteTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
+
+func (r *AnchorSQLiteRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return rev, err
+	}
+
+	rev.CreatedAt = r.now().UTC()
+
+	err = r.writes.addRevision.QueryRowContext(ctx, rev.AnchorID, rev.Actor, sqliteTime(rev.CreatedAt),
+		rev.Anchor.URL, rev.Anchor.Version, string(changes), rev.AnchorID).Scan(&rev.Number)
+
+	return rev, err
+}
+
+func (r *AnchorSQLiteRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	rows, err := r.reads.listRevisions.QueryContext(ctx, anchorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+
+	for rows.Next() {
+		rev, err := scanSQLiteRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (r *AnchorSQLiteRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	rev, err := scanSQLiteRevision(r.reads.getRevision.QueryRowContext(ctx, anchorID, number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rev, ErrRevisionNotFound
+	}
+
+	return rev, err
+}
+
+func (r *AnchorSQLiteRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	logged := LoggedEvent{AnchorEvent: e}
+
+	res, err := r.writes.addEvent.ExecContext(ctx, e.Type, sqliteTime(e.Time), e.Actor, e.Anchor.ID, e.Anchor.URL, e.Anchor.Version)
+	if err != nil {
+		return logged, err
+	}
+
+	id, err := res.LastInsertId()
+	logged.ID = int(id)
+
+	return logged, err
+}
+
+func (r *AnchorSQLiteRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := r.reads.listEvents.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []LoggedEvent{}
+
+	for rows.Next() {
+		var (
+			e         LoggedEvent
+			createdAt string
+		)
+
+		err := rows.Scan(&e.ID, &e.Type, &createdAt, &e.Actor, &e.Anchor.ID, &e.Anchor.URL, &e.Anchor.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Time, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *AnchorSQLiteRepository) LastEventID(ctx context.Context) (int, error) {
+	var id int
+
+	err := r.reads.lastEventID.QueryRowContext(ctx).Scan(&id)
+
+	return id, err
+}
+
+func (r *AnchorSQLiteRepository) PruneEvents(ctx context.Context, upTo int) error {
+	_, err := r.writes.pruneEvents.ExecContext(ctx, upTo)
+	return err
+}
+
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLiteRevision(row rowScanner) (Revision, error) {
+	var (
+		rev       Revision
+		createdAt string
+		changes   string
+	)
+
+	err := row.Scan(&rev.AnchorID, &rev.Number, &rev.Actor, &createdAt, &rev.Anchor.URL, &rev.Anchor.Version, &changes)
+	if err != nil {
+		return rev, err
+	}
+
+	rev.Anchor.ID = rev.AnchorID
+
+	if rev.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+		return rev, err
+	}
+
+	return rev, json.Unmarshal([]byte(changes), &rev.Changes)
+}
+
+// sqliteTimeLayout stores times as fixed-width UTC text, so that they sort
+// and compare as strings in time order.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// scanAnchors reads every anchor from rows and closes them. It takes the
+// result of a query directly, so err is the query error.
+func scanAnchors(rows *sql.Rows, err error) ([]Anchor, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := []Anchor{}
+
+	for rows.Next() {
+		anchor := Anchor{}
+		err = rows.Scan(&anchor.ID, &anchor.URL, &anchor.Version)
+
+		if err != nil {
+			return nil, err
+		}
+
+		anchors = append(anchors, anchor)
+	}
+
+	return anchors, rows.Err()
+}
+
+// anchorConflict explains why a conditional update or delete of the
+// anchor id changed nothing: either it does not exist or it is at another
+// version.
+func anchorConflict(ctx context.Context, r anchorRepository, id int) error {
+	_, err := r.GetAnchor(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return ErrAnchorVersionMismatch
 }
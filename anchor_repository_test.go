@@ -0,0 +1,186 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestAnchorSQLiteRepository(t testing.TB) *AnchorSQLiteRepository {
+	t.Helper()
+
+	db := newTestSQLiteDB(t)
+
+	m, err := NewSQLiteMigrator(db.Write)
+	assertNoError(t, err)
+	assertNoError(t, m.Up(context.Background()))
+
+	r, err := NewAnchorSQLiteRepository(context.Background(), db)
+	assertNoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+// unpreparedAnchorRepository prepares a statement on every call, the way
+// AnchorSQLiteRepository used to, as a baseline for the benchmarks.
+type unpreparedAnchorRepository struct {
+	db *SQLiteDB
+}
+
+func (r *unpreparedAnchorRepository) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := r.db.Write.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (r *unpreparedAnchorRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	res, err := r.exec(ctx, "INSERT INTO anchors (url) VALUES (?)", a.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+
+	return int(id), err
+}
+
+func (r *unpreparedAnchorRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	stmt, err := r.db.Read.PrepareContext(ctx, "SELECT id, url FROM anchors WHERE id=?")
+	if err != nil {
+		return Anchor{}, err
+	}
+	defer stmt.Close()
+
+	anchor := Anchor{}
+	err = stmt.QueryRowContext(ctx, id).Scan(&anchor.ID, &anchor.URL)
+
+	return anchor, err
+}
+
+func (r *unpreparedAnchorRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	stmt, err := r.db.Read.PrepareContext(ctx, "SELECT id, url FROM anchors")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := []Anchor{}
+
+	for rows.Next() {
+		anchor := Anchor{}
+		if err := rows.Scan(&anchor.ID, &anchor.URL); err != nil {
+			return nil, err
+		}
+
+		anchors = append(anchors, anchor)
+	}
+
+	return anchors, rows.Err()
+}
+
+type benchAnchorRepository interface {
+	AddAnchor(ctx context.Context, a Anchor) (int, error)
+	GetAnchor(ctx context.Context, id int) (Anchor, error)
+	GetAnchors(ctx context.Context) ([]Anchor, error)
+}
+
+const benchAnchorCount = 100
+
+func TestAnchorSQLiteRepositoryNotFound(t *testing.T) {
+	ctx := context.Background()
+	r := newTestAnchorSQLiteRepository(t)
+
+	_, err := r.GetAnchor(ctx, 42)
+	assertEqual(t, ErrAnchorNotFound, err)
+
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: 42, URL: "https://example.com"})
+	assertEqual(t, ErrAnchorNotFound, err)
+
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: 42, URL: "https://example.com", Version: 1})
+	assertEqual(t, ErrAnchorNotFound, err)
+
+	err = r.DeleteAnchor(ctx, 42, 0)
+	assertEqual(t, ErrAnchorNotFound, err)
+}
+
+func BenchmarkAnchorSQLiteRepository(b *testing.B) {
+	b.Run("prepared", func(b *testing.B) {
+		benchmarkAnchorRepository(b, func(b *testing.B) benchAnchorRepository {
+			return newTestAnchorSQLiteRepository(b)
+		})
+	})
+
+	b.Run("unprepared", func(b *testing.B) {
+		benchmarkAnchorRepository(b, func(b *testing.B) benchAnchorRepository {
+			return &unpreparedAnchorRepository{db: newTestAnchorSQLiteRepository(b).db}
+		})
+	})
+}
+
+func benchmarkAnchorRepository(b *testing.B, newRepository func(b *testing.B) benchAnchorRepository) {
+	seed := func(b *testing.B, r benchAnchorRepository) {
+		b.Helper()
+
+		for i := 0; i < benchAnchorCount; i++ {
+			_, err := r.AddAnchor(context.Background(), Anchor{URL: fmt.Sprintf("https://example.com/%d", i)})
+			assertNoError(b, err)
+		}
+	}
+
+	b.Run("Add", func(b *testing.B) {
+		r := newRepository(b)
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := r.AddAnchor(context.Background(), Anchor{URL: "https://example.com"}); err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	})
+
+	b.Run("Get", func(b *testing.B) {
+		r := newRepository(b)
+		seed(b, r)
+
+		var n int64
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := int(atomic.AddInt64(&n, 1)%benchAnchorCount) + 1
+				if _, err := r.GetAnchor(context.Background(), id); err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	})
+
+	b.Run("List", func(b *testing.B) {
+		r := newRepository(b)
+		seed(b, r)
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := r.GetAnchors(context.Background()); err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	})
+}
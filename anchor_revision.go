@@ -0,0 +1,269 @@
+package junkboy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ErrRevisionNotFound is returned when an anchor has no revision with the
+// requested number.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a recorded change to an anchor. Revisions of an anchor are
+// numbered from 1, which is its creation for anchors created since
+// revisions were introduced.
+type Revision struct {
+	AnchorID  int       `json:"anchor_id"`
+	Number    int       `json:"revision"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Anchor is the anchor as the change left it.
+	Anchor  Anchor        `json:"anchor"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is the old and new value of an anchor field, by its JSON
+// name. Old is nil for fields that were just set.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx that records actor as whoever makes the
+// changes made with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or an empty string
+// if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// anchorFields returns the fields of a by their JSON names, leaving out
+// the ID and version, which every revision changes or shares.
+func anchorFields(a Anchor) map[string]interface{} {
+	var fields map[string]interface{}
+
+	js, err := json.Marshal(a)
+	if err == nil {
+		err = json.Unmarshal(js, &fields)
+	}
+
+	if err != nil {
+		// Anchors always round-trip through JSON.
+		panic(err)
+	}
+
+	delete(fields, "id")
+	delete(fields, "version")
+
+	return fields
+}
+
+// diffFields lists the fields whose values differ between from and to, in
+// name order. A nil from compares against an anchor without any fields.
+func diffFields(from, to map[string]interface{}) []FieldChange {
+	names := map[string]bool{}
+	for name := range from {
+		names[name] = true
+	}
+
+	for name := range to {
+		names[name] = true
+	}
+
+	changes := []FieldChange{}
+
+	for name := range names {
+		if !reflect.DeepEqual(from[name], to[name]) {
+			changes = append(changes, FieldChange{Field: name, Old: from[name], New: to[name]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+// inTx runs fn in a transaction if the repositories support them, so that
+// a change, its revision and its event are stored together, and directly
+// otherwise.
+func (s *AnchorService) inTx(ctx context.Context, fn func(r anchorRepository) error) error {
+	if s.repos.tx == nil {
+		return fn(s.repos.Anchors)
+	}
+
+	return s.repos.WithTx(ctx, func(repos Repositories) error {
+		return fn(repos.Anchors)
+	})
+}
+
+// addAnchor adds a to r with its first revision.
+func addAnchor(ctx context.Context, r anchorRepository, a Anchor) (Anchor, error) {
+	id, err := r.AddAnchor(ctx, a)
+	if err != nil {
+		return Anchor{}, err
+	}
+
+	added := Anchor{ID: id, URL: a.URL, Version: 1}
+
+	_, err = r.AddRevision(ctx, Revision{
+		AnchorID: id,
+		Actor:    ActorFromContext(ctx),
+		Anchor:   added,
+		Changes:  diffFields(nil, anchorFields(added)),
+	})
+
+	return added, err
+}
+
+// maxUpdateAttempts bounds how often an unconditional update is retried
+// when another one gets in between reading the anchor and writing it.
+const maxUpdateAttempts = 3
+
+// updateAnchor updates a in r and records the fields it changed as a new
+// revision. Every update goes through here, so none can skip its revision.
+func updateAnchor(ctx context.Context, r anchorRepository, a Anchor) (Anchor, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := r.GetAnchor(ctx, a.ID)
+		if err != nil {
+			return a, err
+		}
+
+		if a.Version != 0 && a.Version != current.Version {
+			return a, ErrAnchorVersionMismatch
+		}
+
+		// Pin the update to the version read, so that the revision has
+		// the values it replaced.
+		next := a
+		next.Version = current.Version
+
+		updated, err := r.UpdateAnchor(ctx, next)
+		if errors.Is(err, ErrAnchorVersionMismatch) && a.Version == 0 && attempt < maxUpdateAttempts {
+			continue
+		}
+
+		if err != nil {
+			return updated, err
+		}
+
+		_, err = r.AddRevision(ctx, Revision{
+			AnchorID: updated.ID,
+			Actor:    ActorFromContext(ctx),
+			Anchor:   updated,
+			Changes:  diffFields(anchorFields(current), anchorFields(updated)),
+		})
+
+		return updated, err
+	}
+}
+
+// restoreAnchor takes the anchor id out of the trash in r and records it
+// as a new revision. Restoring leaves the fields as they were, so the
+// revision changes none of them.
+func restoreAnchor(ctx context.Context, r anchorRepository, id int) (Anchor, error) {
+	restored, err := r.RestoreAnchor(ctx, id)
+	if err != nil {
+		return restored, err
+	}
+
+	_, err = r.AddRevision(ctx, Revision{
+		AnchorID: restored.ID,
+		Actor:    ActorFromContext(ctx),
+		Anchor:   restored,
+		Changes:  []FieldChange{},
+	})
+
+	return restored, err
+}
+
+// ListRevisions returns the revisions of the anchor id, oldest first.
+func (s *AnchorService) ListRevisions(ctx context.Context, id int) ([]Revision, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.repos.Anchors.GetAnchor(ctx, id); err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.repos.Anchors.ListRevisions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (s *AnchorService) GetRevision(ctx context.Context, id, number int) (Revision, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.repos.Anchors.GetAnchor(ctx, id); err != nil {
+		return Revision{}, err
+	}
+
+	revision, err := s.repos.Anchors.GetRevision(ctx, id, number)
+	if err != nil {
+		return revision, err
+	}
+
+	return revision, nil
+}
+
+// DiffRevisions returns the fields that differ between the anchor id as
+// revision from left it and as revision to left it.
+func (s *AnchorService) DiffRevisions(ctx context.Context, id, from, to int) ([]FieldChange, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.repos.Anchors.GetAnchor(ctx, id); err != nil {
+		return nil, err
+	}
+
+	fromRevision, err := s.repos.Anchors.GetRevision(ctx, id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevision, err := s.repos.Anchors.GetRevision(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffFields(anchorFields(fromRevision.Anchor), anchorFields(toRevision.Anchor)), nil
+}
+
+// RevertAnchor sets the fields of the anchor id back to how revision
+// number left them, as a new revision. Unless version is 0, the anchor
+// must still be at that version.
+func (s *AnchorService) RevertAnchor(ctx context.Context, id, number, version int) (Anchor, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.change(ctx, AnchorUpdated, func(r anchorRepository) (Anchor, error) {
+		if _, err := r.GetAnchor(ctx, id); err != nil {
+			return Anchor{}, err
+		}
+
+		revision, err := r.GetRevision(ctx, id, number)
+		if err != nil {
+			return Anchor{}, err
+		}
+
+		a := revision.Anchor
+		a.Version = version
+
+		return updateAnchor(ctx, r, a)
+	})
+}
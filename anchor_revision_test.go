@@ -0,0 +1,236 @@
+package junkboy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnchorServiceRevisions(t *testing.T) {
+	stores := []struct {
+		name  string
+		repos func(t *testing.T) Repositories
+	}{
+		{"Memory", func(t *testing.T) Repositories { return NewMemoryStore().Repositories() }},
+		{"SQLite", func(t *testing.T) Repositories { return newTestSQLiteStore(t).Repositories() }},
+		{"Bolt", func(t *testing.T) Repositories { return newTestBoltStore(t).Repositories() }},
+		{"No tx", func(t *testing.T) Repositories { return Repositories{Anchors: NewAnchorMemoryRepository()} }},
+	}
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := WithActor(context.Background(), "alice")
+			s := NewAnchorServiceWithRepositories(store.repos(t))
+
+			id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+			assertNoError(t, err)
+
+			_, err = s.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/b"})
+			assertNoError(t, err)
+
+			// Bulk updates are recorded too.
+			results, err := s.Bulk(context.Background(), []BulkOperation{{Op: "update", ID: id, URL: "https://example.com/c"}}, false)
+			assertNoError(t, err)
+			assertNoError(t, results[0].Err)
+
+			revisions, err := s.ListRevisions(ctx, id)
+			assertNoError(t, err)
+			assertEqual(t, 3, len(revisions))
+
+			for i, want := range []struct {
+				actor  string
+				old    interface{}
+				url    string
+				number int
+			}{
+				{"alice", nil, "https://example.com/a", 1},
+				{"alice", "https://example.com/a", "https://example.com/b", 2},
+				{"", "https://example.com/b", "https://example.com/c", 3},
+			} {
+				rev := revisions[i]
+				assertEqual(t, want.number, rev.Number)
+				assertEqual(t, want.actor, rev.Actor)
+				assertEqual(t, Anchor{ID: id, URL: want.url, Version: want.number}, rev.Anchor)
+				assertEqual(t, 1, len(rev.Changes))
+				assertEqual(t, FieldChange{Field: "url", Old: want.old, New: want.url}, rev.Changes[0])
+			}
+
+			changes, err := s.DiffRevisions(ctx, id, 1, 3)
+			assertNoError(t, err)
+			assertEqual(t, 1, len(changes))
+			assertEqual(t, FieldChange{Field: "url", Old: "https://example.com/a", New: "https://example.com/c"}, changes[0])
+
+			changes, err = s.DiffRevisions(ctx, id, 2, 2)
+			assertNoError(t, err)
+			assertEqual(t, 0, len(changes))
+
+			_, err = s.RevertAnchor(ctx, id, 1, 2)
+			assertEqual(t, true, errors.Is(err, ErrAnchorVersionMismatch))
+
+			reverted, err := s.RevertAnchor(ctx, id, 1, 3)
+			assertNoError(t, err)
+			assertEqual(t, Anchor{ID: id, URL: "https://example.com/a", Version: 4}, reverted)
+
+			rev, err := s.GetRevision(ctx, id, 4)
+			assertNoError(t, err)
+			assertEqual(t, FieldChange{Field: "url", Old: "https://example.com/c", New: "https://example.com/a"}, rev.Changes[0])
+
+			_, err = s.RevertAnchor(ctx, id, 9, 0)
+			assertEqual(t, true, errors.Is(err, ErrRevisionNotFound))
+
+			// The history of a deleted anchor is hidden with it.
+			assertNoError(t, s.DeleteAnchor(ctx, id, 0))
+
+			_, err = s.ListRevisions(ctx, id)
+			assertEqual(t, true, errors.Is(err, ErrAnchorNotFound))
+
+			_, err = s.RevertAnchor(ctx, id, 1, 0)
+			assertEqual(t, true, errors.Is(err, ErrAnchorNotFound))
+
+			// Restoring it brings the history back, with the restore in it.
+			restored, err := s.RestoreAnchor(ctx, id)
+			assertNoError(t, err)
+
+			revisions, err = s.ListRevisions(ctx, id)
+			assertNoError(t, err)
+			assertEqual(t, 5, len(revisions))
+			assertEqual(t, "alice", revisions[4].Actor)
+			assertEqual(t, restored, revisions[4].Anchor)
+			assertEqual(t, 0, len(revisions[4].Changes))
+		})
+	}
+}
+
+func TestRevisionHandlers(t *testing.T) {
+	ctx := context.Background()
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+
+	id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+	assertNoError(t, err)
+
+	_, err = s.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	router := NewRouter("/v1")
+	NewAnchorHTTPHandler(s).RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		ifMatch        string
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "Diff",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/1/diff?from=2&to=1",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"from":2,"to":1,"changes":[{"field":"url","old":"https://example.com/b","new":"https://example.com/a"}]}`,
+		},
+		{
+			name:           "Diff missing revision",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/1/diff?from=1&to=5",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"revision not found"}`,
+		},
+		{
+			name:           "Diff bad from",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/1/diff?to=1",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid from ''"}`,
+		},
+		{
+			name:           "Get revision bad number",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/1/revisions/latest",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid revision 'latest'"}`,
+		},
+		{
+			name:           "Revert stale",
+			method:         http.MethodPost,
+			path:           "/v1/anchor/1/revert/1",
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusPreconditionFailed,
+			responseBody:   `{"status":412,"message":"anchor has been modified"}`,
+		},
+		{
+			name:           "Revert",
+			method:         http.MethodPost,
+			path:           "/v1/anchor/1/revert/1",
+			ifMatch:        `"2"`,
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"id":1,"url":"https://example.com/a","version":3}`,
+		},
+		{
+			name:           "Revisions of missing anchor",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/9/revisions",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"anchor not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			assertNoError(t, err)
+
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/anchor/1/revisions", nil)
+	assertNoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertEqual(t, http.StatusOK, rr.Code)
+
+	var revisions []Revision
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &revisions))
+	assertEqual(t, 3, len(revisions))
+	assertEqual(t, Anchor{ID: id, URL: "https://example.com/a", Version: 3}, revisions[2].Anchor)
+}
+
+func TestRevisionActor(t *testing.T) {
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+
+	router := NewRouter("/v1")
+	NewAnchorHTTPHandler(s).RegisterRoutes(router)
+	handler := NewActorMiddleware(router, "", "X-Forwarded-User")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/anchor", strings.NewReader(`{"url":"https://example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-User", "alice")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assertEqual(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/anchor/1/revisions", nil))
+	assertEqual(t, http.StatusOK, rr.Code)
+
+	var revisions []Revision
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &revisions))
+	assertEqual(t, 1, len(revisions))
+	assertEqual(t, "alice", revisions[0].Actor)
+}
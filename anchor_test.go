@@ -1,23 +1,93 @@
 package junkboy
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 )
 
 type mockAnchorRepository struct {
-	AddAnchorFunc    func(a Anchor) (int, error)
-	UpdateAnchorFunc func(a Anchor) error
-	GetAnchorFunc    func(id int) (Anchor, error)
-	GetAnchorsFunc   func() ([]Anchor, error)
-	DeleteAnchorFunc func(id int) error
+	AddAnchorFunc     func(a Anchor) (int, error)
+	UpdateAnchorFunc  func(a Anchor) (Anchor, error)
+	GetAnchorFunc     func(id int) (Anchor, error)
+	GetAnchorsFunc    func() ([]Anchor, error)
+	ListAnchorsFunc   func(after, limit int) ([]Anchor, error)
+	DeleteAnchorFunc  func(id, version int) error
+	ListTrashFunc     func() ([]TrashedAnchor, error)
+	RestoreFunc       func(id int) (Anchor, error)
+	PurgeAnchorFunc   func(id int) error
+	PurgeTrashFunc    func(before time.Time) (int, error)
+	AddRevisionFunc   func(rev Revision) (Revision, error)
+	ListRevisionsFunc func(anchorID int) ([]Revision, error)
+	GetRevisionFunc   func(anchorID, number int) (Revision, error)
+	AddEventFunc      func(e AnchorEvent) (LoggedEvent, error)
+	ListEventsFunc    func(after, limit int) ([]LoggedEvent, error)
+	LastEventIDFunc   func() (int, error)
+	PruneEventsFunc   func(upTo int) error
 }
 
-func (ar *mockAnchorRepository) AddAnchor(a Anchor) (int, error)  { return ar.AddAnchorFunc(a) }
-func (ar *mockAnchorRepository) UpdateAnchor(a Anchor) error      { return ar.UpdateAnchorFunc(a) }
-func (ar *mockAnchorRepository) GetAnchor(id int) (Anchor, error) { return ar.GetAnchorFunc(id) }
-func (ar *mockAnchorRepository) GetAnchors() ([]Anchor, error)    { return ar.GetAnchorsFunc() }
-func (ar *mockAnchorRepository) DeleteAnchor(id int) error        { return ar.DeleteAnchorFunc(id) }
+func (ar *mockAnchorRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	return ar.AddAnchorFunc(a)
+}
+func (ar *mockAnchorRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	return ar.UpdateAnchorFunc(a)
+}
+func (ar *mockAnchorRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	return ar.GetAnchorFunc(id)
+}
+func (ar *mockAnchorRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	return ar.GetAnchorsFunc()
+}
+func (ar *mockAnchorRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	return ar.ListAnchorsFunc(after, limit)
+}
+func (ar *mockAnchorRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	return ar.DeleteAnchorFunc(id, version)
+}
+func (ar *mockAnchorRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	return ar.ListTrashFunc()
+}
+func (ar *mockAnchorRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	return ar.RestoreFunc(id)
+}
+func (ar *mockAnchorRepository) PurgeAnchor(ctx context.Context, id int) error {
+	return ar.PurgeAnchorFunc(id)
+}
+func (ar *mockAnchorRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return ar.PurgeTrashFunc(before)
+}
+func (ar *mockAnchorRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	return ar.AddRevisionFunc(rev)
+}
+func (ar *mockAnchorRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	return ar.ListRevisionsFunc(anchorID)
+}
+func (ar *mockAnchorRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	return ar.GetRevisionFunc(anchorID, number)
+}
+
+func (ar *mockAnchorRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	return ar.AddEventFunc(e)
+}
+func (ar *mockAnchorRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	return ar.ListEventsFunc(after, limit)
+}
+func (ar *mockAnchorRepository) LastEventID(ctx context.Context) (int, error) {
+	return ar.LastEventIDFunc()
+}
+func (ar *mockAnchorRepository) PruneEvents(ctx context.Context, upTo int) error {
+	return ar.PruneEventsFunc(upTo)
+}
+
+func addTestEvent(e AnchorEvent) (LoggedEvent, error) {
+	return LoggedEvent{ID: 1, AnchorEvent: e}, nil
+}
+
+func addTestRevision(rev Revision) (Revision, error) {
+	rev.Number = 1
+	return rev, nil
+}
 
 var (
 	testAnchor = Anchor{
@@ -65,9 +135,9 @@ func TestAddAnchor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := &mockAnchorRepository{AddAnchorFunc: tt.method}
+			r := &mockAnchorRepository{AddAnchorFunc: tt.method, AddRevisionFunc: addTestRevision, AddEventFunc: addTestEvent}
 			s := NewAnchorService(r)
-			id, err := s.AddAnchor(testAnchor)
+			id, err := s.AddAnchor(context.Background(), testAnchor)
 			if tt.errExpected {
 				assertError(t, err)
 			} else {
@@ -82,33 +152,51 @@ func TestUpdateAnchor(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func(a Anchor) error
+		method      func(a Anchor) (Anchor, error)
 	}{
 		{
 			name:        "Update anchor ok",
 			errExpected: false,
-			method: func(a Anchor) error {
-				return nil
+			method: func(a Anchor) (Anchor, error) {
+				a.Version++
+				return a, nil
 			},
 		},
 		{
 			name:        "Update anchor error",
 			errExpected: true,
-			method: func(a Anchor) error {
-				return errors.New("error updating anchor")
+			method: func(a Anchor) (Anchor, error) {
+				return a, errors.New("error updating anchor")
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := &mockAnchorRepository{UpdateAnchorFunc: tt.method}
+			var revisions []Revision
+
+			r := &mockAnchorRepository{
+				UpdateAnchorFunc: tt.method,
+				GetAnchorFunc: func(id int) (Anchor, error) {
+					return Anchor{ID: id, URL: "https://example.com/old", Version: 1}, nil
+				},
+				AddRevisionFunc: func(rev Revision) (Revision, error) {
+					revisions = append(revisions, rev)
+					return addTestRevision(rev)
+				},
+				AddEventFunc: addTestEvent,
+			}
 			s := NewAnchorService(r)
-			err := s.UpdateAnchor(testAnchor)
+			anchor, err := s.UpdateAnchor(context.Background(), testAnchor)
 			if tt.errExpected {
 				assertError(t, err)
+				assertEqual(t, 0, len(revisions))
 			} else {
 				assertNoError(t, err)
+				assertEqual(t, 2, anchor.Version)
+				assertEqual(t, 1, len(revisions))
+				assertEqual(t, 1, len(revisions[0].Changes))
+				assertEqual(t, FieldChange{Field: "url", Old: "https://example.com/old", New: testAnchor.URL}, revisions[0].Changes[0])
 			}
 		})
 	}
@@ -140,7 +228,7 @@ func TestGetAnchor(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockAnchorRepository{GetAnchorFunc: tt.method}
 			s := NewAnchorService(r)
-			anchor, err := s.GetAnchor(1)
+			anchor, err := s.GetAnchor(context.Background(), 1)
 			if tt.errExpected {
 				assertError(t, err)
 			} else {
@@ -177,7 +265,7 @@ func TestGetAnchors(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &mockAnchorRepository{GetAnchorsFunc: tt.method}
 			s := NewAnchorService(r)
-			anchors, err := s.GetAnchors()
+			anchors, err := s.GetAnchors(context.Background())
 			if tt.errExpected {
 				assertError(t, err)
 			} else {
@@ -197,19 +285,19 @@ func TestDeleteAnchor(t *testing.T) {
 	tests := []struct {
 		name        string
 		errExpected bool
-		method      func(id int) error
+		method      func(id, version int) error
 	}{
 		{
 			name:        "Delete anchor ok",
 			errExpected: false,
-			method: func(id int) error {
+			method: func(id, version int) error {
 				return nil
 			},
 		},
 		{
 			name:        "Delete anchor error",
 			errExpected: true,
-			method: func(id int) error {
+			method: func(id, version int) error {
 				return errors.New("error deleting anchor")
 			},
 		},
@@ -217,9 +305,9 @@ func TestDeleteAnchor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := &mockAnchorRepository{DeleteAnchorFunc: tt.method}
+			r := &mockAnchorRepository{DeleteAnchorFunc: tt.method, AddEventFunc: addTestEvent}
 			s := NewAnchorService(r)
-			err := s.DeleteAnchor(1)
+			err := s.DeleteAnchor(context.Background(), 1, 0)
 			if tt.errExpected {
 				assertError(t, err)
 			} else {
@@ -228,3 +316,50 @@ func TestDeleteAnchor(t *testing.T) {
 		})
 	}
 }
+
+type deadlineAnchorRepository struct {
+	mockAnchorRepository
+	hasDeadline bool
+}
+
+func (ar *deadlineAnchorRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	_, ar.hasDeadline = ctx.Deadline()
+
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestAnchorServiceTimeout(t *testing.T) {
+	r := &deadlineAnchorRepository{}
+	s := NewAnchorService(r)
+	s.SetTimeout(10 * time.Millisecond)
+
+	_, err := s.GetAnchors(context.Background())
+
+	assertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+	assertEqual(t, true, r.hasDeadline)
+}
+
+func TestTrashPurgeJob(t *testing.T) {
+	var got time.Time
+
+	r := &mockAnchorRepository{
+		PurgeTrashFunc: func(before time.Time) (int, error) {
+			got = before
+			return 2, nil
+		},
+	}
+
+	job := NewTrashPurgeJob(NewAnchorService(r), time.Hour, time.Minute)
+	assertEqual(t, "purge_trash", job.Name)
+	assertEqual(t, time.Minute, job.Interval)
+
+	start := time.Now()
+	assertNoError(t, job.Run(context.Background()))
+	end := time.Now()
+
+	if got.Before(start.Add(-time.Hour)) || got.After(end.Add(-time.Hour)) {
+		t.Errorf("purged before %v, want an hour before %v", got, start)
+	}
+}
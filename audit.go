@@ -0,0 +1,325 @@
+package junkboy
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one change made through the API. Each entry holds
+// the hash of the one before it, so editing or removing an entry breaks
+// the chain from there on.
+type AuditEntry struct {
+	Seq       int       `json:"seq"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Resource  string    `json:"resource"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// Outcomes of audited requests.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// auditHash is the hash of e with its own hash left out.
+func auditHash(e AuditEntry) string {
+	e.Hash = ""
+
+	js, err := json.Marshal(e)
+	if err != nil {
+		// Entries always marshal.
+		panic(err)
+	}
+
+	sum := sha256.Sum256(js)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// chain fills in the sequence number and hashes of e as the entry after
+// prev, which is the zero entry for the first one.
+func (e AuditEntry) chain(prev AuditEntry) AuditEntry {
+	e.Seq = prev.Seq + 1
+	e.PrevHash = prev.Hash
+	e.Hash = auditHash(e)
+
+	return e
+}
+
+// AuditChainError is returned by VerifyAuditLog for the first entry that
+// does not follow from the one before it.
+type AuditChainError struct {
+	Seq    int
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit entry %d: %s", e.Seq, e.Reason)
+}
+
+type auditLog interface {
+	// Append adds e after the last entry, setting its sequence number,
+	// time and hashes, and returns it.
+	Append(ctx context.Context, e AuditEntry) (AuditEntry, error)
+	// Entries calls fn with every entry in order, stopping at the first
+	// error.
+	Entries(ctx context.Context, fn func(AuditEntry) error) error
+}
+
+// VerifyAuditLog walks the hash chain of l and returns how many entries it
+// checked. The error is an *AuditChainError if the chain is broken.
+func VerifyAuditLog(ctx context.Context, l auditLog) (int, error) {
+	var prev AuditEntry
+
+	n := 0
+
+	err := l.Entries(ctx, func(e AuditEntry) error {
+		switch {
+		case e.Seq != prev.Seq+1:
+			return &AuditChainError{Seq: e.Seq, Reason: fmt.Sprintf("expected sequence number %d", prev.Seq+1)}
+		case e.PrevHash != prev.Hash:
+			return &AuditChainError{Seq: e.Seq, Reason: "previous hash does not match"}
+		case e.Hash != auditHash(e):
+			return &AuditChainError{Seq: e.Seq, Reason: "hash does not match contents"}
+		}
+
+		prev = e
+		n++
+
+		return nil
+	})
+
+	return n, err
+}
+
+// AuditMemoryLog keeps the audit log in memory, for tests and for servers
+// that do not need it to survive a restart.
+type AuditMemoryLog struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+	now     func() time.Time
+}
+
+func NewAuditMemoryLog() *AuditMemoryLog {
+	return &AuditMemoryLog{now: time.Now}
+}
+
+func (l *AuditMemoryLog) Append(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return e, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var prev AuditEntry
+	if len(l.entries) > 0 {
+		prev = l.entries[len(l.entries)-1]
+	}
+
+	e.Time = l.now().UTC()
+	e = e.chain(prev)
+	l.entries = append(l.entries, e)
+
+	return e, nil
+}
+
+func (l *AuditMemoryLog) Entries(ctx context.Context, fn func(AuditEntry) error) error {
+	l.mu.RLock()
+	entries := l.entries[:len(l.entries):len(l.entries)]
+	l.mu.RUnlock()
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AuditFileLog appends the audit log to a JSON Lines file, syncing after
+// every entry. Opening it reads the file to find where the chain ends,
+// without checking it; see VerifyAuditLog.
+type AuditFileLog struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	last AuditEntry
+}
+
+// maxAuditLineBytes is the longest entry an AuditFileLog reads back.
+const maxAuditLineBytes = 1 << 20
+
+func NewAuditFileLog(path string) (*AuditFileLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &AuditFileLog{path: path, now: time.Now, file: file}
+
+	err = l.Entries(context.Background(), func(e AuditEntry) error {
+		l.last = e
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *AuditFileLog) Append(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return e, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Time = l.now().UTC()
+	e = e.chain(l.last)
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return e, err
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return e, err
+	}
+
+	l.last = e
+
+	return e, nil
+}
+
+// Entries reads the file from the start. Entries appended while it runs
+// may or may not be included.
+func (l *AuditFileLog) Entries(ctx context.Context, fn func(AuditEntry) error) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAuditLineBytes)
+
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", l.path, line, err)
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (l *AuditFileLog) Close() error {
+	return l.file.Close()
+}
+
+// auditedMethods are the methods of the requests that change something.
+var auditedMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// AuditMiddleware appends an entry to the audit log for every request that
+// may change something, and every request that uses the admin token or is
+// refused for the lack of it, once it has been served. It belongs inside
+// RequestIDMiddleware and ActorMiddleware and outside RecoveryMiddleware,
+// so that entries have the request ID and actor and panics are recorded as
+// failures.
+type AuditMiddleware struct {
+	handler http.Handler
+	log     auditLog
+}
+
+func NewAuditMiddleware(handler http.Handler, l auditLog) *AuditMiddleware {
+	return &AuditMiddleware{handler: handler, log: l}
+}
+
+func (h *AuditMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := newStatusWriter(w)
+	h.handler.ServeHTTP(sw, r)
+
+	// Reads are only audited when they authenticate, or fail to.
+	authenticated := r.Header.Get("Authorization") != "" || sw.status == http.StatusUnauthorized
+	if !auditedMethods[r.Method] && !authenticated {
+		return
+	}
+
+	e := AuditEntry{
+		Actor:     ActorFromContext(r.Context()),
+		IP:        remoteIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: RequestIDFromContext(r.Context()),
+		Method:    r.Method,
+		Resource:  r.URL.Path,
+		Status:    sw.status,
+		Outcome:   AuditSuccess,
+	}
+
+	if sw.status >= http.StatusBadRequest {
+		e.Outcome = AuditFailure
+	}
+
+	// The request may have been cancelled, but what it did must still be
+	// recorded.
+	if _, err := h.log.Append(context.Background(), e); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("failed to append audit entry for %s %s [%s]: %v", e.Method, e.Resource, e.RequestID, err)
+	}
+}
+
+// remoteIP is the address the request came from, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
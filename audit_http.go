@@ -0,0 +1,232 @@
+package junkboy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errAuditPageFull stops reading the audit log once a page is full.
+var errAuditPageFull = errors.New("audit page full")
+
+// AuditHTTPHandler serves the audit log to administrators; see
+// adminAuthorized.
+type AuditHTTPHandler struct {
+	log   auditLog
+	token string
+}
+
+func NewAuditHTTPHandler(l auditLog, token string) *AuditHTTPHandler {
+	return &AuditHTTPHandler{log: l, token: token}
+}
+
+func (h *AuditHTTPHandler) RegisterRoutes(r *Router) {
+	r.AddRoute([]string{"GET"}, "/admin/audit", h.getAuditHandler)
+	r.AddRoute([]string{"GET"}, "/admin/audit/export", h.exportAuditHandler)
+	r.AddRoute([]string{"GET"}, "/admin/audit/verify", h.verifyAuditHandler)
+}
+
+// auditFilter selects audit entries by the query parameters of the admin
+// endpoints. Resource matches entries whose resource starts with it.
+type auditFilter struct {
+	actor     string
+	method    string
+	resource  string
+	outcome   string
+	requestID string
+	since     time.Time
+	until     time.Time
+	after     int
+}
+
+func parseAuditFilter(query url.Values) (auditFilter, error) {
+	f := auditFilter{
+		actor:     query.Get("actor"),
+		method:    strings.ToUpper(query.Get("method")),
+		resource:  query.Get("resource"),
+		outcome:   query.Get("outcome"),
+		requestID: query.Get("request_id"),
+	}
+
+	if f.outcome != "" && f.outcome != AuditSuccess && f.outcome != AuditFailure {
+		return f, fmt.Errorf("outcome must be %s or %s", AuditSuccess, AuditFailure)
+	}
+
+	for _, t := range []struct {
+		key string
+		dst *time.Time
+	}{{"since", &f.since}, {"until", &f.until}} {
+		v := query.Get(t.key)
+		if v == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s '%s'", t.key, v)
+		}
+
+		*t.dst = parsed
+	}
+
+	after, err := queryInt(query, "after", 0)
+	if err != nil || after < 0 {
+		return f, fmt.Errorf("invalid after '%s'", query.Get("after"))
+	}
+
+	f.after = after
+
+	return f, nil
+}
+
+func (f auditFilter) matches(e AuditEntry) bool {
+	switch {
+	case e.Seq <= f.after:
+		return false
+	case f.actor != "" && e.Actor != f.actor:
+		return false
+	case f.method != "" && e.Method != f.method:
+		return false
+	case f.resource != "" && !strings.HasPrefix(e.Resource, f.resource):
+		return false
+	case f.outcome != "" && e.Outcome != f.outcome:
+		return false
+	case f.requestID != "" && e.RequestID != f.requestID:
+		return false
+	case !f.since.IsZero() && e.Time.Before(f.since):
+		return false
+	case !f.until.IsZero() && !e.Time.Before(f.until):
+		return false
+	}
+
+	return true
+}
+
+// maxAuditPageSize is the largest limit accepted by GET /admin/audit.
+const maxAuditPageSize = 1000
+
+// defaultAuditPageSize is the limit of GET /admin/audit when none is given.
+const defaultAuditPageSize = 100
+
+// getAuditHandler lists a page of the entries matching the filter, oldest
+// first. A full page links to the next one in the Link header.
+func (h *AuditHTTPHandler) getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter, err := parseAuditFilter(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := queryInt(query, "limit", defaultAuditPageSize)
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize))
+		return
+	}
+
+	entries := []AuditEntry{}
+
+	err = h.log.Entries(r.Context(), func(e AuditEntry) error {
+		if !filter.matches(e) {
+			return nil
+		}
+
+		entries = append(entries, e)
+		if len(entries) == limit {
+			return errAuditPageFull
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errAuditPageFull) {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	if len(entries) == limit {
+		next := url.Values{}
+		for key, values := range query {
+			next[key] = values
+		}
+
+		next.Set("after", strconv.Itoa(entries[len(entries)-1].Seq))
+		next.Set("limit", strconv.Itoa(limit))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// exportAuditHandler streams the entries matching the filter as JSON
+// Lines, one entry per line exactly as the chain hashes it.
+func (h *AuditHTTPHandler) exportAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+
+	err = h.log.Entries(r.Context(), func(e AuditEntry) error {
+		if !filter.matches(e) {
+			return nil
+		}
+
+		return enc.Encode(e)
+	})
+	if err != nil {
+		// The status has been sent, so all that is left is to cut the
+		// export short and say why.
+		log.Printf("failed to export audit log [%s]: %v", RequestIDFromContext(r.Context()), err)
+	}
+}
+
+// verifyAuditHandler checks the hash chain of the whole log. A broken
+// chain is reported with 409 Conflict and the first entry that breaks it.
+func (h *AuditHTTPHandler) verifyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	type Response struct {
+		Valid   bool   `json:"valid"`
+		Entries int    `json:"entries"`
+		Seq     int    `json:"seq,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	n, err := VerifyAuditLog(r.Context(), h.log)
+
+	var chainErr *AuditChainError
+	if errors.As(err, &chainErr) {
+		writeJSON(w, http.StatusConflict, Response{Entries: n, Seq: chainErr.Seq, Error: chainErr.Error()})
+		return
+	}
+
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Valid: true, Entries: n})
+}
@@ -0,0 +1,378 @@
+package junkboy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendTestAuditEntries(t *testing.T, l auditLog) {
+	t.Helper()
+
+	for _, e := range []AuditEntry{
+		{Actor: "alice", Method: http.MethodPost, Resource: "/v1/anchor", Status: 201, Outcome: AuditSuccess},
+		{Actor: "bob", Method: http.MethodDelete, Resource: "/v1/anchor/1", Status: 404, Outcome: AuditFailure},
+		{Actor: "alice", Method: http.MethodPatch, Resource: "/v1/anchor/2", Status: 200, Outcome: AuditSuccess},
+	} {
+		_, err := l.Append(context.Background(), e)
+		assertNoError(t, err)
+	}
+}
+
+func TestAuditLogs(t *testing.T) {
+	logs := []struct {
+		name string
+		open func(t *testing.T) auditLog
+	}{
+		{"Memory", func(t *testing.T) auditLog { return NewAuditMemoryLog() }},
+		{"File", func(t *testing.T) auditLog {
+			l, err := NewAuditFileLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+			assertNoError(t, err)
+			t.Cleanup(func() { l.Close() })
+
+			return l
+		}},
+	}
+
+	for _, tt := range logs {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.open(t)
+			appendTestAuditEntries(t, l)
+
+			var entries []AuditEntry
+			assertNoError(t, l.Entries(context.Background(), func(e AuditEntry) error {
+				entries = append(entries, e)
+				return nil
+			}))
+
+			assertEqual(t, 3, len(entries))
+			assertEqual(t, "", entries[0].PrevHash)
+
+			for i, e := range entries {
+				assertEqual(t, i+1, e.Seq)
+				assertEqual(t, auditHash(e), e.Hash)
+
+				if i > 0 {
+					assertEqual(t, entries[i-1].Hash, e.PrevHash)
+				}
+			}
+
+			n, err := VerifyAuditLog(context.Background(), l)
+			assertNoError(t, err)
+			assertEqual(t, 3, n)
+		})
+	}
+}
+
+func TestAuditFileLogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := NewAuditFileLog(path)
+	assertNoError(t, err)
+	appendTestAuditEntries(t, l)
+	assertNoError(t, l.Close())
+
+	// Reopening carries on the chain where it ended.
+	l, err = NewAuditFileLog(path)
+	assertNoError(t, err)
+	defer l.Close()
+
+	e, err := l.Append(context.Background(), AuditEntry{Method: http.MethodPut, Resource: "/v1/anchor"})
+	assertNoError(t, err)
+	assertEqual(t, 4, e.Seq)
+
+	n, err := VerifyAuditLog(context.Background(), l)
+	assertNoError(t, err)
+	assertEqual(t, 4, n)
+}
+
+func TestAuditFileLogTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+		seq    int
+		reason string
+	}{
+		{
+			name: "Edited entry",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"actor":"bob"`, `"actor":"carol"`, 1)
+				return lines
+			},
+			seq:    2,
+			reason: "hash does not match contents",
+		},
+		{
+			name: "Removed entry",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			seq:    3,
+			reason: "expected sequence number 2",
+		},
+		{
+			name: "Rehashed entry",
+			tamper: func(lines []string) []string {
+				var e AuditEntry
+				if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+					panic(err)
+				}
+
+				e.Outcome = AuditSuccess
+				e.Hash = auditHash(e)
+
+				js, _ := json.Marshal(e)
+				lines[1] = string(js)
+
+				return lines
+			},
+			seq:    3,
+			reason: "previous hash does not match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+			l, err := NewAuditFileLog(path)
+			assertNoError(t, err)
+			appendTestAuditEntries(t, l)
+			assertNoError(t, l.Close())
+
+			contents, err := os.ReadFile(path)
+			assertNoError(t, err)
+
+			lines := tt.tamper(strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n"))
+			assertNoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+			l, err = NewAuditFileLog(path)
+			assertNoError(t, err)
+			defer l.Close()
+
+			_, err = VerifyAuditLog(context.Background(), l)
+
+			var chainErr *AuditChainError
+			assertEqual(t, true, errors.As(err, &chainErr))
+			assertEqual(t, tt.seq, chainErr.Seq)
+			assertEqual(t, tt.reason, chainErr.Reason)
+		})
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	l := NewAuditMemoryLog()
+
+	handler := NewRequestIDMiddleware(NewActorMiddleware(NewAuditMiddleware(NewRecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/panic":
+			panic("boom")
+		case "/v1/missing":
+			writeError(w, http.StatusNotFound, "anchor not found")
+		case "/v1/admin/audit":
+			if adminAuthorized(w, r, "s3cret") {
+				w.WriteHeader(http.StatusOK)
+			}
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}), nil), l), "s3cret", ""))
+
+	for _, req := range []struct {
+		method string
+		path   string
+		token  string
+	}{
+		{http.MethodGet, "/v1/anchors", ""},
+		{http.MethodPost, "/v1/anchor", "s3cret"},
+		{http.MethodDelete, "/v1/missing", ""},
+		{http.MethodPut, "/v1/panic", ""},
+		{http.MethodGet, "/v1/admin/audit", "guess"},
+		{http.MethodGet, "/v1/admin/audit", "s3cret"},
+	} {
+		r := httptest.NewRequest(req.method, req.path, nil)
+		r.Header.Set("User-Agent", "audit-test")
+		r.Header.Set("X-Request-ID", "req-"+req.method)
+
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var entries []AuditEntry
+	assertNoError(t, l.Entries(context.Background(), func(e AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	}))
+
+	// Reads are not audited, unless they use or fail to use the admin
+	// token.
+	assertEqual(t, 5, len(entries))
+
+	for i, want := range []struct {
+		method   string
+		resource string
+		actor    string
+		status   int
+		outcome  string
+	}{
+		{http.MethodPost, "/v1/anchor", AdminActor, http.StatusCreated, AuditSuccess},
+		{http.MethodDelete, "/v1/missing", "", http.StatusNotFound, AuditFailure},
+		{http.MethodPut, "/v1/panic", "", http.StatusInternalServerError, AuditFailure},
+		{http.MethodGet, "/v1/admin/audit", "", http.StatusUnauthorized, AuditFailure},
+		{http.MethodGet, "/v1/admin/audit", AdminActor, http.StatusOK, AuditSuccess},
+	} {
+		e := entries[i]
+		assertEqual(t, want.method, e.Method)
+		assertEqual(t, want.resource, e.Resource)
+		assertEqual(t, want.actor, e.Actor)
+		assertEqual(t, want.status, e.Status)
+		assertEqual(t, want.outcome, e.Outcome)
+		assertEqual(t, "192.0.2.1", e.IP)
+		assertEqual(t, "audit-test", e.UserAgent)
+		assertEqual(t, "req-"+want.method, e.RequestID)
+	}
+}
+
+func TestAuditHandlers(t *testing.T) {
+	l := NewAuditMemoryLog()
+	appendTestAuditEntries(t, l)
+
+	router := NewRouter("/v1")
+	NewAuditHTTPHandler(l, "secret").RegisterRoutes(router)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	seqs := func(t *testing.T, rr *httptest.ResponseRecorder) string {
+		t.Helper()
+
+		var entries []AuditEntry
+		assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+
+		var got []string
+		for _, e := range entries {
+			got = append(got, string(rune('0'+e.Seq)))
+		}
+
+		return strings.Join(got, ",")
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			rr := get("/v1/admin/audit", token)
+			assertEqual(t, http.StatusUnauthorized, rr.Code)
+			assertEqual(t, `{"status":401,"message":"admin token required"}`, rr.Body.String())
+		}
+	})
+
+	t.Run("No token configured", func(t *testing.T) {
+		router := NewRouter("/v1")
+		NewAuditHTTPHandler(l, "").RegisterRoutes(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/audit", nil)
+		req.Header.Set("Authorization", "Bearer ")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assertEqual(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		for _, tt := range []struct {
+			query string
+			want  string
+		}{
+			{"", "1,2,3"},
+			{"?actor=alice", "1,3"},
+			{"?outcome=failure", "2"},
+			{"?method=patch", "3"},
+			{"?resource=/v1/anchor/", "2,3"},
+			{"?after=1", "2,3"},
+			{"?until=2000-01-01T00:00:00Z", ""},
+		} {
+			rr := get("/v1/admin/audit"+tt.query, "secret")
+			assertEqual(t, http.StatusOK, rr.Code)
+			assertEqual(t, tt.want, seqs(t, rr))
+		}
+	})
+
+	t.Run("Bad filters", func(t *testing.T) {
+		for _, tt := range []struct {
+			query   string
+			message string
+		}{
+			{"?outcome=maybe", "outcome must be success or failure"},
+			{"?since=yesterday", "invalid since 'yesterday'"},
+			{"?after=-1", "invalid after '-1'"},
+			{"?limit=0", "limit must be between 1 and 1000"},
+		} {
+			rr := get("/v1/admin/audit"+tt.query, "secret")
+			assertEqual(t, http.StatusBadRequest, rr.Code)
+			assertEqual(t, `{"status":400,"message":"`+tt.message+`"}`, rr.Body.String())
+		}
+	})
+
+	t.Run("Paging", func(t *testing.T) {
+		rr := get("/v1/admin/audit?actor=alice&limit=1", "secret")
+		assertEqual(t, "1", seqs(t, rr))
+		assertEqual(t, `</v1/admin/audit?actor=alice&after=1&limit=1>; rel="next"`, rr.Header().Get("Link"))
+
+		rr = get("/v1/admin/audit?actor=alice&after=1&limit=1", "secret")
+		assertEqual(t, "3", seqs(t, rr))
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		rr := get("/v1/admin/audit/export?outcome=success", "secret")
+		assertEqual(t, http.StatusOK, rr.Code)
+		assertEqual(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+
+		var got []int
+
+		scanner := bufio.NewScanner(bytes.NewReader(rr.Body.Bytes()))
+		for scanner.Scan() {
+			var e AuditEntry
+			assertNoError(t, json.Unmarshal(scanner.Bytes(), &e))
+			assertEqual(t, auditHash(e), e.Hash)
+			got = append(got, e.Seq)
+		}
+
+		assertEqual(t, 2, len(got))
+		assertEqual(t, 1, got[0])
+		assertEqual(t, 3, got[1])
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		rr := get("/v1/admin/audit/verify", "secret")
+		assertEqual(t, http.StatusOK, rr.Code)
+		assertEqual(t, `{"valid":true,"entries":3}`, rr.Body.String())
+
+		l.mu.Lock()
+		l.entries[1].Time = l.entries[1].Time.Add(time.Second)
+		l.mu.Unlock()
+
+		rr = get("/v1/admin/audit/verify", "secret")
+		assertEqual(t, http.StatusConflict, rr.Code)
+		assertEqual(t, `{"valid":false,"entries":1,"seq":2,"error":"audit entry 2: hash does not match contents"}`, rr.Body.String())
+	})
+}
@@ -0,0 +1,139 @@
+package junkboy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltOptions struct {
+	// Timeout is how long to wait for the file lock held by another
+	// process. Zero waits forever.
+	Timeout time.Duration
+	// NoSync skips fsync after each commit, trading durability for speed.
+	NoSync bool
+}
+
+func DefaultBoltOptions() BoltOptions {
+	return BoltOptions{
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (o BoltOptions) Validate() error {
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	return nil
+}
+
+// NewBoltDB opens or creates the bbolt database file at path. Only one
+// process can have it open at a time.
+func NewBoltDB(path string, opts BoltOptions) (*bolt.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path required")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: opts.Timeout, NoSync: opts.NoSync})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+var (
+	boltAnchors          = []byte("anchors")
+	boltAnchorsByURL     = []byte("anchors_by_url")
+	boltAnchorsByUpdated = []byte("anchors_by_updated")
+	boltTrash            = []byte("trash")
+	boltTrashByDeleted   = []byte("trash_by_deleted")
+	boltRevisions        = []byte("revisions")
+	boltEvents           = []byte("events")
+
+	boltBuckets = [][]byte{boltAnchors, boltAnchorsByURL, boltAnchorsByUpdated, boltTrash, boltTrashByDeleted, boltRevisions, boltEvents}
+)
+
+// boltKey encodes an ID so that keys sort in ID order.
+func boltKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+
+	return key
+}
+
+// ErrNestedTx is returned by backends that cannot nest a unit of work in
+// a savepoint.
+var ErrNestedTx = errors.New("nested transactions are not supported")
+
+// BoltStore holds the bbolt repositories. Writes are serialized by bbolt,
+// so transactions never need retrying, but they cannot be nested.
+type BoltStore struct {
+	Anchors *AnchorBoltRepository
+
+	db *bolt.DB
+}
+
+func NewBoltStore(db *bolt.DB) *BoltStore {
+	return &BoltStore{
+		Anchors: NewAnchorBoltRepository(db),
+		db:      db,
+	}
+}
+
+// Repositories returns the repositories outside of any transaction.
+func (s *BoltStore) Repositories() Repositories {
+	return Repositories{
+		Anchors: s.Anchors,
+		tx:      s,
+	}
+}
+
+// WithTx runs fn in a read-write bbolt transaction, which blocks other
+// writers until it finishes.
+func (s *BoltStore) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(Repositories{
+			Anchors: s.Anchors.inTx(tx),
+			tx:      boltNestedTx{},
+		})
+	})
+}
+
+// Close is a no-op, so that BoltStore can be used like the SQL stores.
+func (s *BoltStore) Close() error {
+	return nil
+}
+
+type boltNestedTx struct{}
+
+func (boltNestedTx) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	return ErrNestedTx
+}
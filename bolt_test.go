@@ -0,0 +1,107 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBoltStore(t *testing.T) *BoltStore {
+	t.Helper()
+
+	db, err := NewBoltDB(filepath.Join(t.TempDir(), "junkboy.bolt"), DefaultBoltOptions())
+	assertNoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return NewBoltStore(db)
+}
+
+func TestAnchorBoltRepositoryIndexes(t *testing.T) {
+	ctx := context.Background()
+	r := newTestBoltStore(t).Anchors
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	a, err := r.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+	assertNoError(t, err)
+
+	now = now.Add(time.Hour)
+
+	b, err := r.AddAnchor(ctx, Anchor{URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	_, err = r.AddAnchor(ctx, Anchor{URL: "https://example.com/a\x00b"})
+	assertNoError(t, err)
+
+	now = now.Add(time.Hour)
+
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: a, URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	found, err := r.FindAnchorsByURL(ctx, "https://example.com/b")
+	assertNoError(t, err)
+	assertEqual(t, 2, len(found))
+	assertEqual(t, a, found[0].ID)
+	assertEqual(t, b, found[1].ID)
+
+	found, err = r.FindAnchorsByURL(ctx, "https://example.com/a")
+	assertNoError(t, err)
+	assertEqual(t, 0, len(found))
+
+	updated, err := r.AnchorsUpdatedSince(ctx, now)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(updated))
+	assertEqual(t, a, updated[0].ID)
+
+	updated, err = r.AnchorsUpdatedSince(ctx, time.Time{})
+	assertNoError(t, err)
+	assertEqual(t, 3, len(updated))
+	assertEqual(t, a, updated[2].ID)
+
+	assertNoError(t, r.DeleteAnchor(ctx, a, 0))
+
+	found, err = r.FindAnchorsByURL(ctx, "https://example.com/b")
+	assertNoError(t, err)
+	assertEqual(t, 1, len(found))
+
+	updated, err = r.AnchorsUpdatedSince(ctx, now)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(updated))
+}
+
+func TestBoltStoreWithTx(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	s := newTestBoltStore(t)
+
+	err := s.WithTx(ctx, func(repos Repositories) error {
+		if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+			return err
+		}
+
+		return errBoom
+	})
+	assertEqual(t, errBoom, err)
+
+	err = s.WithTx(ctx, func(repos Repositories) error {
+		if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+			return err
+		}
+
+		return repos.WithTx(ctx, func(repos Repositories) error { return nil })
+	})
+	assertEqual(t, ErrNestedTx, err)
+
+	assertNoError(t, s.WithTx(ctx, func(repos Repositories) error {
+		_, err := repos.Anchors.AddAnchor(ctx, testAnchor)
+		return err
+	}))
+
+	anchors, err := s.Anchors.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+	assertEqual(t, testAnchor.URL, anchors[0].URL)
+}
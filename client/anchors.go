@@ -0,0 +1,303 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// Media types of the two kinds of patch PATCH /anchor/{id} accepts.
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// AddAnchor creates an anchor and returns its ID.
+func (c *Client) AddAnchor(ctx context.Context, a junkboy.Anchor) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPrefix + "/anchor", body: a}, &resp)
+
+	return resp.ID, err
+}
+
+func (c *Client) GetAnchor(ctx context.Context, id int) (junkboy.Anchor, error) {
+	var a junkboy.Anchor
+	err := c.getJSON(ctx, anchorPath(id), nil, &a)
+
+	return a, err
+}
+
+// GetAnchors returns every anchor in one response. Anchors iterates over
+// them a page at a time.
+func (c *Client) GetAnchors(ctx context.Context) ([]junkboy.Anchor, error) {
+	var anchors []junkboy.Anchor
+	err := c.getJSON(ctx, apiPrefix+"/anchors", nil, &anchors)
+
+	return anchors, err
+}
+
+// ListAnchors returns up to limit anchors with an ID greater than after,
+// in ID order.
+func (c *Client) ListAnchors(ctx context.Context, after, limit int) ([]junkboy.Anchor, error) {
+	query := url.Values{}
+	query.Set("after", strconv.Itoa(after))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var anchors []junkboy.Anchor
+	err := c.getJSON(ctx, apiPrefix+"/anchors", query, &anchors)
+
+	return anchors, err
+}
+
+// AnchorIterator goes through the anchors in ID order, fetching a page at
+// a time:
+//
+//	it := c.Anchors(ctx, 0)
+//	for it.Next() {
+//		a := it.Anchor()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type AnchorIterator struct {
+	pager
+
+	page   []junkboy.Anchor
+	anchor junkboy.Anchor
+}
+
+// Anchors returns an iterator over every anchor, fetching pageSize at a
+// time, or DefaultPageSize if pageSize is 0.
+func (c *Client) Anchors(ctx context.Context, pageSize int) *AnchorIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	return &AnchorIterator{pager: pager{c: c, ctx: ctx, next: fmt.Sprintf("%s/anchors?after=0&limit=%d", apiPrefix, pageSize)}}
+}
+
+// Next moves to the next anchor, and reports whether there was one.
+func (it *AnchorIterator) Next() bool {
+	for len(it.page) == 0 {
+		it.page = nil
+		if !it.fetch(&it.page) {
+			return false
+		}
+	}
+
+	it.anchor, it.page = it.page[0], it.page[1:]
+
+	return true
+}
+
+// Anchor returns the anchor Next moved to.
+func (it *AnchorIterator) Anchor() junkboy.Anchor {
+	return it.anchor
+}
+
+// UpdateAnchor replaces the anchor a.ID and returns it with its new
+// version. Unless a.Version is 0, the update only happens if the anchor is
+// still at that version.
+func (c *Client) UpdateAnchor(ctx context.Context, a junkboy.Anchor) (junkboy.Anchor, error) {
+	resp, err := c.do(ctx, request{method: http.MethodPut, path: apiPrefix + "/anchor", body: a})
+	if err != nil {
+		return a, err
+	}
+
+	if err := decodeResponse(resp, nil); err != nil {
+		return a, err
+	}
+
+	a.Version = etagVersion(resp.Header.Get("ETag"))
+
+	return a, nil
+}
+
+// PatchAnchor changes the anchor id with a JSON Merge Patch (RFC 7396),
+// such as map[string]interface{}{"url": "https://example.com"}, and returns
+// the result. Unless version is 0, the patch is only applied if the anchor
+// is still at that version.
+func (c *Client) PatchAnchor(ctx context.Context, id, version int, patch interface{}) (junkboy.Anchor, error) {
+	return c.patchAnchor(ctx, id, version, mergePatchMediaType, patch)
+}
+
+// JSONPatchOperation is one operation of a JSON Patch (RFC 6902).
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// JSONPatchAnchor changes the anchor id with a JSON Patch (RFC 6902) and
+// returns the result. Unless version is 0, the patch is only applied if
+// the anchor is still at that version.
+func (c *Client) JSONPatchAnchor(ctx context.Context, id, version int, ops []JSONPatchOperation) (junkboy.Anchor, error) {
+	return c.patchAnchor(ctx, id, version, jsonPatchMediaType, ops)
+}
+
+func (c *Client) patchAnchor(ctx context.Context, id, version int, contentType string, patch interface{}) (junkboy.Anchor, error) {
+	var a junkboy.Anchor
+
+	err := c.doJSON(ctx, request{
+		method:      http.MethodPatch,
+		path:        anchorPath(id),
+		header:      ifMatch(version),
+		body:        patch,
+		contentType: contentType,
+	}, &a)
+
+	return a, err
+}
+
+// DeleteAnchor moves the anchor id to the trash. Unless version is 0, it
+// is only deleted if it is still at that version.
+func (c *Client) DeleteAnchor(ctx context.Context, id, version int) error {
+	return c.doJSON(ctx, request{method: http.MethodDelete, path: anchorPath(id), header: ifMatch(version)}, nil)
+}
+
+// BulkResult is the outcome of one operation of a Bulk call, with the
+// status the single-anchor endpoint would have answered with.
+type BulkResult struct {
+	Status  int    `json:"status"`
+	ID      int    `json:"id,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Err returns the operation's failure as an *Error, or nil if it
+// succeeded.
+func (r BulkResult) Err() error {
+	if r.Status < 400 {
+		return nil
+	}
+
+	return &Error{StatusCode: r.Status, Message: r.Error}
+}
+
+// Bulk runs a batch of creates, updates and deletes, all in one
+// transaction or each on its own, and returns the outcome of each at the
+// same index.
+func (c *Client) Bulk(ctx context.Context, ops []junkboy.BulkOperation, transaction bool) ([]BulkResult, error) {
+	body := struct {
+		Mode       string                  `json:"mode"`
+		Operations []junkboy.BulkOperation `json:"operations"`
+	}{Mode: "best-effort", Operations: ops}
+
+	if transaction {
+		body.Mode = "transaction"
+	}
+
+	var resp struct {
+		Results []BulkResult `json:"results"`
+	}
+
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPrefix + "/anchors/bulk", body: body}, &resp)
+
+	return resp.Results, err
+}
+
+// ListRevisions returns the revisions of the anchor id, oldest first.
+func (c *Client) ListRevisions(ctx context.Context, id int) ([]junkboy.Revision, error) {
+	var revisions []junkboy.Revision
+	err := c.getJSON(ctx, anchorPath(id, "revisions"), nil, &revisions)
+
+	return revisions, err
+}
+
+func (c *Client) GetRevision(ctx context.Context, id, number int) (junkboy.Revision, error) {
+	var revision junkboy.Revision
+	err := c.getJSON(ctx, anchorPath(id, "revisions", strconv.Itoa(number)), nil, &revision)
+
+	return revision, err
+}
+
+// DiffRevisions compares the anchor id as revisions from and to left it.
+func (c *Client) DiffRevisions(ctx context.Context, id, from, to int) ([]junkboy.FieldChange, error) {
+	query := url.Values{}
+	query.Set("from", strconv.Itoa(from))
+	query.Set("to", strconv.Itoa(to))
+
+	var resp struct {
+		Changes []junkboy.FieldChange `json:"changes"`
+	}
+
+	err := c.getJSON(ctx, anchorPath(id, "diff"), query, &resp)
+
+	return resp.Changes, err
+}
+
+// RevertAnchor sets the anchor id back to how a revision left it, and
+// returns the result. Unless version is 0, it is only reverted if it is
+// still at that version.
+func (c *Client) RevertAnchor(ctx context.Context, id, number, version int) (junkboy.Anchor, error) {
+	var a junkboy.Anchor
+
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   anchorPath(id, "revert", strconv.Itoa(number)),
+		header: ifMatch(version),
+	}, &a)
+
+	return a, err
+}
+
+// ListTrash returns the anchors in the trash, most recently deleted
+// first.
+func (c *Client) ListTrash(ctx context.Context) ([]junkboy.TrashedAnchor, error) {
+	var anchors []junkboy.TrashedAnchor
+	err := c.getJSON(ctx, apiPrefix+"/trash", nil, &anchors)
+
+	return anchors, err
+}
+
+// RestoreAnchor takes the anchor id out of the trash and returns it.
+func (c *Client) RestoreAnchor(ctx context.Context, id int) (junkboy.Anchor, error) {
+	var a junkboy.Anchor
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: joinPath("trash", strconv.Itoa(id), "restore")}, &a)
+
+	return a, err
+}
+
+// PurgeAnchor permanently deletes the anchor id from the trash.
+func (c *Client) PurgeAnchor(ctx context.Context, id int) error {
+	return c.doJSON(ctx, request{method: http.MethodDelete, path: joinPath("trash", strconv.Itoa(id))}, nil)
+}
+
+// EmptyTrash permanently deletes every anchor in the trash and returns how
+// many there were. It needs the admin token.
+func (c *Client) EmptyTrash(ctx context.Context) (int, error) {
+	var resp struct {
+		Purged int `json:"purged"`
+	}
+
+	err := c.doJSON(ctx, request{method: http.MethodDelete, path: apiPrefix + "/trash"}, &resp)
+
+	return resp.Purged, err
+}
+
+// ifMatch returns the header that makes a change conditional on the
+// anchor being at version, or none if version is 0.
+func ifMatch(version int) http.Header {
+	if version == 0 {
+		return nil
+	}
+
+	return http.Header{"If-Match": {`"` + strconv.Itoa(version) + `"`}}
+}
+
+// etagVersion returns the anchor version an ETag stands for, or 0.
+func etagVersion(etag string) int {
+	version, _ := strconv.Atoi(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`))
+
+	return version
+}
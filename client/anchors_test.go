@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestAnchors(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/1"})
+	assertNoError(t, err)
+
+	a, err := c.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com/1", Version: 1}, a)
+
+	a, err = c.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/2", Version: 1})
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com/2", Version: 2}, a)
+
+	_, err = c.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/3", Version: 1})
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorVersionMismatch))
+
+	a, err = c.PatchAnchor(ctx, id, 2, map[string]interface{}{"url": "https://example.com/3"})
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com/3", Version: 3}, a)
+
+	a, err = c.JSONPatchAnchor(ctx, id, 0, []JSONPatchOperation{{Op: "replace", Path: "/url", Value: "https://example.com/4"}})
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com/4", Version: 4}, a)
+
+	_, err = c.JSONPatchAnchor(ctx, id, 0, []JSONPatchOperation{{Op: "remove", Path: "/url"}})
+
+	var apiErr *Error
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+
+	anchors, err := c.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+	assertEqual(t, a, anchors[0])
+
+	err = c.DeleteAnchor(ctx, id, 3)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorVersionMismatch))
+	assertNoError(t, c.DeleteAnchor(ctx, id, 4))
+
+	_, err = c.GetAnchor(ctx, id)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorNotFound))
+}
+
+func TestAnchorIterator(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	it := c.Anchors(ctx, 2)
+	assertEqual(t, false, it.Next())
+	assertNoError(t, it.Err())
+
+	var ids []int
+
+	for i := 0; i < 5; i++ {
+		id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+
+		ids = append(ids, id)
+	}
+
+	page, err := c.ListAnchors(ctx, ids[1], 2)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(page))
+	assertEqual(t, ids[2], page[0].ID)
+
+	var requests int
+
+	s.wrap = func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		requests++
+		next.ServeHTTP(w, r)
+	}
+
+	it = c.Anchors(ctx, 2)
+	for i := 0; it.Next(); i++ {
+		assertEqual(t, ids[i], it.Anchor().ID)
+		ids[i] = 0
+	}
+
+	assertNoError(t, it.Err())
+	assertEqual(t, 0, ids[4])
+	assertEqual(t, 3, requests)
+
+	s.wrap = func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	it = c.Anchors(ctx, 2)
+	assertEqual(t, false, it.Next())
+	assertError(t, it.Err())
+}
+
+func TestBulk(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	results, err := c.Bulk(ctx, []junkboy.BulkOperation{
+		{Op: "create", URL: "https://example.com/1"},
+		{Op: "update", ID: 99, URL: "https://example.com/2"},
+	}, false)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(results))
+	assertEqual(t, BulkResult{Status: http.StatusCreated, ID: 1, Version: 1}, results[0])
+	assertNoError(t, results[0].Err())
+	assertEqual(t, http.StatusNotFound, results[1].Status)
+	assertEqual(t, true, errors.Is(results[1].Err(), junkboy.ErrAnchorNotFound))
+
+	results, err = c.Bulk(ctx, []junkboy.BulkOperation{
+		{Op: "delete", ID: 1},
+		{Op: "frobnicate"},
+	}, true)
+	assertNoError(t, err)
+	assertEqual(t, http.StatusFailedDependency, results[0].Status)
+	assertEqual(t, http.StatusBadRequest, results[1].Status)
+
+	_, err = c.Bulk(ctx, nil, true)
+	assertError(t, err)
+}
+
+func TestRevisionsAndTrash(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/1"})
+	assertNoError(t, err)
+
+	_, err = c.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/2"})
+	assertNoError(t, err)
+
+	revisions, err := c.ListRevisions(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(revisions))
+
+	revision, err := c.GetRevision(ctx, id, 1)
+	assertNoError(t, err)
+	assertEqual(t, "https://example.com/1", revision.Anchor.URL)
+
+	_, err = c.GetRevision(ctx, id, 9)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrRevisionNotFound))
+
+	changes, err := c.DiffRevisions(ctx, id, 1, 2)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(changes))
+	assertEqual(t, "url", changes[0].Field)
+
+	a, err := c.RevertAnchor(ctx, id, 1, 2)
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com/1", Version: 3}, a)
+
+	_, err = c.RevertAnchor(ctx, id, 1, 2)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorVersionMismatch))
+
+	other, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/other"})
+	assertNoError(t, err)
+	assertNoError(t, c.DeleteAnchor(ctx, id, 0))
+	assertNoError(t, c.DeleteAnchor(ctx, other, 0))
+
+	trash, err := c.ListTrash(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(trash))
+
+	a, err = c.RestoreAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, id, a.ID)
+
+	assertNoError(t, c.PurgeAnchor(ctx, other))
+	err = c.PurgeAnchor(ctx, other)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorNotFound))
+
+	assertNoError(t, c.DeleteAnchor(ctx, id, 0))
+
+	_, err = c.EmptyTrash(ctx)
+	assertError(t, err)
+
+	c.SetToken(testAdminToken)
+
+	n, err := c.EmptyTrash(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, n)
+}
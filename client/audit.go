@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// AuditFilter selects audit entries. Empty fields match every entry, and
+// Resource matches the entries whose resource starts with it.
+type AuditFilter struct {
+	Actor     string
+	Method    string
+	Resource  string
+	Outcome   string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+	// After skips the entries up to and including this sequence number.
+	After int
+}
+
+func (f AuditFilter) query() url.Values {
+	query := url.Values{}
+
+	for key, value := range map[string]string{
+		"actor":      f.Actor,
+		"method":     f.Method,
+		"resource":   f.Resource,
+		"outcome":    f.Outcome,
+		"request_id": f.RequestID,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	if !f.Since.IsZero() {
+		query.Set("since", f.Since.Format(time.RFC3339))
+	}
+
+	if !f.Until.IsZero() {
+		query.Set("until", f.Until.Format(time.RFC3339))
+	}
+
+	if f.After > 0 {
+		query.Set("after", strconv.Itoa(f.After))
+	}
+
+	return query
+}
+
+// AuditIterator goes through audit entries oldest first, fetching a page
+// at a time. It is used like AnchorIterator.
+type AuditIterator struct {
+	pager
+
+	page  []junkboy.AuditEntry
+	entry junkboy.AuditEntry
+}
+
+// AuditEntries returns an iterator over the audit entries matching filter,
+// fetching pageSize at a time, or DefaultPageSize if pageSize is 0. It
+// needs the admin token.
+func (c *Client) AuditEntries(ctx context.Context, filter AuditFilter, pageSize int) *AuditIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	query := filter.query()
+	query.Set("limit", strconv.Itoa(pageSize))
+
+	return &AuditIterator{pager: pager{c: c, ctx: ctx, next: apiPrefix + "/admin/audit?" + query.Encode()}}
+}
+
+// Next moves to the next entry, and reports whether there was one.
+func (it *AuditIterator) Next() bool {
+	for len(it.page) == 0 {
+		it.page = nil
+		if !it.fetch(&it.page) {
+			return false
+		}
+	}
+
+	it.entry, it.page = it.page[0], it.page[1:]
+
+	return true
+}
+
+// Entry returns the entry Next moved to.
+func (it *AuditIterator) Entry() junkboy.AuditEntry {
+	return it.entry
+}
+
+// ExportAudit writes the audit entries matching filter to w as JSON Lines,
+// exactly as the hash chain covers them. It needs the admin token.
+func (c *Client) ExportAudit(ctx context.Context, filter AuditFilter, w io.Writer) error {
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   apiPrefix + "/admin/audit/export",
+		query:  filter.query(),
+		header: http.Header{"Accept": {"application/x-ndjson"}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+// AuditVerification is the result of checking the audit log's hash chain.
+// If it is not valid, Seq is the first entry that breaks the chain and
+// Error says how.
+type AuditVerification struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	Seq     int    `json:"seq,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// VerifyAudit checks the hash chain of the whole audit log. A broken chain
+// is reported in the result, not as an error. It needs the admin token.
+func (c *Client) VerifyAudit(ctx context.Context) (AuditVerification, error) {
+	var v AuditVerification
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: apiPrefix + "/admin/audit/verify"}, http.StatusConflict)
+	if err != nil {
+		return v, err
+	}
+
+	err = decodeResponse(resp, &v)
+
+	return v, err
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestAudit(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+	}
+
+	assertError(t, c.DeleteAnchor(ctx, 42, 0))
+
+	it := c.AuditEntries(ctx, AuditFilter{}, 0)
+	assertEqual(t, false, it.Next())
+	assertError(t, it.Err())
+
+	c.SetToken(testAdminToken)
+
+	var seqs []int
+
+	it = c.AuditEntries(ctx, AuditFilter{Method: http.MethodPost}, 2)
+	for it.Next() {
+		assertEqual(t, "/v1/anchor", it.Entry().Resource)
+		seqs = append(seqs, it.Entry().Seq)
+	}
+
+	assertNoError(t, it.Err())
+	assertEqual(t, 3, len(seqs))
+	assertEqual(t, 3, seqs[2])
+
+	it = c.AuditEntries(ctx, AuditFilter{Outcome: junkboy.AuditFailure}, 0)
+	assertEqual(t, true, it.Next())
+	assertEqual(t, http.StatusNotFound, it.Entry().Status)
+	assertEqual(t, true, it.Next())
+	assertEqual(t, http.StatusUnauthorized, it.Entry().Status)
+	assertEqual(t, false, it.Next())
+
+	it = c.AuditEntries(ctx, AuditFilter{Actor: junkboy.AdminActor, Method: http.MethodGet}, 0)
+	assertEqual(t, true, it.Next())
+	assertEqual(t, "/v1/admin/audit", it.Entry().Resource)
+	assertNoError(t, it.Err())
+
+	var export bytes.Buffer
+	assertNoError(t, c.ExportAudit(ctx, AuditFilter{Method: http.MethodPost, After: 2}, &export))
+	assertEqual(t, 1, strings.Count(export.String(), "\n"))
+
+	v, err := c.VerifyAudit(ctx)
+	assertNoError(t, err)
+	assertEqual(t, true, v.Valid)
+	assertEqual(t, true, v.Entries > 5)
+}
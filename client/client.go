@@ -0,0 +1,337 @@
+// Package client is a Go client for the junkboy API.
+//
+// A Client is safe for concurrent use once configured. Failed requests
+// come back as *Error, which errors.Is matches against the errors of the
+// junkboy package the server answered with, such as
+// junkboy.ErrAnchorNotFound.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default retry policy.
+const (
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// apiPrefix is where the server mounts the API, health endpoints aside.
+const apiPrefix = "/v1"
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	userAgent  string
+
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// New returns a client for the server at baseURL, such as
+// "http://localhost:8080".
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL '%s': scheme must be http or https", baseURL)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		userAgent:  "junkboy-go-client",
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}, nil
+}
+
+// SetHTTPClient sets the client requests are made with. Its Timeout also
+// ends event streams, so leave it at 0 and use contexts for deadlines if
+// the client streams events.
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.httpClient = hc
+}
+
+// SetToken sets the bearer token sent with every request, which the
+// administrative endpoints require.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetUserAgent sets the User-Agent header sent with every request.
+func (c *Client) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// SetRetryPolicy sets how many times a failed request is retried, and the
+// backoff before the first retry, which doubles with each retry up to
+// maxBackoff. A maxRetries of 0 turns retries off.
+func (c *Client) SetRetryPolicy(maxRetries int, backoff, maxBackoff time.Duration) {
+	c.maxRetries = maxRetries
+	c.backoff = backoff
+	c.maxBackoff = maxBackoff
+}
+
+// request is a request to the API, made by do.
+type request struct {
+	method string
+	// path is relative to the base URL and may carry a query.
+	path   string
+	query  url.Values
+	header http.Header
+
+	// body is encoded as JSON with contentType, application/json if
+	// empty.
+	body        interface{}
+	contentType string
+
+	// noRetry is set for requests whose failures are answers in
+	// themselves.
+	noRetry bool
+}
+
+// do makes the request, retrying it according to the retry policy, and
+// returns the response to the last attempt if it succeeded. A status of
+// 400 or above is returned as *Error, unless ok accepts it, in which case
+// the caller gets the response to read.
+func (c *Client) do(ctx context.Context, req request, ok ...int) (*http.Response, error) {
+	var body []byte
+
+	if req.body != nil {
+		js, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+
+		body = js
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+
+		if err == nil && (resp.StatusCode < 400 || acceptsStatus(ok, resp.StatusCode)) {
+			return resp, nil
+		}
+
+		if err == nil {
+			err = decodeError(resp)
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if req.noRetry || attempt >= c.maxRetries || !retryable(req.method, err) {
+			return nil, err
+		}
+
+		if err := sleep(ctx, c.retryDelay(attempt, err)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := c.url(req.path)
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+
+	if body != nil {
+		contentType := req.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	httpReq.Header.Set("User-Agent", c.userAgent)
+
+	return c.httpClient.Do(httpReq)
+}
+
+// url returns the absolute URL of path, which is relative to the base
+// URL.
+func (c *Client) url(path string) string {
+	u := *c.baseURL
+	u.RawQuery = ""
+
+	return u.String() + path
+}
+
+func acceptsStatus(ok []int, status int) bool {
+	for _, s := range ok {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryable reports whether a request that failed with err may be sent
+// again. 429 and 503 mean the server did not handle the request, so any
+// request is retried. Other server errors and failures to get a response
+// at all may come after the request took effect, so only requests that
+// are safe to repeat are retried.
+func retryable(method string, err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return idempotent(method)
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(method)
+	default:
+		return false
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay is how long to wait before retrying after the given attempt:
+// what Retry-After asks for if the server sent it, or else the backoff
+// doubled for each attempt with up to half of it taken off at random, so
+// that clients that failed together do not retry together.
+func (c *Client) retryDelay(attempt int, err error) time.Duration {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > c.maxBackoff {
+			return c.maxBackoff
+		}
+
+		return apiErr.RetryAfter
+	}
+
+	return backoffDelay(attempt, c.backoff, c.maxBackoff)
+}
+
+func backoffDelay(attempt int, backoff, maxBackoff time.Duration) time.Duration {
+	d := backoff
+	for i := 0; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d, or returns the context's error if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getJSON gets path and decodes the response into v.
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return c.doJSON(ctx, request{method: http.MethodGet, path: path, query: query}, v)
+}
+
+// doJSON makes the request and decodes the response into v, unless v is
+// nil.
+func (c *Client) doJSON(ctx context.Context, req request, v interface{}) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return decodeResponse(resp, v)
+}
+
+// decodeResponse decodes the body of resp into v, unless v is nil, and
+// closes it.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if v == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", resp.Request.URL.Path, err)
+	}
+
+	return nil
+}
+
+// anchorPath returns the API path of the anchor id, followed by elems.
+func anchorPath(id int, elems ...string) string {
+	return joinPath(append([]string{"/anchor", strconv.Itoa(id)}, elems...)...)
+}
+
+func joinPath(elems ...string) string {
+	for i, e := range elems {
+		elems[i] = url.PathEscape(strings.Trim(e, "/"))
+	}
+
+	return apiPrefix + "/" + strings.Join(elems, "/")
+}
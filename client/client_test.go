@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8080", "ftp://example.com", "://"} {
+		_, err := New(baseURL)
+		assertError(t, err)
+	}
+
+	c, err := New("http://example.com/junkboy/")
+	assertNoError(t, err)
+	assertEqual(t, "http://example.com/junkboy/v1/anchor/1", c.url(anchorPath(1)))
+}
+
+func TestErrors(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	_, err := c.GetAnchor(ctx, 42)
+
+	var apiErr *Error
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusNotFound, apiErr.StatusCode)
+	assertEqual(t, "anchor not found", apiErr.Message)
+	assertEqual(t, 32, len(apiErr.RequestID))
+	assertEqual(t, "junkboy: 404 Not Found: anchor not found", err.Error())
+	assertEqual(t, true, errors.Is(err, junkboy.ErrAnchorNotFound))
+	assertEqual(t, false, errors.Is(err, junkboy.ErrRevisionNotFound))
+
+	_, err = c.ListAnchors(ctx, -1, 10)
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusBadRequest, apiErr.StatusCode)
+	assertEqual(t, "invalid after '-1'", apiErr.Message)
+	assertEqual(t, false, errors.Is(err, junkboy.ErrAnchorNotFound))
+}
+
+func TestToken(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	_, err := c.ListSubscriptions(ctx)
+
+	var apiErr *Error
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assertEqual(t, "admin token required", apiErr.Message)
+
+	c.SetToken(testAdminToken)
+
+	subs, err := c.ListSubscriptions(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(subs))
+}
+
+// failing makes the server answer the first n requests with status.
+func failing(s *testServer, n int32, status int, header http.Header) *int32 {
+	var requests int32
+
+	s.wrap = func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if atomic.AddInt32(&requests, 1) <= n {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+
+			w.WriteHeader(status)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return &requests
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Unavailable", func(t *testing.T) {
+		s := newTestServer(t, 100)
+		c := s.client(t)
+		requests := failing(s, 2, http.StatusServiceUnavailable, nil)
+
+		// Even requests that are not safe to repeat are retried, as the
+		// server did not handle them.
+		id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+		assertEqual(t, int32(3), atomic.LoadInt32(requests))
+
+		anchors, err := c.GetAnchors(ctx)
+		assertNoError(t, err)
+		assertEqual(t, 1, len(anchors))
+		assertEqual(t, id, anchors[0].ID)
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		s := newTestServer(t, 100)
+		c := s.client(t)
+		requests := failing(s, 1, http.StatusInternalServerError, nil)
+
+		// The anchor may have been created, so it is not created again.
+		_, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+		assertError(t, err)
+		assertEqual(t, int32(1), atomic.LoadInt32(requests))
+
+		_, err = c.GetAnchors(ctx)
+		assertNoError(t, err)
+		assertEqual(t, int32(2), atomic.LoadInt32(requests))
+	})
+
+	t.Run("Too many requests", func(t *testing.T) {
+		s := newTestServer(t, 100)
+		c := s.client(t)
+		c.SetRetryPolicy(2, time.Millisecond, 50*time.Millisecond)
+		requests := failing(s, 3, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+
+		// Retry-After is capped at the longest backoff.
+		start := time.Now()
+
+		_, err := c.GetAnchors(ctx)
+		assertEqual(t, true, time.Since(start) < time.Second)
+
+		var apiErr *Error
+		assertEqual(t, true, errors.As(err, &apiErr))
+		assertEqual(t, http.StatusTooManyRequests, apiErr.StatusCode)
+		assertEqual(t, time.Second, apiErr.RetryAfter)
+		assertEqual(t, int32(3), atomic.LoadInt32(requests))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := newTestServer(t, 100)
+		c := s.client(t)
+		c.SetRetryPolicy(0, 0, 0)
+		requests := failing(s, 1, http.StatusBadGateway, nil)
+
+		_, err := c.GetAnchors(ctx)
+		assertError(t, err)
+		assertEqual(t, int32(1), atomic.LoadInt32(requests))
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, max := range []time.Duration{100, 200, 400, 500, 500} {
+		d := backoffDelay(attempt, 100, 500)
+		assertEqual(t, true, d >= max/2 && d <= max)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+
+	// Cancelling stops a request in flight...
+	ctx, cancel := context.WithCancel(context.Background())
+	s.wrap = func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		cancel()
+		<-r.Context().Done()
+	}
+
+	_, err := c.GetAnchors(ctx)
+	assertEqual(t, true, errors.Is(err, context.Canceled))
+
+	// ...and retries waiting to happen.
+	c.SetRetryPolicy(5, time.Hour, time.Hour)
+	failing(s, 1, http.StatusServiceUnavailable, nil)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = c.GetAnchors(ctx)
+	assertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestHealth(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	ctx := context.Background()
+
+	assertNoError(t, c.Health(ctx))
+
+	info, err := c.Version(ctx)
+	assertNoError(t, err)
+	assertEqual(t, "v1.2.3", info.Version)
+	assertEqual(t, "abc123", info.Revision)
+
+	s.health.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+
+	ready, err := c.Ready(ctx)
+	assertNoError(t, err)
+	assertEqual(t, "ok", ready.Status)
+	assertEqual(t, "ok", ready.Checks["database"])
+
+	s.health.Drain()
+
+	ready, err = c.Ready(ctx)
+	assertNoError(t, err)
+	assertEqual(t, "draining", ready.Status)
+}
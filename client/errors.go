@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// maxErrorBodyBytes is as much of an error response as is read.
+const maxErrorBodyBytes = 64 << 10
+
+// Error is a response with a status of 400 or above, carrying the message
+// of the junkboy.ErrorResponse in its body.
+type Error struct {
+	StatusCode int
+	Message    string
+	// RequestID is the ID the server logged the request under.
+	RequestID string
+	// RetryAfter is how long the server asked the client to wait before
+	// trying again, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("junkboy: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// sentinelErrors are the errors of the junkboy package that the server
+// reports by their message.
+var sentinelErrors = []error{
+	junkboy.ErrAnchorNotFound,
+	junkboy.ErrAnchorVersionMismatch,
+	junkboy.ErrRevisionNotFound,
+	junkboy.ErrWebhookNotFound,
+	junkboy.ErrDeliveryNotFound,
+}
+
+// Is reports whether the server failed the request with target, so that
+// errors.Is(err, junkboy.ErrAnchorNotFound) works as it does on the
+// server. An expired sync token matches junkboy.ErrEventsExpired.
+func (e *Error) Is(target error) bool {
+	if target == junkboy.ErrEventsExpired {
+		return e.StatusCode == http.StatusGone
+	}
+
+	// Transactions are reported as unsupported in words of their own.
+	if target == junkboy.ErrTxUnsupported {
+		return e.StatusCode == http.StatusNotImplemented
+	}
+
+	for _, s := range sentinelErrors {
+		if target == s {
+			return e.Message == s.Error()
+		}
+	}
+
+	return false
+}
+
+// decodeError returns the *Error for a failed response, and closes its
+// body. A body that is not an ErrorResponse, from a proxy say, is used as
+// the message as it is.
+func decodeError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var errResp junkboy.ErrorResponse
+	if json.Unmarshal(body, &errResp) == nil && errResp.Message != "" {
+		e.Message = errResp.Message
+	} else {
+		e.Message = string(body)
+	}
+
+	return e
+}
+
+// retryAfter parses a Retry-After header, in seconds or as a date.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,257 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// EventsOptions chooses where an event stream starts and which events it
+// carries.
+type EventsOptions struct {
+	// LastEventID starts the stream after this event. If it is 0 the
+	// stream starts with the next event, or with the oldest event the
+	// server keeps if FromStart is set.
+	LastEventID int
+	FromStart   bool
+
+	// Types are the event types to receive, all of them if empty.
+	Types []string
+	// Actor only lets through the events caused by this actor.
+	Actor string
+}
+
+// EventStream reads anchor events from the server as they happen. It
+// reconnects if the connection drops, resuming after the last event it
+// read, and ends when its context is done or it is closed. It is used like
+// AnchorIterator:
+//
+//	s, err := c.Events(ctx, client.EventsOptions{})
+//	...
+//	defer s.Close()
+//	for s.Next() {
+//		e := s.Event()
+//		...
+//	}
+type EventStream struct {
+	c      *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   EventsOptions
+
+	body   io.ReadCloser
+	reader *bufio.Reader
+
+	// lastID is the ID of the last event read, 0 before the first.
+	lastID int
+	// drops is how many times in a row the stream has dropped without an
+	// event, which the wait before reconnecting grows with.
+	drops int
+
+	event  junkboy.LoggedEvent
+	reset  bool
+	err    error
+	closed int32
+}
+
+// Events opens a stream of anchor events.
+func (c *Client) Events(ctx context.Context, opts EventsOptions) (*EventStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s := &EventStream{c: c, ctx: ctx, cancel: cancel, opts: opts, lastID: opts.LastEventID}
+
+	if err := s.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect opens the stream where it left off, or where the options say
+// before it has read anything.
+func (s *EventStream) connect() error {
+	query := url.Values{}
+	if len(s.opts.Types) > 0 {
+		query.Set("types", strings.Join(s.opts.Types, ","))
+	}
+
+	if s.opts.Actor != "" {
+		query.Set("actor", s.opts.Actor)
+	}
+
+	header := http.Header{"Accept": {"text/event-stream"}}
+	if s.lastID > 0 || s.opts.FromStart {
+		header.Set("Last-Event-ID", strconv.Itoa(s.lastID))
+	}
+
+	resp, err := s.c.do(s.ctx, request{method: http.MethodGet, path: apiPrefix + "/events", query: query, header: header})
+	if err != nil {
+		return err
+	}
+
+	if mediaType := resp.Header.Get("Content-Type"); !strings.HasPrefix(mediaType, "text/event-stream") {
+		resp.Body.Close()
+		return fmt.Errorf("expected an event stream, got '%s'", mediaType)
+	}
+
+	s.body = resp.Body
+	s.reader = bufio.NewReader(resp.Body)
+
+	return nil
+}
+
+// Next waits for the next event, and reports whether there was one before
+// the stream ended.
+func (s *EventStream) Next() bool {
+	for {
+		if s.err != nil || atomic.LoadInt32(&s.closed) == 1 {
+			return false
+		}
+
+		if s.body == nil {
+			if err := s.reconnect(); err != nil {
+				s.fail(err)
+				return false
+			}
+		}
+
+		id, eventType, data, err := s.read()
+		if err != nil {
+			s.body.Close()
+			s.body = nil
+
+			continue
+		}
+
+		if id == "" {
+			continue
+		}
+
+		s.drops = 0
+
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			s.fail(fmt.Errorf("invalid event id '%s'", id))
+			return false
+		}
+
+		s.lastID = n
+		s.reset = eventType == "reset"
+
+		if s.reset {
+			s.event = junkboy.LoggedEvent{ID: n}
+			return true
+		}
+
+		var e junkboy.LoggedEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			s.fail(fmt.Errorf("failed to decode event %d: %w", n, err))
+			return false
+		}
+
+		s.event = e
+
+		return true
+	}
+}
+
+// reconnect opens the stream again after it dropped, waiting longer each
+// time it drops without an event in between.
+func (s *EventStream) reconnect() error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := sleep(s.ctx, backoffDelay(s.drops, s.c.backoff, s.c.maxBackoff)); err != nil {
+		return err
+	}
+
+	s.drops++
+
+	return s.connect()
+}
+
+// fail ends the stream with err, unless it was closed, which is not an
+// error.
+func (s *EventStream) fail(err error) {
+	if atomic.LoadInt32(&s.closed) == 0 {
+		s.err = err
+	}
+
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+	}
+
+	s.cancel()
+}
+
+// read reads up to the end of the next event. Comments and fields without
+// an ID, like retry, come back with an empty id.
+func (s *EventStream) read() (id, eventType, data string, err error) {
+	var dataLines []string
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return "", "", "", err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return id, eventType, strings.Join(dataLines, "\n"), nil
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			eventType = value
+		case "data":
+			dataLines = append(dataLines, value)
+		}
+	}
+}
+
+// Event returns the event Next moved to.
+func (s *EventStream) Event() junkboy.LoggedEvent {
+	return s.event
+}
+
+// Reset reports whether, instead of an event, Next moved to a notice that
+// the stream fell so far behind that the events it missed have expired.
+// Event then only has the ID the stream carries on from, and whatever the
+// events were being used to keep current should be reloaded.
+func (s *EventStream) Reset() bool {
+	return s.reset
+}
+
+// Err returns the error that ended the stream, if any. Closing the stream
+// is not an error.
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+// Close ends the stream. It may be called while another goroutine waits
+// in Next, which then returns false.
+func (s *EventStream) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	s.cancel()
+
+	return nil
+}
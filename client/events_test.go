@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestEvents(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/1"})
+	assertNoError(t, err)
+
+	// The first connection is dropped after its first event.
+	var (
+		mu          sync.Mutex
+		drop        context.CancelFunc
+		lastEventID []string
+	)
+
+	s.wrap = func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.URL.Path != "/v1/events" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mu.Lock()
+		lastEventID = append(lastEventID, r.Header.Get("Last-Event-ID"))
+
+		if drop == nil {
+			var ctx context.Context
+			ctx, drop = context.WithCancel(r.Context())
+			r = r.WithContext(ctx)
+		}
+		mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	}
+
+	stream, err := c.Events(ctx, EventsOptions{FromStart: true, Types: []string{junkboy.AnchorCreated, junkboy.AnchorUpdated}})
+	assertNoError(t, err)
+	defer stream.Close()
+
+	assertEqual(t, true, stream.Next())
+	assertEqual(t, false, stream.Reset())
+	assertEqual(t, 1, stream.Event().ID)
+	assertEqual(t, junkboy.AnchorCreated, stream.Event().Type)
+	assertEqual(t, "https://example.com/1", stream.Event().Anchor.URL)
+
+	mu.Lock()
+	drop()
+	mu.Unlock()
+
+	_, err = c.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/2"})
+	assertNoError(t, err)
+	assertNoError(t, c.DeleteAnchor(ctx, id, 0))
+	_, err = c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/3"})
+	assertNoError(t, err)
+
+	// The stream resumes where it left off, skipping the deletion.
+	assertEqual(t, true, stream.Next())
+	assertEqual(t, 2, stream.Event().ID)
+	assertEqual(t, junkboy.AnchorUpdated, stream.Event().Type)
+
+	assertEqual(t, true, stream.Next())
+	assertEqual(t, 4, stream.Event().ID)
+
+	mu.Lock()
+	assertEqual(t, 2, len(lastEventID))
+	assertEqual(t, "0", lastEventID[0])
+	assertEqual(t, "1", lastEventID[1])
+	mu.Unlock()
+
+	// Closing the stream ends a Next that is waiting.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		stream.Close()
+	}()
+
+	assertEqual(t, false, stream.Next())
+	assertNoError(t, stream.Err())
+}
+
+func TestEventsReset(t *testing.T) {
+	s := newTestServer(t, 1)
+	c := s.client(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		_, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+	}
+
+	stream, err := c.Events(ctx, EventsOptions{LastEventID: 1})
+	assertNoError(t, err)
+	defer stream.Close()
+
+	assertEqual(t, true, stream.Next())
+	assertEqual(t, true, stream.Reset())
+	assertEqual(t, 3, stream.Event().ID)
+
+	_, err = c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	assertEqual(t, true, stream.Next())
+	assertEqual(t, false, stream.Reset())
+	assertEqual(t, 4, stream.Event().ID)
+}
+
+func TestEventsErrors(t *testing.T) {
+	s := newTestServer(t, 10)
+	c := s.client(t)
+
+	_, err := c.Events(context.Background(), EventsOptions{Types: []string{"anchor.read"}})
+
+	var apiErr *Error
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, "unknown event type 'anchor.read'", apiErr.Message)
+
+	// A stream whose context ends reports why.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	stream, err := c.Events(ctx, EventsOptions{})
+	assertNoError(t, err)
+
+	assertEqual(t, false, stream.Next())
+	assertEqual(t, true, errors.Is(stream.Err(), context.DeadlineExceeded))
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// Health checks that the server is up.
+func (c *Client) Health(ctx context.Context) error {
+	return c.doJSON(ctx, request{method: http.MethodGet, path: "/healthz", noRetry: true}, nil)
+}
+
+// Readiness is whether the server is ready to serve, with the outcome of
+// each of its checks.
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Ready reports whether the server is ready to serve. A server that is not
+// ready, with a Status of "draining" or "failing", is reported in the
+// result, not as an error.
+func (c *Client) Ready(ctx context.Context) (Readiness, error) {
+	var r Readiness
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/readyz", noRetry: true}, http.StatusServiceUnavailable)
+	if err != nil {
+		return r, err
+	}
+
+	err = decodeResponse(resp, &r)
+
+	return r, err
+}
+
+// Version returns the build information of the server.
+func (c *Client) Version(ctx context.Context) (junkboy.BuildInfo, error) {
+	var info junkboy.BuildInfo
+	err := c.getJSON(ctx, "/version", nil, &info)
+
+	return info, err
+}
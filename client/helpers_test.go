@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: \n"+
+			"%+v", err)
+	}
+}
+
+func assertError(t *testing.T, err error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+}
+
+func assertEqual(t *testing.T, expected, got interface{}) {
+	t.Helper()
+
+	if expected != got {
+		t.Fatalf("Not equal: \n"+
+			"expected: %+v\n"+
+			"got: %+v", expected, got)
+	}
+}
+
+const testAdminToken = "s3cret"
+
+// testServer is the API as jbd serves it, over an in-memory store.
+type testServer struct {
+	anchors  *junkboy.AnchorService
+	events   *junkboy.EventLog
+	webhooks *junkboy.Webhooks
+	audit    *junkboy.AuditMemoryLog
+	stream   *junkboy.EventStreamHandler
+	health   *junkboy.HealthHandler
+
+	// wrap, if set, wraps the API handler for each request.
+	wrap func(w http.ResponseWriter, r *http.Request, next http.Handler)
+
+	server *httptest.Server
+}
+
+func newTestServer(t *testing.T, maxEvents int) *testServer {
+	t.Helper()
+
+	s := &testServer{
+		anchors: junkboy.NewAnchorServiceWithRepositories(junkboy.NewMemoryStore().Repositories()),
+		audit:   junkboy.NewAuditMemoryLog(),
+		health:  junkboy.NewHealthHandler(junkboy.NewBuildInfo("v1.2.3", "abc123", "")),
+	}
+
+	s.anchors.SetMaxEvents(maxEvents)
+	s.events = junkboy.NewEventLog(s.anchors)
+
+	var err error
+
+	s.webhooks, err = junkboy.NewWebhooks(context.Background(), s.events, filepath.Join(t.TempDir(), "webhooks.jsonl"))
+	assertNoError(t, err)
+	t.Cleanup(func() { s.webhooks.Close() })
+
+	s.stream = junkboy.NewEventStreamHandler(s.events)
+	t.Cleanup(s.stream.Close)
+
+	router := junkboy.NewRouter("/v1")
+	anchorHandler := junkboy.NewAnchorHTTPHandler(s.anchors)
+	anchorHandler.SetAdminToken(testAdminToken)
+	anchorHandler.RegisterRoutes(router)
+	junkboy.NewAuditHTTPHandler(s.audit, testAdminToken).RegisterRoutes(router)
+	junkboy.NewWebhookHTTPHandler(s.webhooks, testAdminToken).RegisterRoutes(router)
+	s.stream.RegisterRoutes(router)
+	junkboy.NewSyncHTTPHandler(junkboy.NewSyncService(s.anchors, s.events)).RegisterRoutes(router)
+
+	var api http.Handler = router
+	api = junkboy.NewCorsMiddleware(api)
+	api = junkboy.NewRecoveryMiddleware(api, nil)
+	api = junkboy.NewAuditMiddleware(api, s.audit)
+	api = junkboy.NewActorMiddleware(api, testAdminToken, "")
+	api = junkboy.NewRequestIDMiddleware(api)
+
+	ops := junkboy.NewRouter("")
+	s.health.RegisterRoutes(ops)
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.wrap != nil {
+			s.wrap(w, r, api)
+			return
+		}
+
+		api.ServeHTTP(w, r)
+	}))
+	mux.Handle("/", ops)
+
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// client returns a client for the server that retries quickly.
+func (s *testServer) client(t *testing.T) *Client {
+	t.Helper()
+
+	c, err := New(s.server.URL)
+	assertNoError(t, err)
+
+	c.SetRetryPolicy(DefaultMaxRetries, time.Millisecond, 10*time.Millisecond)
+
+	return c
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultPageSize is how many items iterators fetch at a time unless told
+// otherwise.
+const DefaultPageSize = 100
+
+// pager fetches the pages of a list one at a time, following the next
+// links the server sends with full pages.
+type pager struct {
+	c   *Client
+	ctx context.Context
+
+	// next is the path and query of the next page, empty once there are
+	// no more.
+	next string
+	err  error
+}
+
+// fetch decodes the next page into v, and reports whether there was one.
+func (p *pager) fetch(v interface{}) bool {
+	if p.err != nil || p.next == "" {
+		return false
+	}
+
+	resp, err := p.c.do(p.ctx, request{method: http.MethodGet, path: p.next})
+	p.next = ""
+
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	next := nextLink(resp.Header.Get("Link"))
+
+	if err := decodeResponse(resp, v); err != nil {
+		p.err = err
+		return false
+	}
+
+	p.next = next
+
+	return true
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (p *pager) Err() error {
+	return p.err
+}
+
+// nextLink returns the target of the rel="next" link in a Link header.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// SyncChanges returns what changed since token, or every anchor if token
+// is 0, reading at most limit events, or as many as the server allows if
+// limit is 0. Fetch again with the returned token while More is set. A
+// token too old to catch up from fails with an error matching
+// junkboy.ErrEventsExpired, after which the client syncs again from 0.
+func (c *Client) SyncChanges(ctx context.Context, token, limit int) (junkboy.SyncChanges, error) {
+	query := url.Values{}
+	if token > 0 {
+		query.Set("token", strconv.Itoa(token))
+	}
+
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var changes junkboy.SyncChanges
+	err := c.getJSON(ctx, apiPrefix+"/sync", query, &changes)
+
+	return changes, err
+}
+
+// UploadChanges applies changes made offline and returns the outcome of
+// each at the same index. Conflicts are reported in the results, not as
+// errors.
+func (c *Client) UploadChanges(ctx context.Context, changes []junkboy.SyncChange) ([]junkboy.SyncResult, error) {
+	body := struct {
+		Changes []junkboy.SyncChange `json:"changes"`
+	}{changes}
+
+	var resp struct {
+		Results []junkboy.SyncResult `json:"results"`
+	}
+
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPrefix + "/sync", body: body}, &resp)
+
+	return resp.Results, err
+}
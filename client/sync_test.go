@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestSync(t *testing.T) {
+	s := newTestServer(t, 2)
+	c := s.client(t)
+	ctx := context.Background()
+
+	id, err := c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/1"})
+	assertNoError(t, err)
+
+	full, err := c.SyncChanges(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, true, full.Full)
+	assertEqual(t, 1, len(full.Changes))
+
+	results, err := c.UploadChanges(ctx, []junkboy.SyncChange{
+		{Op: "update", ID: id, URL: "https://example.com/2", BaseVersion: 1},
+		{Op: "create", ClientID: "new", URL: "https://example.com/new"},
+	})
+	assertNoError(t, err)
+	assertEqual(t, junkboy.SyncApplied, results[0].Status)
+	assertEqual(t, "new", results[1].ClientID)
+
+	delta, err := c.SyncChanges(ctx, full.Token, 1)
+	assertNoError(t, err)
+	assertEqual(t, true, delta.More)
+	assertEqual(t, "https://example.com/2", delta.Changes[0].Anchor.URL)
+
+	// Only the last two events are kept, so the first token has expired.
+	_, err = c.UploadChanges(ctx, []junkboy.SyncChange{{Op: "delete", ID: id, BaseVersion: 2}})
+	assertNoError(t, err)
+
+	_, err = c.SyncChanges(ctx, full.Token, 0)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrEventsExpired))
+
+	_, err = c.UploadChanges(ctx, nil)
+	assertError(t, err)
+}
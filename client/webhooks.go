@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// The webhook endpoints all need the admin token.
+
+// Subscribe creates a webhook subscription. The result is the only time
+// the subscription's secret is returned.
+func (c *Client) Subscribe(ctx context.Context, sub junkboy.WebhookSubscription) (junkboy.WebhookSubscription, error) {
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: apiPrefix + "/webhooks", body: sub}, &sub)
+
+	return sub, err
+}
+
+// ListSubscriptions returns the webhook subscriptions, without their
+// secrets.
+func (c *Client) ListSubscriptions(ctx context.Context) ([]junkboy.WebhookSubscription, error) {
+	var subs []junkboy.WebhookSubscription
+	err := c.getJSON(ctx, apiPrefix+"/webhooks", nil, &subs)
+
+	return subs, err
+}
+
+func (c *Client) GetSubscription(ctx context.Context, id int) (junkboy.WebhookSubscription, error) {
+	var sub junkboy.WebhookSubscription
+	err := c.getJSON(ctx, joinPath("webhooks", strconv.Itoa(id)), nil, &sub)
+
+	return sub, err
+}
+
+func (c *Client) DeleteSubscription(ctx context.Context, id int) error {
+	return c.doJSON(ctx, request{method: http.MethodDelete, path: joinPath("webhooks", strconv.Itoa(id))}, nil)
+}
+
+// ListDeliveries returns the delivery log of the subscription id, newest
+// first.
+func (c *Client) ListDeliveries(ctx context.Context, id int) ([]junkboy.WebhookDelivery, error) {
+	var deliveries []junkboy.WebhookDelivery
+	err := c.getJSON(ctx, joinPath("webhooks", strconv.Itoa(id), "deliveries"), nil, &deliveries)
+
+	return deliveries, err
+}
+
+// Redeliver queues a delivery of the subscription id to be posted again,
+// and returns the new delivery.
+func (c *Client) Redeliver(ctx context.Context, id, deliveryID int) (junkboy.WebhookDelivery, error) {
+	var delivery junkboy.WebhookDelivery
+
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   joinPath("webhooks", strconv.Itoa(id), "deliveries", strconv.Itoa(deliveryID), "redeliver"),
+	}, &delivery)
+
+	return delivery, err
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t, 100)
+	c := s.client(t)
+	c.SetToken(testAdminToken)
+	ctx := context.Background()
+
+	_, err := c.Subscribe(ctx, junkboy.WebhookSubscription{URL: "https://example.com/hook"})
+
+	var apiErr *Error
+	assertEqual(t, true, errors.As(err, &apiErr))
+	assertEqual(t, http.StatusBadRequest, apiErr.StatusCode)
+	assertEqual(t, "events must not be empty", apiErr.Message)
+
+	sub, err := c.Subscribe(ctx, junkboy.WebhookSubscription{URL: "https://example.com/hook", Events: []string{junkboy.AnchorCreated}})
+	assertNoError(t, err)
+	assertEqual(t, 64, len(sub.Secret))
+
+	got, err := c.GetSubscription(ctx, sub.ID)
+	assertNoError(t, err)
+	assertEqual(t, "", got.Secret)
+	assertEqual(t, sub.URL, got.URL)
+
+	subs, err := c.ListSubscriptions(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(subs))
+
+	_, err = c.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	deliveries, err := c.ListDeliveries(ctx, sub.ID)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(deliveries))
+	assertEqual(t, junkboy.DeliveryPending, deliveries[0].State)
+
+	redelivery, err := c.Redeliver(ctx, sub.ID, deliveries[0].ID)
+	assertNoError(t, err)
+	assertEqual(t, deliveries[0].ID, redelivery.RedeliveryOf)
+
+	_, err = c.Redeliver(ctx, sub.ID, 99)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrDeliveryNotFound))
+
+	assertNoError(t, c.DeleteSubscription(ctx, sub.ID))
+
+	_, err = c.GetSubscription(ctx, sub.ID)
+	assertEqual(t, true, errors.Is(err, junkboy.ErrWebhookNotFound))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "jbd.toml", `
+[database]
+dsn = "file.db"
+
+[http]
+addr = ":9000"
+read_timeout = "1s"
+write_timeout = "2s"
+`)
+
+	t.Setenv("JUNKBOY_HTTP_ADDR", ":9001")
+	t.Setenv("JUNKBOY_HTTP_READ_TIMEOUT", "3s")
+
+	cfg, err := loadConfig("test", []string{"-config", path, "-http.addr", ":9002"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.Database.DSN != "file.db" {
+		t.Errorf("expected dsn from file, got %q", cfg.Database.DSN)
+	}
+
+	if cfg.HTTP.WriteTimeout.Duration != 2*time.Second {
+		t.Errorf("expected write timeout from file, got %s", cfg.HTTP.WriteTimeout)
+	}
+
+	if cfg.HTTP.ReadTimeout.Duration != 3*time.Second {
+		t.Errorf("expected read timeout from env, got %s", cfg.HTTP.ReadTimeout)
+	}
+
+	if cfg.HTTP.Addr != ":9002" {
+		t.Errorf("expected addr from flag, got %q", cfg.HTTP.Addr)
+	}
+
+	if cfg.HTTP.IdleTimeout != defaultConfig().HTTP.IdleTimeout {
+		t.Errorf("expected default idle timeout, got %s", cfg.HTTP.IdleTimeout)
+	}
+}
+
+func TestLoadConfigStorage(t *testing.T) {
+	cfg, err := loadConfig("test", []string{"--storage=memory", "-database.dsn", ""})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.Database.Driver != "memory" {
+		t.Errorf("expected memory driver, got %q", cfg.Database.Driver)
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := writeConfigFile(t, "jbd.yaml", "http:\n  idle_timeout: 1m\n")
+
+	cfg, err := loadConfig("test", []string{"--config=" + path})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.HTTP.IdleTimeout.Duration != time.Minute {
+		t.Errorf("expected idle timeout from file, got %s", cfg.HTTP.IdleTimeout)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		errText string
+	}{
+		{
+			name:    "Unknown key",
+			file:    "jbd.toml",
+			content: "[http]\nport = 80\n",
+			errText: "unknown key http.port",
+		},
+		{
+			name:    "Unknown extension",
+			file:    "jbd.ini",
+			errText: `unsupported extension ".ini"`,
+		},
+		{
+			name:    "Bad duration",
+			args:    []string{"-http.read-timeout", "soon"},
+			errText: `"soon" is not a duration`,
+		},
+		{
+			name:    "Invalid values",
+			args:    []string{"-http.addr", "nope", "-database.dsn", ""},
+			errText: "invalid configuration:\n  database.dsn must not be empty\n  http.addr \"nope\" must be host:port or :port",
+		},
+		{
+			name:    "Unknown driver",
+			args:    []string{"-database.driver", "mysql"},
+			errText: `database.driver "mysql" must be sqlite, postgres, bolt, files or memory`,
+		},
+		{
+			name:    "Invalid postgres pool",
+			args:    []string{"-database.driver", "postgres", "-postgres.max-idle-conns", "50"},
+			errText: "postgres: max idle connections must be between 0 and max open connections",
+		},
+		{
+			name:    "Invalid bulk limit",
+			args:    []string{"-http.bulk-max-operations", "0"},
+			errText: "http.bulk_max_operations must be positive",
+		},
+		{
+			name:    "Invalid trash purge interval",
+			args:    []string{"-trash.purge-interval", "0s"},
+			errText: "trash.purge_interval must be positive",
+		},
+		{
+			name:    "Webhook backoff above maximum",
+			args:    []string{"-webhooks.backoff", "2h", "-webhooks.max-backoff", "1h"},
+			errText: "webhooks.backoff must be positive and at most webhooks.max_backoff",
+		},
+		{
+			name:    "Invalid event heartbeat",
+			args:    []string{"-events.heartbeat", "0s"},
+			errText: "events.heartbeat must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.file, tt.content)}, args...)
+			}
+
+			_, err := loadConfig("test", args)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Fatalf("expected error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		expected string
+	}{
+		{"junkboy.db", "junkboy.db"},
+		{"postgres://jb:hunter2@db:5432/junkboy", "postgres://jb:REDACTED@db:5432/junkboy"},
+		{"host=db user=jb password=hunter2 dbname=junkboy", "host=db user=jb password=REDACTED dbname=junkboy"},
+	}
+
+	for _, tt := range tests {
+		if got := redactDSN(tt.dsn); got != tt.expected {
+			t.Errorf("redactDSN(%q) = %q, expected %q", tt.dsn, got, tt.expected)
+		}
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Admin.Token = "hunter2"
+
+	if got := cfg.redacted().Admin.Token; got != "REDACTED" {
+		t.Errorf("redacted admin token = %q, expected REDACTED", got)
+	}
+
+	if cfg.Admin.Token != "hunter2" {
+		t.Errorf("redacting changed the original config")
+	}
+}
+
+func TestConfigReloadable(t *testing.T) {
+	old := defaultConfig()
+
+	cfg := defaultConfig()
+	cfg.HTTP.Addr = ":9999"
+	cfg.HTTP.DrainDelay = Duration{time.Second}
+
+	next, ignored := cfg.reloadable(old)
+
+	if next.HTTP.DrainDelay.Duration != time.Second {
+		t.Errorf("expected drain delay to be reloaded, got %s", next.HTTP.DrainDelay)
+	}
+
+	if next.HTTP.Addr != old.HTTP.Addr {
+		t.Errorf("expected addr to be kept, got %q", next.HTTP.Addr)
+	}
+
+	if len(ignored) != 1 || ignored[0] != "http.addr" {
+		t.Errorf("expected http.addr to be ignored, got %v", ignored)
+	}
+}
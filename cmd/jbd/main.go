@@ -1,36 +1,66 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
-
-	"github.com/pmaterer/junkboy"
+	"os"
+)
 
-	_ "github.com/mattn/go-sqlite3"
+// Set at link time, see the Makefile.
+var (
+	version   string
+	revision  string
+	buildTime string
 )
 
+const usage = `Usage: jbd [command] [flags]
+
+Commands:
+  serve          run the server (default)
+  config print   print the effective configuration with secrets redacted
+  migrate        apply or revert schema migrations: up, down, status, to N
+
+Run 'jbd serve -h' to list the configuration flags.
+`
+
 func main() {
-	dbDSN := "junkboy.db"
-	db, err := junkboy.NewSQLiteDB(dbDSN)
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
 
-	if err != nil {
-		log.Fatalf("failed to open db %s: %v", dbDSN, err)
+		log.Fatal(err)
 	}
+}
 
-	anchorRepo := junkboy.NewAnchorSQLiteRepository(db)
-	anchorService := junkboy.NewAnchorService(anchorRepo)
-	anchorHandler := junkboy.NewAnchorHTTPHandler(anchorService)
+func run(args []string) error {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		return serve(args)
+	}
 
-	router := junkboy.NewRouter("/v1")
-	anchorHandler.RegisterRoutes(router)
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "config":
+		if len(args) < 2 || args[1] != "print" {
+			return errors.New("usage: jbd config print [flags]")
+		}
 
-	mw := junkboy.NewCorsMiddleware(junkboy.NewLoggingMiddleware(router))
+		cfg, err := loadConfig("jbd config print", args[2:])
+		if err != nil {
+			return err
+		}
 
-	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: mw,
+		return printConfig(cfg)
+	case "migrate":
+		return migrate(args[1:])
+	case "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
 	}
-
-	log.Printf("Starting server on 127.0.0.1:8080")
-	log.Fatal(srv.ListenAndServe())
 }
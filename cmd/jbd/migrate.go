@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pmaterer/junkboy"
+)
+
+const migrateUsage = "usage: jbd migrate up|down|status|to N [flags]"
+
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	command, args := args[0], args[1:]
+
+	target := 0
+
+	if command == "to" {
+		if len(args) == 0 {
+			return errors.New(migrateUsage)
+		}
+
+		var err error
+
+		target, err = strconv.Atoi(args[0])
+		if err != nil || target < 0 {
+			return fmt.Errorf("invalid migration version %q", args[0])
+		}
+
+		args = args[1:]
+	}
+
+	cfg, err := loadConfig("jbd migrate "+command, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator := db.migrator
+	if migrator == nil {
+		return fmt.Errorf("%s storage has no schema to migrate", cfg.Database.Driver)
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		err = migrator.To(ctx, target)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Database schema is at version %d", version)
+
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, migrator *junkboy.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+
+	for _, s := range statuses {
+		status := "pending"
+		if s.Applied {
+			status = "applied"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+
+	return w.Flush()
+}
+
+// prepareSchema migrates the database on startup if configured to, and
+// refuses to continue unless the schema is at the version the binary
+// expects.
+func prepareSchema(ctx context.Context, cfg Config, migrator *junkboy.Migrator) error {
+	if migrator == nil {
+		return nil
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+	}
+
+	return migrator.CheckVersion(ctx)
+}
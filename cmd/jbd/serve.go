@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// scrapeTimeout bounds the queries behind metrics computed at scrape time.
+const scrapeTimeout = 5 * time.Second
+
+// eventsPath is where the event streams are served, which the write timeout
+// does not apply to.
+const eventsPath = "/v1/events"
+
+// liveConfig holds the configuration of a running server, which SIGHUP
+// may update.
+type liveConfig struct {
+	mu       sync.Mutex
+	cfg      Config
+	args     []string
+	onReload []func(Config)
+}
+
+func (lc *liveConfig) get() Config {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	return lc.cfg
+}
+
+// reload re-reads the config file and environment, reapplying the
+// original flags, and applies the settings that are safe to change.
+func (lc *liveConfig) reload() {
+	cfg, err := loadConfig("jbd", lc.args)
+	if err != nil {
+		log.Printf("Config reload failed, keeping current config: %v", err)
+		return
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	next, ignored := cfg.reloadable(lc.cfg)
+	for _, key := range ignored {
+		log.Printf("Config reload: %s changed but requires a restart", key)
+	}
+
+	lc.cfg = next
+
+	for _, apply := range lc.onReload {
+		apply(next)
+	}
+
+	log.Printf("Config reloaded")
+}
+
+func serve(args []string) error {
+	cfg, err := loadConfig("jbd serve", args)
+	if err != nil {
+		return err
+	}
+
+	live := &liveConfig{cfg: cfg, args: args}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := prepareSchema(context.Background(), cfg, db.migrator); err != nil {
+		return err
+	}
+
+	metrics := junkboy.NewRegistry()
+	for name, pool := range db.pools {
+		metrics.RegisterDBStats(name, pool)
+	}
+
+	jobs := junkboy.NewJobRunner(metrics)
+
+	store, err := db.openStore(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to prepare repositories: %w", err)
+	}
+
+	defer func() {
+		if err := store.close(); err != nil {
+			log.Printf("failed to close repositories: %v", err)
+		}
+	}()
+
+	anchorService := junkboy.NewAnchorServiceWithRepositories(store.repos)
+	anchorService.SetTimeout(cfg.Database.QueryTimeout.Duration)
+	anchorService.SetMaxEvents(cfg.Events.MaxEvents)
+	live.onReload = append(live.onReload, func(cfg Config) {
+		anchorService.SetTimeout(cfg.Database.QueryTimeout.Duration)
+	})
+	if cfg.Trash.Retention.Duration > 0 {
+		jobs.Add(junkboy.NewTrashPurgeJob(anchorService, cfg.Trash.Retention.Duration, cfg.Trash.PurgeInterval.Duration))
+	}
+
+	events := junkboy.NewEventLog(anchorService)
+
+	webhooks, err := junkboy.NewWebhooks(context.Background(), events, cfg.Webhooks.Path)
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	defer func() {
+		if err := webhooks.Close(); err != nil {
+			log.Printf("failed to close webhooks: %v", err)
+		}
+	}()
+
+	webhooks.SetClient(&http.Client{Timeout: cfg.Webhooks.Timeout.Duration})
+	webhooks.SetRetryPolicy(cfg.Webhooks.MaxAttempts, cfg.Webhooks.Backoff.Duration, cfg.Webhooks.MaxBackoff.Duration)
+	webhooks.SetConcurrency(cfg.Webhooks.Concurrency)
+	jobs.Add(junkboy.NewWebhookDeliveryJob(webhooks, cfg.Webhooks.DeliveryInterval.Duration))
+
+	eventStream := junkboy.NewEventStreamHandler(events)
+	eventStream.SetHeartbeat(cfg.Events.Heartbeat.Duration)
+	eventStream.SetWriteTimeout(cfg.Events.WriteTimeout.Duration)
+	live.onReload = append(live.onReload, func(cfg Config) {
+		eventStream.SetHeartbeat(cfg.Events.Heartbeat.Duration)
+		eventStream.SetWriteTimeout(cfg.Events.WriteTimeout.Duration)
+	})
+
+	anchorHandler := junkboy.NewAnchorHTTPHandler(anchorService)
+	anchorHandler.RequireIfMatch(cfg.HTTP.RequireIfMatch)
+	anchorHandler.SetAdminToken(cfg.Admin.Token)
+	anchorHandler.SetBulkLimits(cfg.HTTP.BulkMaxOperations, int64(cfg.HTTP.BulkMaxBodyBytes))
+
+	metrics.GaugeFunc("junkboy_anchors", "Number of anchors stored.", nil, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+		defer cancel()
+
+		count, err := store.count(ctx)
+		if err != nil {
+			return math.NaN()
+		}
+
+		return float64(count)
+	})
+
+	audit, closeAudit, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
+
+	router := junkboy.NewRouter("/v1")
+	anchorHandler.RegisterRoutes(router)
+	junkboy.NewAuditHTTPHandler(audit, cfg.Admin.Token).RegisterRoutes(router)
+	junkboy.NewWebhookHTTPHandler(webhooks, cfg.Admin.Token).RegisterRoutes(router)
+	eventStream.RegisterRoutes(router)
+	syncHandler := junkboy.NewSyncHTTPHandler(junkboy.NewSyncService(anchorService, events))
+	syncHandler.SetUploadLimits(cfg.HTTP.BulkMaxOperations, int64(cfg.HTTP.BulkMaxBodyBytes))
+	syncHandler.RegisterRoutes(router)
+
+	var api http.Handler = router
+	api = junkboy.NewCorsMiddleware(api)
+	recovery := junkboy.NewRecoveryMiddleware(api, nil)
+	api = junkboy.NewAuditMiddleware(recovery, audit)
+	api = junkboy.NewActorMiddleware(api, cfg.Admin.Token, cfg.HTTP.ActorHeader)
+	api = junkboy.NewMetricsMiddleware(api, metrics)
+	api = junkboy.NewLoggingMiddleware(api)
+	api = junkboy.NewRequestIDMiddleware(api)
+
+	metrics.CounterFunc("junkboy_http_panics_total", "Total number of panics recovered while serving requests.", nil,
+		func() float64 { return float64(recovery.Panics()) })
+
+	health := junkboy.NewHealthHandler(junkboy.NewBuildInfo(version, revision, buildTime))
+	health.AddReadinessCheck("database", db.ping)
+	if db.migrator != nil {
+		health.AddReadinessCheck("migrations", db.migrator.CheckVersion)
+	}
+	health.AddReadinessCheck("jobs", func(ctx context.Context) error {
+		if !jobs.Running() {
+			return errors.New("background jobs not running")
+		}
+
+		return nil
+	})
+
+	ops := junkboy.NewRouter("")
+	health.RegisterRoutes(ops)
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", api)
+	mux.Handle("/metrics", metrics)
+	mux.Handle("/", ops)
+
+	srv := newServer(cfg.HTTP, mux)
+	srv.RegisterOnShutdown(eventStream.Close)
+
+	jobs.Start()
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		log.Printf("Starting server on %s", cfg.HTTP.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err := <-serverErr:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				live.reload()
+				continue
+			}
+
+			log.Printf("Received %s, shutting down", sig)
+
+			return shutdown(live.get(), srv, health, jobs)
+		}
+	}
+}
+
+// newServer returns the server for handler. The write timeout is set on
+// each connection as its requests come in rather than as the server's
+// WriteTimeout, so that event streams can stay open for as long as their
+// clients listen; they set deadlines of their own.
+func newServer(cfg HTTPConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           &writeTimeoutHandler{handler: handler, timeout: cfg.WriteTimeout.Duration},
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ConnContext:       junkboy.ConnContext,
+	}
+}
+
+// writeTimeoutHandler gives each response until timeout to be written, as
+// the server's WriteTimeout would, except for event streams, which get no
+// deadline. The deadline is on the connection, so it must be set for every
+// request, including to none.
+type writeTimeoutHandler struct {
+	handler http.Handler
+	timeout time.Duration
+}
+
+func (h *writeTimeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c := junkboy.ConnFromContext(r.Context()); c != nil {
+		var deadline time.Time
+		if h.timeout > 0 && r.URL.Path != eventsPath {
+			deadline = time.Now().Add(h.timeout)
+		}
+
+		if err := c.SetWriteDeadline(deadline); err != nil {
+			log.Printf("failed to set write deadline: %v", err)
+		}
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// auditLog is the audit log as serve uses it.
+type auditLog interface {
+	Append(ctx context.Context, e junkboy.AuditEntry) (junkboy.AuditEntry, error)
+	Entries(ctx context.Context, fn func(junkboy.AuditEntry) error) error
+}
+
+// openAuditLog opens the audit log file, or keeps the log in memory if no
+// path is configured. The returned func closes it.
+func openAuditLog(cfg Config) (auditLog, func(), error) {
+	if cfg.Audit.Path == "" {
+		log.Printf("Audit log kept in memory, entries are lost on restart")
+		return junkboy.NewAuditMemoryLog(), func() {}, nil
+	}
+
+	l, err := junkboy.NewAuditFileLog(cfg.Audit.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return l, func() {
+		if err := l.Close(); err != nil {
+			log.Printf("failed to close audit log: %v", err)
+		}
+	}, nil
+}
+
+// shutdown takes the server out of rotation, waits for in-flight requests
+// and stops background jobs. The deferred closing of the repositories and
+// the database in serve happens after.
+func shutdown(cfg Config, srv *http.Server, health *junkboy.HealthHandler, jobs *junkboy.JobRunner) error {
+	health.Drain()
+	time.Sleep(cfg.HTTP.DrainDelay.Duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout.Duration)
+	defer cancel()
+
+	var shutdownErr error
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("failed to drain connections: %v", err)
+		shutdownErr = err
+	}
+
+	if err := jobs.Stop(ctx); err != nil {
+		log.Printf("failed to stop background jobs: %v", err)
+		shutdownErr = err
+	}
+
+	log.Printf("Shutdown complete")
+
+	return shutdownErr
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+func TestServerWriteTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	anchors := junkboy.NewAnchorService(junkboy.NewAnchorMemoryRepository())
+	events := junkboy.NewEventLog(anchors)
+
+	stream := junkboy.NewEventStreamHandler(events)
+	defer stream.Close()
+
+	router := junkboy.NewRouter("/v1")
+	stream.RegisterRoutes(router)
+	router.AddRoute([]string{"GET"}, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		time.Sleep(3 * timeout)
+		io.WriteString(w, "too late")
+	})
+
+	var cfg HTTPConfig
+	cfg.WriteTimeout.Duration = timeout
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newServer(cfg, router)
+	ts.Start()
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A stream outlives the write timeout...
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+eventsPath, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(3 * timeout)
+
+	if _, err := anchors.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended after the write timeout: %v", err)
+		}
+
+		if line == "id: 1\n" {
+			break
+		}
+	}
+
+	// ...which still applies to other responses.
+	resp, err = http.Get(ts.URL + "/v1/slow")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if b, err := io.ReadAll(resp.Body); err == nil || strings.Contains(string(b), "too late") {
+		t.Errorf("expected the response to be cut off, got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pmaterer/junkboy"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// database is an open database of the configured driver.
+type database struct {
+	// migrator is nil for memory storage, which has no schema.
+	migrator *junkboy.Migrator
+	// pools are the connection pools by name, for metrics.
+	pools map[string]*sql.DB
+	ping  func(ctx context.Context) error
+	close func() error
+
+	openStore func(ctx context.Context) (*store, error)
+}
+
+// store is the set of repositories of a database.
+type store struct {
+	repos junkboy.Repositories
+	count func(ctx context.Context) (int, error)
+	close func() error
+}
+
+func openDatabase(cfg Config) (*database, error) {
+	switch cfg.Database.Driver {
+	case "sqlite":
+		return openSQLiteDatabase(cfg)
+	case "postgres":
+		return openPostgresDatabase(cfg)
+	case "bolt":
+		return openBoltDatabase(cfg)
+	case "files":
+		return openFilesDatabase(cfg), nil
+	case "memory":
+		return openMemoryDatabase(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Database.Driver)
+	}
+}
+
+func openSQLiteDatabase(cfg Config) (*database, error) {
+	db, err := junkboy.NewSQLiteDB(cfg.Database.DSN, cfg.SQLite.options())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %w", redactDSN(cfg.Database.DSN), err)
+	}
+
+	migrator, err := junkboy.NewSQLiteMigrator(db.Write)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &database{
+		migrator: migrator,
+		pools:    map[string]*sql.DB{"write": db.Write, "read": db.Read},
+		ping:     db.PingContext,
+		close:    db.Close,
+		openStore: func(ctx context.Context) (*store, error) {
+			s, err := junkboy.NewSQLiteStore(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+
+			return &store{repos: s.Repositories(), count: s.Anchors.CountAnchors, close: s.Close}, nil
+		},
+	}, nil
+}
+
+func openPostgresDatabase(cfg Config) (*database, error) {
+	db, err := junkboy.NewPostgresDB(cfg.Database.DSN, cfg.Postgres.options())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %w", redactDSN(cfg.Database.DSN), err)
+	}
+
+	migrator, err := junkboy.NewPostgresMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &database{
+		migrator: migrator,
+		pools:    map[string]*sql.DB{"postgres": db},
+		ping:     db.PingContext,
+		close:    db.Close,
+		openStore: func(ctx context.Context) (*store, error) {
+			s, err := junkboy.NewPostgresStore(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+
+			return &store{repos: s.Repositories(), count: s.Anchors.CountAnchors, close: s.Close}, nil
+		},
+	}, nil
+}
+
+// openBoltDatabase opens the bbolt file named by the DSN. Like memory
+// storage it has no schema to migrate.
+func openBoltDatabase(cfg Config) (*database, error) {
+	db, err := junkboy.NewBoltDB(cfg.Database.DSN, cfg.Bolt.options())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %w", cfg.Database.DSN, err)
+	}
+
+	return &database{
+		ping:  func(ctx context.Context) error { return nil },
+		close: db.Close,
+		openStore: func(ctx context.Context) (*store, error) {
+			s := junkboy.NewBoltStore(db)
+
+			return &store{repos: s.Repositories(), count: s.Anchors.CountAnchors, close: s.Close}, nil
+		},
+	}, nil
+}
+
+// openFilesDatabase keeps anchors as files in the directory named by the
+// DSN.
+func openFilesDatabase(cfg Config) *database {
+	return &database{
+		ping: func(ctx context.Context) error {
+			_, err := os.Stat(cfg.Database.DSN)
+			return err
+		},
+		close: func() error { return nil },
+		openStore: func(ctx context.Context) (*store, error) {
+			s, err := junkboy.NewFileStore(cfg.Database.DSN, cfg.Files.options())
+			if err != nil {
+				return nil, err
+			}
+
+			return &store{repos: s.Repositories(), count: s.Anchors.CountAnchors, close: s.Close}, nil
+		},
+	}
+}
+
+// openMemoryDatabase returns storage that lives as long as the process,
+// for demos and tests.
+func openMemoryDatabase() *database {
+	return &database{
+		ping:  func(ctx context.Context) error { return nil },
+		close: func() error { return nil },
+		openStore: func(ctx context.Context) (*store, error) {
+			s := junkboy.NewMemoryStore()
+
+			return &store{repos: s.Repositories(), count: s.Anchors.CountAnchors, close: s.Close}, nil
+		},
+	}
+}
+
+func (db *database) Close() {
+	if err := db.close(); err != nil {
+		log.Printf("failed to close db: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package junkboy_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pmaterer/junkboy"
+	"github.com/pmaterer/junkboy/junkboytest"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAnchorMemoryRepositoryConformance(t *testing.T) {
+	junkboytest.RunAnchorRepositoryTests(t, func(t *testing.T) junkboytest.AnchorRepository {
+		return junkboy.NewAnchorMemoryRepository()
+	})
+}
+
+func TestAnchorSQLiteRepositoryConformance(t *testing.T) {
+	junkboytest.RunAnchorRepositoryTests(t, func(t *testing.T) junkboytest.AnchorRepository {
+		ctx := context.Background()
+
+		db, err := junkboy.NewSQLiteDB(filepath.Join(t.TempDir(), "junkboy.db"), junkboy.DefaultSQLiteOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		m, err := junkboy.NewSQLiteMigrator(db.Write)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := junkboy.NewAnchorSQLiteRepository(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		return r
+	})
+}
+
+func TestAnchorPostgresRepositoryConformance(t *testing.T) {
+	server := junkboy.PostgresTestServer(t)
+
+	junkboytest.RunAnchorRepositoryTests(t, func(t *testing.T) junkboytest.AnchorRepository {
+		ctx := context.Background()
+
+		db, err := junkboy.NewPostgresDB(junkboy.PostgresTestSchema(t, server), junkboy.DefaultPostgresOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		m, err := junkboy.NewPostgresMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := junkboy.NewAnchorPostgresRepository(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		return r
+	})
+}
+
+func TestAnchorBoltRepositoryConformance(t *testing.T) {
+	junkboytest.RunAnchorRepositoryTests(t, func(t *testing.T) junkboytest.AnchorRepository {
+		db, err := junkboy.NewBoltDB(filepath.Join(t.TempDir(), "junkboy.bolt"), junkboy.DefaultBoltOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return junkboy.NewAnchorBoltRepository(db)
+	})
+}
+
+func TestAnchorFileRepositoryConformance(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			junkboytest.RunAnchorRepositoryTests(t, func(t *testing.T) junkboytest.AnchorRepository {
+				r, err := junkboy.NewAnchorFileRepository(t.TempDir(), junkboy.FileOptions{Format: format, Watch: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { r.Close() })
+
+				return r
+			})
+		})
+	}
+}
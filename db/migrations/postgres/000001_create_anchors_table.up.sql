@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS anchors (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    url TEXT NOT NULL
+);
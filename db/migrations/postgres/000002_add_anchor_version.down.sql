@@ -0,0 +1 @@
+ALTER TABLE anchors DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+DELETE FROM anchors WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS anchors_deleted_at;
+ALTER TABLE anchors DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,2 @@
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS anchors_deleted_at ON anchors (deleted_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS anchor_revisions (
+    anchor_id BIGINT NOT NULL REFERENCES anchors (id) ON DELETE CASCADE,
+    revision BIGINT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    url TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    changes JSONB NOT NULL,
+    PRIMARY KEY (anchor_id, revision)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS anchor_event_ids;
+DROP TABLE IF EXISTS anchor_events;
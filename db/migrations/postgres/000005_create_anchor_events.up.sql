@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS anchor_events (
+    id BIGINT PRIMARY KEY,
+    type TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    anchor_id BIGINT NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL DEFAULT 0
+);
+
+-- Event IDs come from this single row rather than a sequence. Its lock is
+-- held until the transaction adding the event ends, so events commit in
+-- ID order and a rolled back one leaves no gap.
+CREATE TABLE IF NOT EXISTS anchor_event_ids (
+    last_id BIGINT NOT NULL
+);
+
+INSERT INTO anchor_event_ids (last_id) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM anchor_event_ids);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS anchors;
\ No newline at end of file
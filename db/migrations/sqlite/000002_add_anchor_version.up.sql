@@ -0,0 +1 @@
+ALTER TABLE anchors ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
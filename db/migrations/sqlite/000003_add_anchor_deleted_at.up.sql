@@ -0,0 +1,2 @@
+ALTER TABLE anchors ADD COLUMN deleted_at TEXT;
+CREATE INDEX IF NOT EXISTS anchors_deleted_at ON anchors (deleted_at);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS anchors_purge_revisions;
+DROP TABLE IF EXISTS anchor_revisions;
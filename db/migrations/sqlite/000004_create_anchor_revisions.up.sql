@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS anchor_revisions (
+    anchor_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    url VARCHAR NOT NULL,
+    version INTEGER NOT NULL,
+    changes TEXT NOT NULL,
+    PRIMARY KEY (anchor_id, revision)
+);
+
+-- A trigger rather than a foreign key, so that purging works whether or
+-- not foreign keys are enforced.
+CREATE TRIGGER IF NOT EXISTS anchors_purge_revisions AFTER DELETE ON anchors
+BEGIN
+    DELETE FROM anchor_revisions WHERE anchor_id = OLD.id;
+END;
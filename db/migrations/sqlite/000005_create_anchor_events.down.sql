@@ -0,0 +1 @@
+DROP TABLE IF EXISTS anchor_events;
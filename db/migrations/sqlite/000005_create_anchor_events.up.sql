@@ -0,0 +1,11 @@
+-- AUTOINCREMENT keeps event IDs from being reused once older events are
+-- pruned. Writes are serialized, so IDs commit in order and without gaps.
+CREATE TABLE IF NOT EXISTS anchor_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    anchor_id INTEGER NOT NULL,
+    url VARCHAR NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 0
+);
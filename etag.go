@@ -0,0 +1,70 @@
+package junkboy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// parseETags splits an If-Match or If-None-Match header into its entity
+// tags, keeping any W/ prefix. "*" is returned as is.
+func parseETags(header string) []string {
+	var tags []string
+
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// etagNoneMatch reports whether the If-None-Match header of r lets a
+// response with etag through, using the weak comparison RFC 7232
+// requires for it.
+func etagNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeNotModified answers a GET whose If-None-Match matched.
+func writeNotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// writeJSONWithETag writes v with an ETag derived from its encoding, or
+// 304 Not Modified if the client already has it.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(js)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	if !etagNoneMatch(r, etag) {
+		writeNotModified(w, etag)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	logerr(w.Write(js))
+}
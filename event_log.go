@@ -0,0 +1,103 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrEventsExpired is returned when events are asked for after an ID so
+// old that the events following it are no longer kept.
+var ErrEventsExpired = errors.New("events expired")
+
+// LoggedEvent is an AnchorEvent with its place in the event log. IDs go up
+// by one with each event.
+type LoggedEvent struct {
+	ID int `json:"id"`
+	AnchorEvent
+}
+
+// DefaultMaxEvents is how many events the event log keeps by default.
+const DefaultMaxEvents = 10000
+
+// EventLog reads the events of an AnchorService, so that streams and sync
+// clients can pick up where they left off. The service stores each event
+// in the same transaction as its change, so the log has every change that
+// was made, in the order they were made, even across crashes.
+type EventLog struct {
+	anchors *AnchorService
+
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// NewEventLog returns the event log of s. It listens to s, so it must be
+// created before s is used.
+func NewEventLog(s *AnchorService) *EventLog {
+	l := &EventLog{anchors: s, changed: make(chan struct{})}
+	s.AddListener(l.wake)
+
+	return l
+}
+
+// wake closes the channel returned by Changed.
+func (l *EventLog) wake(ctx context.Context, e AnchorEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// LastID returns the ID of the latest event, or 0 if there are none.
+func (l *EventLog) LastID(ctx context.Context) (int, error) {
+	ctx, cancel := l.anchors.withTimeout(ctx)
+	defer cancel()
+
+	return l.anchors.repos.Anchors.LastEventID(ctx)
+}
+
+// Changed returns a channel that is closed when the service makes its
+// next change. Get it before reading events so that none can slip in
+// between. Changes made by other processes sharing the database do not
+// close it, and are only seen the next time the log is read.
+func (l *EventLog) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.changed
+}
+
+// Since returns up to limit events with an ID greater than after, oldest
+// first. A limit of 0 or less means no limit. It returns ErrEventsExpired
+// if some of those events are no longer kept.
+func (l *EventLog) Since(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	ctx, cancel := l.anchors.withTimeout(ctx)
+	defer cancel()
+
+	events, err := l.anchors.repos.Anchors.ListEvents(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// IDs have no gaps, so a missing first event has been pruned.
+	if len(events) > 0 {
+		if events[0].ID != after+1 {
+			return nil, ErrEventsExpired
+		}
+
+		return events, nil
+	}
+
+	last, err := l.anchors.repos.Anchors.LastEventID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if after > last {
+		return nil, fmt.Errorf("%w: event %d has not happened yet", ErrEventsExpired, after)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,186 @@
+package junkboy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func addTestAnchors(t *testing.T, s *AnchorService, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		_, err := s.AddAnchor(context.Background(), Anchor{URL: "https://example.com/" + strconv.Itoa(i)})
+		assertNoError(t, err)
+	}
+}
+
+func assertEventIDs(t *testing.T, events []LoggedEvent, first, last int) {
+	t.Helper()
+
+	assertEqual(t, last-first+1, len(events))
+
+	for i, e := range events {
+		assertEqual(t, first+i, e.ID)
+	}
+}
+
+func assertLastEventID(t *testing.T, l *EventLog, expected int) {
+	t.Helper()
+
+	id, err := l.LastID(context.Background())
+	assertNoError(t, err)
+	assertEqual(t, expected, id)
+}
+
+func TestEventLog(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewAnchorService(NewAnchorMemoryRepository())
+	s.SetMaxEvents(3)
+	l := NewEventLog(s)
+
+	events, err := l.Since(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	changed := l.Changed()
+	addTestAnchors(t, s, 5)
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("a change did not signal the log")
+	}
+
+	assertLastEventID(t, l, 5)
+
+	events, err = l.Since(ctx, 2, 0)
+	assertNoError(t, err)
+	assertEventIDs(t, events, 3, 5)
+	assertEqual(t, AnchorCreated, events[0].Type)
+	assertEqual(t, Anchor{ID: 3, URL: "https://example.com/2", Version: 1}, events[0].Anchor)
+
+	events, err = l.Since(ctx, 3, 1)
+	assertNoError(t, err)
+	assertEventIDs(t, events, 4, 4)
+
+	events, err = l.Since(ctx, 5, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	// Events 1 and 2 are no longer kept.
+	_, err = l.Since(ctx, 1, 0)
+	assertEqual(t, true, errors.Is(err, ErrEventsExpired))
+
+	// Neither are events from a log that was since reset.
+	_, err = l.Since(ctx, 9, 0)
+	assertEqual(t, true, errors.Is(err, ErrEventsExpired))
+}
+
+func TestEventLogTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestSQLiteDB(t)
+
+	m, err := NewSQLiteMigrator(db.Write)
+	assertNoError(t, err)
+	assertNoError(t, m.Up(ctx))
+
+	store, err := NewSQLiteStore(ctx, db)
+	assertNoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	s := NewAnchorServiceWithRepositories(store.Repositories())
+	l := NewEventLog(s)
+
+	var notified int
+	s.AddListener(func(ctx context.Context, e AnchorEvent) { notified++ })
+
+	addTestAnchors(t, s, 1)
+
+	// A bulk request that rolls back leaves neither events nor a gap.
+	results, err := s.Bulk(ctx, []BulkOperation{
+		{Op: "create", URL: "https://example.com/a"},
+		{Op: "delete", ID: 42},
+	}, true)
+	assertNoError(t, err)
+	assertEqual(t, ErrBulkRolledBack, results[0].Err)
+	assertLastEventID(t, l, 1)
+
+	_, err = s.Bulk(ctx, []BulkOperation{
+		{Op: "update", ID: 1, URL: "https://example.com/b"},
+		{Op: "delete", ID: 1},
+	}, true)
+	assertNoError(t, err)
+
+	events, err := l.Since(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEventIDs(t, events, 1, 3)
+	assertEqual(t, AnchorUpdated, events[1].Type)
+	assertEqual(t, Anchor{ID: 1, URL: "https://example.com/b", Version: 2}, events[1].Anchor)
+	assertEqual(t, AnchorDeleted, events[2].Type)
+	assertEqual(t, 3, notified)
+
+	// A change whose event cannot be stored is rolled back with it.
+	_, err = db.Write.Exec("DROP TABLE anchor_events")
+	assertNoError(t, err)
+
+	_, err = s.AddAnchor(ctx, Anchor{URL: "https://example.com/c"})
+	assertError(t, err)
+	assertEqual(t, 0, countAnchors(t, store))
+	assertEqual(t, 3, notified)
+}
+
+func TestEventLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, anchorEventsFile)
+
+	lines := func() int {
+		f, err := os.Open(path)
+		assertNoError(t, err)
+		defer f.Close()
+
+		n := 0
+		for scanner := bufio.NewScanner(f); scanner.Scan(); {
+			n++
+		}
+
+		return n
+	}
+
+	r := newTestAnchorFileRepository(t, dir, FileOptions{Format: "json"})
+	s := NewAnchorService(r)
+	s.SetMaxEvents(3)
+	l := NewEventLog(s)
+
+	addTestAnchors(t, s, 5)
+	assertEqual(t, 5, lines())
+
+	// The file is compacted once it holds twice the events kept.
+	addTestAnchors(t, s, 1)
+	assertEqual(t, 3, lines())
+	assertNoError(t, r.Close())
+
+	r = newTestAnchorFileRepository(t, dir, FileOptions{Format: "json"})
+	s = NewAnchorService(r)
+	s.SetMaxEvents(2)
+	l = NewEventLog(s)
+
+	// Reopening keeps the IDs going.
+	assertLastEventID(t, l, 6)
+
+	events, err := l.Since(context.Background(), 4, 0)
+	assertNoError(t, err)
+	assertEventIDs(t, events, 5, 6)
+
+	addTestAnchors(t, s, 1)
+	assertLastEventID(t, l, 7)
+
+	_, err = l.Since(context.Background(), 4, 0)
+	assertEqual(t, true, errors.Is(err, ErrEventsExpired))
+}
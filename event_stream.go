@@ -0,0 +1,313 @@
+package junkboy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment to
+// keep the connection open.
+const DefaultHeartbeat = 15 * time.Second
+
+// DefaultStreamWriteTimeout is how long a stream waits by default for its
+// client to take each batch of events, or heartbeat, before dropping it.
+const DefaultStreamWriteTimeout = 10 * time.Second
+
+// maxStreamBatch is how many events a stream reads from the log at once.
+const maxStreamBatch = 100
+
+// EventStreamHandler streams the event log as Server-Sent Events. Each
+// stream reads the log at its own pace, so a slow client only holds up its
+// own connection; one that falls so far behind that the events it needs
+// have expired gets a reset event and carries on from the latest.
+//
+// A client that stops reading without closing the connection would block
+// its stream for good, so if the request's connection is known through
+// ConnContext, each batch of events must be written within the write
+// timeout or the stream is dropped.
+type EventStreamHandler struct {
+	log *EventLog
+
+	// heartbeat and writeTimeout are in nanoseconds so they can be changed
+	// while streams run.
+	heartbeat    int64
+	writeTimeout int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewEventStreamHandler(l *EventLog) *EventStreamHandler {
+	return &EventStreamHandler{
+		log:          l,
+		heartbeat:    int64(DefaultHeartbeat),
+		writeTimeout: int64(DefaultStreamWriteTimeout),
+		done:         make(chan struct{}),
+	}
+}
+
+// Close ends every open stream, which a graceful shutdown would otherwise
+// wait for; clients reconnect and resume elsewhere. A stream in the middle
+// of a write ends once the write does, which the write timeout bounds.
+// Streams opened after it end at once.
+func (h *EventStreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// SetHeartbeat sets how often idle streams send a heartbeat. Streams
+// already open keep theirs.
+func (h *EventStreamHandler) SetHeartbeat(d time.Duration) {
+	atomic.StoreInt64(&h.heartbeat, int64(d))
+}
+
+// SetWriteTimeout sets how long streams wait for their clients to take
+// each batch of events. Streams already open keep theirs.
+func (h *EventStreamHandler) SetWriteTimeout(d time.Duration) {
+	atomic.StoreInt64(&h.writeTimeout, int64(d))
+}
+
+func (h *EventStreamHandler) RegisterRoutes(r *Router) {
+	r.AddRoute([]string{"GET"}, "/events", h.streamEventsHandler)
+}
+
+// eventFilter selects the events a stream sends: those of the given types
+// made by the given actor, if any.
+type eventFilter struct {
+	types map[string]bool
+	actor string
+}
+
+func parseEventFilter(r *http.Request) (eventFilter, error) {
+	f := eventFilter{actor: r.URL.Query().Get("actor")}
+
+	types := r.URL.Query().Get("types")
+	if types == "" {
+		return f, nil
+	}
+
+	f.types = map[string]bool{}
+
+	for _, t := range strings.Split(types, ",") {
+		known := false
+		for _, eventType := range AnchorEventTypes {
+			known = known || t == eventType
+		}
+
+		if !known {
+			return f, fmt.Errorf("unknown event type '%s'", t)
+		}
+
+		f.types[t] = true
+	}
+
+	return f, nil
+}
+
+func (f eventFilter) matches(e LoggedEvent) bool {
+	return (f.types == nil || f.types[e.Type]) && (f.actor == "" || e.Actor == f.actor)
+}
+
+// lastEventID is where a stream starts: after the Last-Event-ID the
+// browser sends when it reconnects, the last_event_id parameter for the
+// first connection, or -1 for the latest event.
+func (h *EventStreamHandler) lastEventID(r *http.Request) (int, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+
+	if v == "" {
+		return -1, nil
+	}
+
+	id, err := strconv.Atoi(v)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid last event id '%s'", v)
+	}
+
+	return id, nil
+}
+
+// streamEventsHandler sends every anchor event after the starting point
+// that matches the filter as it happens, until the client goes away.
+func (h *EventStreamHandler) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cursor, err := h.lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if cursor < 0 {
+		if cursor, err = h.log.LastID(r.Context()); err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	sw := &streamWriter{
+		flusher: flusher,
+		conn:    ConnFromContext(r.Context()),
+		timeout: time.Duration(atomic.LoadInt64(&h.writeTimeout)),
+	}
+	defer sw.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sw.begin()
+
+	if _, err := io.WriteString(w, "retry: 3000\n\n"); err != nil || !sw.flush() {
+		return
+	}
+
+	heartbeat := time.NewTicker(time.Duration(atomic.LoadInt64(&h.heartbeat)))
+	defer heartbeat.Stop()
+
+	for {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		changed := h.log.Changed()
+
+		sw.begin()
+
+		events, err := h.log.Since(r.Context(), cursor, maxStreamBatch)
+
+		reset := errors.Is(err, ErrEventsExpired)
+		if reset {
+			cursor, err = h.log.LastID(r.Context())
+		}
+
+		if err != nil {
+			// The client reconnects and resumes from where it got to.
+			if r.Context().Err() == nil {
+				log.Printf("failed to read events for a stream: %v", err)
+			}
+
+			return
+		}
+
+		if reset {
+			err = writeSSE(w, cursor, "reset", map[string]int{"last_event_id": cursor})
+		}
+
+		for _, e := range events {
+			if err != nil {
+				break
+			}
+
+			cursor = e.ID
+			if filter.matches(e) {
+				err = writeSSE(w, e.ID, e.Type, e)
+			}
+		}
+
+		if err != nil || !sw.flush() {
+			return
+		}
+
+		if len(events) == maxStreamBatch {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			sw.begin()
+
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil || !sw.flush() {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// streamWriter sends what a stream writes to its client, each batch within
+// the write timeout if the connection is known. Flush does not report
+// errors, but a flush that only returns once the deadline has passed has
+// timed out, and the stream is dropped.
+type streamWriter struct {
+	flusher  http.Flusher
+	conn     net.Conn
+	timeout  time.Duration
+	deadline time.Time
+	timedOut bool
+}
+
+// begin starts a batch, which must be sent by the write timeout from now.
+func (s *streamWriter) begin() {
+	if s.conn == nil || s.timeout <= 0 {
+		return
+	}
+
+	s.deadline = time.Now().Add(s.timeout)
+
+	if err := s.conn.SetWriteDeadline(s.deadline); err != nil {
+		log.Printf("failed to set event stream write deadline: %v", err)
+	}
+}
+
+// flush sends the batch and reports whether it went before its deadline.
+func (s *streamWriter) flush() bool {
+	s.flusher.Flush()
+
+	if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+		s.timedOut = true
+	}
+
+	return !s.timedOut
+}
+
+// close clears the deadline, which would otherwise apply to the next
+// request on the connection. After a timeout it is kept, so that nothing
+// else blocks on a client that does not read.
+func (s *streamWriter) close() {
+	if s.deadline.IsZero() || s.timedOut {
+		return
+	}
+
+	if err := s.conn.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("failed to clear event stream write deadline: %v", err)
+	}
+}
+
+// writeSSE writes one event with its ID, type and JSON data.
+func writeSSE(w io.Writer, id int, eventType string, data interface{}) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, eventType, js)
+
+	return err
+}
@@ -0,0 +1,286 @@
+package junkboy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one event read from a stream, or a comment.
+type sseEvent struct {
+	id      string
+	event   string
+	data    string
+	comment string
+}
+
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+
+	for {
+		line, err := r.ReadString('\n')
+		assertNoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return e
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "":
+			e.comment = value
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data = value
+		}
+	}
+}
+
+type testEventStream struct {
+	anchors *AnchorService
+	log     *EventLog
+	handler *EventStreamHandler
+	server  *httptest.Server
+}
+
+func newTestEventStream(t *testing.T, maxEvents int) *testEventStream {
+	svc := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+	svc.SetMaxEvents(maxEvents)
+	l := NewEventLog(svc)
+
+	handler := NewEventStreamHandler(l)
+	router := NewRouter("/v1")
+	handler.RegisterRoutes(router)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	t.Cleanup(handler.Close)
+
+	return &testEventStream{anchors: svc, log: l, handler: handler, server: server}
+}
+
+// open starts a stream and reads past the retry line.
+func (s *testEventStream) open(t *testing.T, query, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.server.URL+"/v1/events"+query, nil)
+	assertNoError(t, err)
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assertNoError(t, err)
+	assertEqual(t, http.StatusOK, resp.StatusCode)
+	assertEqual(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	readSSE(t, body)
+
+	return body, func() {
+		cancel()
+		resp.Body.Close()
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := newTestEventStream(t, 100)
+	ctx := WithActor(context.Background(), "alice")
+	svc := s.anchors
+
+	id, err := svc.AddAnchor(ctx, Anchor{URL: "https://example.com/old"})
+	assertNoError(t, err)
+
+	// Without Last-Event-ID the stream starts with the next event.
+	body, closeStream := s.open(t, "", "")
+	defer closeStream()
+
+	_, err = svc.UpdateAnchor(context.Background(), Anchor{ID: id, URL: "https://example.com/new"})
+	assertNoError(t, err)
+
+	e := readSSE(t, body)
+	assertEqual(t, "2", e.id)
+	assertEqual(t, AnchorUpdated, e.event)
+
+	var logged LoggedEvent
+	assertNoError(t, json.Unmarshal([]byte(e.data), &logged))
+	assertEqual(t, 2, logged.ID)
+	assertEqual(t, Anchor{ID: id, URL: "https://example.com/new", Version: 2}, logged.Anchor)
+
+	// Reconnecting resumes after the last event seen, filtered.
+	assertNoError(t, svc.DeleteAnchor(ctx, id, 0))
+
+	resumed, closeResumed := s.open(t, "?actor=alice", "0")
+	defer closeResumed()
+
+	e = readSSE(t, resumed)
+	assertEqual(t, "1", e.id)
+	assertEqual(t, AnchorCreated, e.event)
+
+	e = readSSE(t, resumed)
+	assertEqual(t, "3", e.id)
+	assertEqual(t, AnchorDeleted, e.event)
+
+	typed, closeTyped := s.open(t, "?types=anchor.deleted,anchor.restored&last_event_id=0", "")
+	defer closeTyped()
+
+	e = readSSE(t, typed)
+	assertEqual(t, "3", e.id)
+}
+
+// TestEventStreamActor filters by the actor that ActorMiddleware finds for
+// the requests making the changes.
+func TestEventStreamActor(t *testing.T) {
+	s := newTestEventStream(t, 100)
+
+	router := NewRouter("/v1")
+	NewAnchorHTTPHandler(s.anchors).RegisterRoutes(router)
+	api := httptest.NewServer(NewActorMiddleware(router, "s3cret", "X-Forwarded-User"))
+	t.Cleanup(api.Close)
+
+	body, closeStream := s.open(t, "?actor=bob", "")
+	defer closeStream()
+
+	for _, user := range []string{"alice", "bob"} {
+		req, err := http.NewRequest(http.MethodPost, api.URL+"/v1/anchor", strings.NewReader(`{"url":"https://example.com"}`))
+		assertNoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-User", user)
+
+		resp, err := http.DefaultClient.Do(req)
+		assertNoError(t, err)
+		resp.Body.Close()
+		assertEqual(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	e := readSSE(t, body)
+	assertEqual(t, "2", e.id)
+
+	var logged LoggedEvent
+	assertNoError(t, json.Unmarshal([]byte(e.data), &logged))
+	assertEqual(t, "bob", logged.Actor)
+}
+
+func TestEventStreamReset(t *testing.T) {
+	s := newTestEventStream(t, 2)
+	addTestAnchors(t, s.anchors, 5)
+
+	body, closeStream := s.open(t, "", "1")
+	defer closeStream()
+
+	e := readSSE(t, body)
+	assertEqual(t, "5", e.id)
+	assertEqual(t, "reset", e.event)
+	assertEqual(t, `{"last_event_id":5}`, e.data)
+
+	addTestAnchors(t, s.anchors, 1)
+
+	e = readSSE(t, body)
+	assertEqual(t, "6", e.id)
+}
+
+func TestEventStreamHeartbeatAndClose(t *testing.T) {
+	s := newTestEventStream(t, 10)
+	s.handler.SetHeartbeat(10 * time.Millisecond)
+
+	body, closeStream := s.open(t, "", "")
+	defer closeStream()
+
+	e := readSSE(t, body)
+	assertEqual(t, "heartbeat", e.comment)
+
+	s.handler.Close()
+
+	_, err := io.ReadAll(body)
+	assertNoError(t, err)
+}
+
+// TestEventStreamSlowClient drops a stream whose client stops reading
+// without closing the connection.
+func TestEventStreamSlowClient(t *testing.T) {
+	svc := NewAnchorService(NewAnchorMemoryRepository())
+	l := NewEventLog(svc)
+
+	url := "https://example.com/" + strings.Repeat("a", 1000)
+	for i := 0; i < 1000; i++ {
+		_, err := svc.AddAnchor(context.Background(), Anchor{URL: url})
+		assertNoError(t, err)
+	}
+
+	handler := NewEventStreamHandler(l)
+	handler.SetWriteTimeout(50 * time.Millisecond)
+	defer handler.Close()
+
+	router := NewRouter("/v1")
+	handler.RegisterRoutes(router)
+
+	done := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		router.ServeHTTP(w, r)
+	}))
+	server.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		// Small buffers fill up long before the stream is written.
+		assertNoError(t, c.(*net.TCPConn).SetWriteBuffer(4096))
+		return ConnContext(ctx, c)
+	}
+	server.Start()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assertNoError(t, err)
+	defer conn.Close()
+
+	assertNoError(t, conn.(*net.TCPConn).SetReadBuffer(4096))
+
+	_, err = io.WriteString(conn, "GET /v1/events?last_event_id=0 HTTP/1.1\r\nHost: junkboy\r\n\r\n")
+	assertNoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream to a client that does not read was not dropped")
+	}
+}
+
+func TestEventStreamBadRequests(t *testing.T) {
+	s := newTestEventStream(t, 10)
+
+	for _, tt := range []struct {
+		query        string
+		responseBody string
+	}{
+		{"?types=anchor.read", `{"status":400,"message":"unknown event type 'anchor.read'"}`},
+		{"?last_event_id=last", `{"status":400,"message":"invalid last event id 'last'"}`},
+	} {
+		resp, err := http.Get(s.server.URL + "/v1/events" + tt.query)
+		assertNoError(t, err)
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assertNoError(t, err)
+
+		assertEqual(t, http.StatusBadRequest, resp.StatusCode)
+		assertEqual(t, tt.responseBody, string(body))
+	}
+}
@@ -2,4 +2,16 @@ module github.com/pmaterer/junkboy
 
 go 1.17
 
-require github.com/mattn/go-sqlite3 v1.14.13
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/mattn/go-sqlite3 v1.14.13
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/lib/pq v1.10.9
+	go.etcd.io/bbolt v1.3.7
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,153 @@
+package junkboy
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo returns build information, taking values set at link time
+// and falling back to what the Go runtime knows about the main module and
+// the checkout it was built in.
+func NewBuildInfo(version, revision, buildTime string) BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		bi = nil
+	}
+
+	return newBuildInfo(bi, version, revision, buildTime)
+}
+
+func newBuildInfo(bi *debug.BuildInfo, version, revision, buildTime string) BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Revision:  revision,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi != nil {
+		vcsRevision, vcsTime := vcsSettings(bi)
+
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+
+		if info.Revision == "" {
+			info.Revision = vcsRevision
+		}
+
+		if info.BuildTime == "" {
+			info.BuildTime = vcsTime
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+
+	return info
+}
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	buildInfo BuildInfo
+	draining  int32
+
+	mu     sync.Mutex
+	checks []readinessCheck
+}
+
+func NewHealthHandler(info BuildInfo) *HealthHandler {
+	return &HealthHandler{
+		buildInfo: info,
+	}
+}
+
+func (h *HealthHandler) RegisterRoutes(r *Router) {
+	r.AddRoute([]string{"GET", "HEAD"}, "/healthz", h.healthzHandler)
+	r.AddRoute([]string{"GET", "HEAD"}, "/readyz", h.readyzHandler)
+	r.AddRoute([]string{"GET"}, "/version", h.versionHandler)
+}
+
+// AddReadinessCheck registers a check that must pass for /readyz to succeed.
+func (h *HealthHandler) AddReadinessCheck(name string, check func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, readinessCheck{name, check})
+}
+
+// Drain makes /readyz fail so load balancers stop sending traffic before
+// the server shuts down.
+func (h *HealthHandler) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *HealthHandler) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *HealthHandler) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	type Response struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+
+	h.mu.Lock()
+	checks := make([]readinessCheck, len(h.checks))
+	copy(checks, h.checks)
+	h.mu.Unlock()
+
+	resp := Response{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+
+	if atomic.LoadInt32(&h.draining) == 1 {
+		resp.Status = "draining"
+		status = http.StatusServiceUnavailable
+	}
+
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		err := c.check(ctx)
+
+		cancel()
+
+		if err != nil {
+			resp.Checks[c.name] = err.Error()
+			status = http.StatusServiceUnavailable
+
+			if resp.Status == "ok" {
+				resp.Status = "failing"
+			}
+
+			continue
+		}
+
+		resp.Checks[c.name] = "ok"
+	}
+
+	writeJSON(w, status, resp)
+}
+
+func (h *HealthHandler) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.buildInfo)
+}
@@ -0,0 +1,72 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		checkErr       error
+		drain          bool
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "Ready",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"status":"ok","checks":{"database":"ok"}}`,
+		},
+		{
+			name:           "Check failing",
+			checkErr:       errors.New("database is gone"),
+			expectedStatus: http.StatusServiceUnavailable,
+			responseBody:   `{"status":"failing","checks":{"database":"database is gone"}}`,
+		},
+		{
+			name:           "Draining",
+			drain:          true,
+			expectedStatus: http.StatusServiceUnavailable,
+			responseBody:   `{"status":"draining","checks":{"database":"ok"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(NewBuildInfo("v1.0.0", "abc", ""))
+			h.AddReadinessCheck("database", func(ctx context.Context) error { return tt.checkErr })
+
+			if tt.drain {
+				h.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/readyz", http.NoBody)
+			assertNoError(t, err)
+
+			http.HandlerFunc(h.readyzHandler).ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	info := NewBuildInfo("v1.0.0", "abc", "2022-06-01T00:00:00Z")
+	h := NewHealthHandler(info)
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "/version", http.NoBody)
+	assertNoError(t, err)
+
+	http.HandlerFunc(h.versionHandler).ServeHTTP(rr, req)
+
+	assertEqual(t, http.StatusOK, rr.Code)
+	assertEqual(t, `{"version":"v1.0.0","revision":"abc","build_time":"2022-06-01T00:00:00Z","go_version":"`+info.GoVersion+`"}`, rr.Body.String())
+}
@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package junkboy
+
+import "runtime/debug"
+
+// vcsSettings returns the revision and commit time the go command stamps
+// binaries built in a checkout with.
+func vcsSettings(bi *debug.BuildInfo) (revision, time string) {
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			time = s.Value
+		}
+	}
+
+	return revision, time
+}
@@ -0,0 +1,12 @@
+//go:build !go1.18
+// +build !go1.18
+
+package junkboy
+
+import "runtime/debug"
+
+// vcsSettings returns nothing, as binaries are only stamped with their
+// checkout from Go 1.18.
+func vcsSettings(bi *debug.BuildInfo) (revision, time string) {
+	return "", ""
+}
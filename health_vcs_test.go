@@ -0,0 +1,37 @@
+//go:build go1.18
+// +build go1.18
+
+package junkboy
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestNewBuildInfoVCS(t *testing.T) {
+	bi := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "0123abc"},
+			{Key: "vcs.time", Value: "2022-06-01T00:00:00Z"},
+		},
+	}
+
+	// The checkout fills in what was not set at link time...
+	info := newBuildInfo(bi, "", "", "")
+	assertEqual(t, "v1.2.3", info.Version)
+	assertEqual(t, "0123abc", info.Revision)
+	assertEqual(t, "2022-06-01T00:00:00Z", info.BuildTime)
+
+	// ...but does not override it.
+	info = newBuildInfo(bi, "v2.0.0", "def", "2023-01-01T00:00:00Z")
+	assertEqual(t, "v2.0.0", info.Version)
+	assertEqual(t, "def", info.Revision)
+	assertEqual(t, "2023-01-01T00:00:00Z", info.BuildTime)
+
+	info = newBuildInfo(nil, "", "", "")
+	assertEqual(t, "(devel)", info.Version)
+	assertEqual(t, "", info.Revision)
+	assertEqual(t, "", info.BuildTime)
+}
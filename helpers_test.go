@@ -2,10 +2,13 @@ package junkboy
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
-func assertNoError(t *testing.T, err error) {
+func assertNoError(t testing.TB, err error) {
 	t.Helper()
 
 	if err != nil {
@@ -42,3 +45,13 @@ func assertBytesEqual(t *testing.T, expected, actual []byte) {
 			"actual: % x", expected, actual)
 	}
 }
+
+func newTestSQLiteDB(t testing.TB) *SQLiteDB {
+	t.Helper()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "junkboy.db"), DefaultSQLiteOptions())
+	assertNoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
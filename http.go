@@ -1,17 +1,161 @@
 package junkboy
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime"
+	"net"
 	"net/http"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const requestIDHeader = "X-Request-ID"
+
+type connKey struct{}
+
+// ConnContext returns a copy of ctx that holds the connection c, for
+// handlers that set deadlines on the connection of their request. It is
+// meant to be the ConnContext of an http.Server.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// ConnFromContext returns the connection set by ConnContext, or nil if
+// there is none.
+func ConnFromContext(ctx context.Context) net.Conn {
+	c, _ := ctx.Value(connKey{}).(net.Conn)
+	return c
+}
+
+type requestIDKey struct{}
+
+type RequestIDMiddleware struct {
+	handler http.Handler
+}
+
+func NewRequestIDMiddleware(handler http.Handler) *RequestIDMiddleware {
+	return &RequestIDMiddleware{handler}
+}
+
+func (h *RequestIDMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(requestIDHeader)
+	if !requestIDIsValid(id) {
+		id = newRequestID()
+	}
+
+	w.Header().Set(requestIDHeader, id)
+	ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+	h.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequestIDFromContext returns the ID assigned to the request by
+// RequestIDMiddleware, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+func requestIDIsValid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// AdminActor is the actor of requests made with the admin token.
+const AdminActor = "admin"
+
+// maxActorLength is the longest actor name taken from a request header.
+const maxActorLength = 256
+
+// reservedActors are the actors junkboy names itself, which a request
+// header cannot claim to be.
+var reservedActors = []string{AdminActor, FileActor}
+
+// ActorMiddleware records who makes each request with WithActor, so that
+// revisions, audit entries and events name them. Requests with the admin
+// token are made by AdminActor. Otherwise, if header is set, the request
+// header of that name names the actor, unless it names one of the
+// reserved actors, such as AdminActor, in any case. Anyone can send any
+// header, so it must only be set behind a proxy that authenticates users
+// and sets the header itself.
+type ActorMiddleware struct {
+	handler http.Handler
+	token   string
+	header  string
+}
+
+func NewActorMiddleware(handler http.Handler, token, header string) *ActorMiddleware {
+	return &ActorMiddleware{handler: handler, token: token, header: header}
+}
+
+func (h *ActorMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var actor string
+
+	switch {
+	case hasBearerToken(r, h.token):
+		actor = AdminActor
+	case h.header != "":
+		actor = strings.TrimSpace(r.Header.Get(h.header))
+		if !actorIsValid(actor) {
+			actor = ""
+		}
+	}
+
+	if actor != "" {
+		r = r.WithContext(WithActor(r.Context(), actor))
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+func actorIsValid(actor string) bool {
+	if len(actor) > maxActorLength {
+		return false
+	}
+
+	for _, reserved := range reservedActors {
+		if strings.EqualFold(actor, reserved) {
+			return false
+		}
+	}
+
+	for _, c := range actor {
+		if c < ' ' || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
 type LoggingMiddleware struct {
 	handler http.Handler
 }
@@ -24,7 +168,126 @@ func (h *LoggingMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	h.handler.ServeHTTP(w, r)
-	log.Printf("%s %s in %s", r.Method, r.RequestURI, time.Since(start))
+
+	if err := r.Context().Err(); err != nil {
+		log.Printf("%s %s in %s [%s] (%v)", r.Method, r.RequestURI, time.Since(start), RequestIDFromContext(r.Context()), err)
+		return
+	}
+
+	log.Printf("%s %s in %s [%s]", r.Method, r.RequestURI, time.Since(start), RequestIDFromContext(r.Context()))
+}
+
+// PanicEvent describes a panic recovered while serving a request.
+type PanicEvent struct {
+	RequestID string
+	Method    string
+	Path      string
+	Value     interface{}
+	Stack     []byte
+	Time      time.Time
+}
+
+// ErrorReporter forwards recovered panics to an external error tracker.
+type ErrorReporter interface {
+	ReportPanic(ctx context.Context, event PanicEvent)
+}
+
+type RecoveryMiddleware struct {
+	handler  http.Handler
+	reporter ErrorReporter
+	panics   uint64
+}
+
+// NewRecoveryMiddleware returns a middleware that turns panics in handler
+// into 500 responses. reporter may be nil.
+func NewRecoveryMiddleware(handler http.Handler, reporter ErrorReporter) *RecoveryMiddleware {
+	return &RecoveryMiddleware{
+		handler:  handler,
+		reporter: reporter,
+	}
+}
+
+// Panics returns the number of panics recovered so far.
+func (h *RecoveryMiddleware) Panics() uint64 {
+	return atomic.LoadUint64(&h.panics)
+}
+
+func (h *RecoveryMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := newStatusWriter(w)
+
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		// http.ErrAbortHandler is how a handler asks net/http to abort the
+		// response, so it is passed on rather than reported.
+		if v == http.ErrAbortHandler {
+			panic(v)
+		}
+
+		atomic.AddUint64(&h.panics, 1)
+
+		event := PanicEvent{
+			RequestID: RequestIDFromContext(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Value:     v,
+			Stack:     debug.Stack(),
+			Time:      time.Now(),
+		}
+		log.Printf("panic serving %s %s [%s]: %v\n%s", event.Method, event.Path, event.RequestID, v, event.Stack)
+
+		if h.reporter != nil {
+			h.reporter.ReportPanic(r.Context(), event)
+		}
+
+		if sw.wroteHeader {
+			// Too late to change the status; make sure the client does not
+			// mistake the truncated body for a complete response.
+			panic(http.ErrAbortHandler)
+		}
+
+		w.Header().Set("Connection", "close")
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}()
+
+	h.handler.ServeHTTP(sw, r)
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	return &statusWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	w.wroteHeader = true
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 type CorsMiddleware struct {
@@ -39,12 +302,46 @@ func (h *CorsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Link")
 	h.handler.ServeHTTP(w, r)
 }
 
+// maxBodyBytes is the largest request body handlers read.
+const maxBodyBytes = 1_048_576
+
+// bodyTooLargeError is returned for request bodies over the limit, which
+// handlers may answer with 413 rather than 400.
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("body must not be larger than %d bytes", e.limit)
+}
+
+// readBody reads the whole request body, which must not be empty.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+
+	switch {
+	case err != nil && err.Error() == "http: request body too large":
+		return nil, &bodyTooLargeError{maxBodyBytes}
+	case err != nil:
+		return nil, err
+	case len(body) == 0:
+		return nil, errors.New("body must not be empty")
+	}
+
+	return body, nil
+}
+
 func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	return readJSONLimit(w, r, dst, maxBodyBytes)
+}
+
+// readJSONLimit is readJSON for bodies of up to maxBytes.
+func readJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
@@ -80,7 +377,7 @@ func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
 		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			return &bodyTooLargeError{maxBytes}
 
 		// This will be returned if we pass a non-nil pointer to `Decode()`.
 		case errors.As(err, &invalidUnmarshalError):
@@ -127,24 +424,90 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, errorResponse)
 }
 
+// statusClientClosedRequest is the non-standard status nginx uses when the
+// client goes away before the response is written.
+const statusClientClosedRequest = 499
+
+// writeServiceError writes the response for an error returned by a
+// service, telling timeouts and cancellations apart from failures.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrAnchorNotFound), errors.Is(err, ErrRevisionNotFound),
+		errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrDeliveryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrAnchorVersionMismatch):
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		if match, ok := r.Context().Value(routeMatchKey{}).(*routeMatch); ok {
+			match.timedOut = true
+		}
+
+		log.Printf("%s %s [%s] timed out: %v", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), err)
+		writeError(w, http.StatusGatewayTimeout, "request timed out")
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		log.Printf("%s %s [%s] cancelled by client: %v", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), err)
+		writeError(w, statusClientClosedRequest, "request cancelled")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// adminAuthorized reports whether r carries the admin token as a bearer
+// token, writing 401 if it does not. Without a token every request is
+// refused.
+func adminAuthorized(w http.ResponseWriter, r *http.Request, token string) bool {
+	if !hasBearerToken(r, token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="junkboy admin"`)
+		writeError(w, http.StatusUnauthorized, "admin token required")
+
+		return false
+	}
+
+	return true
+}
+
+// hasBearerToken reports whether r carries token as a bearer token. No
+// request carries an empty one.
+func hasBearerToken(r *http.Request, token string) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
 type ErrorResponse struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 }
 
-func contentTypeIsValid(w http.ResponseWriter, r *http.Request, expectedContentType string) bool {
-	contentType := r.Header.Get("Content-Type")
-	mediaType, _, err := mime.ParseMediaType(contentType)
-
+// contentTypeIsValid checks that the request body is one of the accepted
+// media types, writing 400 or 415 if it is not. Handlers that accept more
+// than one find out which it is with requestMediaType.
+func contentTypeIsValid(w http.ResponseWriter, r *http.Request, accepted ...string) bool {
+	mediaType, err := requestMediaType(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return false
 	}
 
-	if mediaType != expectedContentType {
-		writeError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("expected '%s' Content-Type, got '%s'", expectedContentType, mediaType))
-		return false
+	for _, a := range accepted {
+		if mediaType == a {
+			return true
+		}
 	}
 
-	return true
+	quoted := make([]string, len(accepted))
+	for i, a := range accepted {
+		quoted[i] = "'" + a + "'"
+	}
+
+	writeError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("expected %s Content-Type, got '%s'", strings.Join(quoted, " or "), mediaType))
+
+	return false
+}
+
+// requestMediaType returns the media type of the request body, without
+// parameters.
+func requestMediaType(r *http.Request) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType, err
 }
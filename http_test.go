@@ -0,0 +1,205 @@
+package junkboy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockErrorReporter struct {
+	events []PanicEvent
+}
+
+func (er *mockErrorReporter) ReportPanic(ctx context.Context, event PanicEvent) {
+	er.events = append(er.events, event)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+		responseBody   string
+		panics         uint64
+	}{
+		{
+			name: "No panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "Panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			responseBody:   `{"status":500,"message":"Internal Server Error"}`,
+			panics:         1,
+		},
+		{
+			name: "Panic in readJSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var anchor Anchor
+				_ = readJSON(w, r, anchor)
+			},
+			expectedStatus: http.StatusInternalServerError,
+			responseBody:   `{"status":500,"message":"Internal Server Error"}`,
+			panics:         1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter := &mockErrorReporter{}
+			mw := NewRecoveryMiddleware(tt.handler, reporter)
+			handler := NewRequestIDMiddleware(mw)
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/anchor", strings.NewReader(`{}`))
+			assertNoError(t, err)
+			req.Header.Set(requestIDHeader, "abc123")
+
+			handler.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+			assertEqual(t, tt.panics, mw.Panics())
+			assertEqual(t, int(tt.panics), len(reporter.events))
+
+			if tt.panics > 0 {
+				assertEqual(t, "abc123", reporter.events[0].RequestID)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{
+			name:      "Request ID passed through",
+			requestID: "abc123",
+		},
+		{
+			name:      "Request ID generated",
+			requestID: "",
+			generated: true,
+		},
+		{
+			name:      "Invalid request ID replaced",
+			requestID: "bad id",
+			generated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+
+			handler := NewRequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFromContext(r.Context())
+			}))
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/anchors", http.NoBody)
+			assertNoError(t, err)
+			req.Header.Set(requestIDHeader, tt.requestID)
+
+			handler.ServeHTTP(rr, req)
+
+			assertEqual(t, got, rr.Header().Get(requestIDHeader))
+
+			if tt.generated {
+				assertEqual(t, 32, len(got))
+			} else {
+				assertEqual(t, tt.requestID, got)
+			}
+		})
+	}
+}
+
+func TestActorMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		authorization string
+		actor         string
+		expected      string
+	}{
+		{
+			name:     "Anonymous",
+			expected: "",
+		},
+		{
+			name:          "Admin token",
+			authorization: "Bearer s3cret",
+			expected:      AdminActor,
+		},
+		{
+			name:          "Wrong token",
+			authorization: "Bearer guess",
+			expected:      "",
+		},
+		{
+			name:     "Untrusted header",
+			actor:    "alice",
+			expected: "",
+		},
+		{
+			name:     "Trusted header",
+			header:   "X-Forwarded-User",
+			actor:    " alice ",
+			expected: "alice",
+		},
+		{
+			name:          "Admin token wins",
+			header:        "X-Forwarded-User",
+			authorization: "Bearer s3cret",
+			actor:         "alice",
+			expected:      AdminActor,
+		},
+		{
+			name:     "Invalid actor",
+			header:   "X-Forwarded-User",
+			actor:    "alice\x00",
+			expected: "",
+		},
+		{
+			name:     "Header claims admin",
+			header:   "X-Forwarded-User",
+			actor:    "Admin",
+			expected: "",
+		},
+		{
+			name:     "Header claims file edits",
+			header:   "X-Forwarded-User",
+			actor:    FileActor,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := "unset"
+
+			handler := NewActorMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ActorFromContext(r.Context())
+			}), "s3cret", tt.header)
+
+			req := httptest.NewRequest(http.MethodGet, "/anchors", http.NoBody)
+			req.Header.Set("Authorization", tt.authorization)
+			req.Header.Set("X-Forwarded-User", tt.actor)
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assertEqual(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package junkboy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work run periodically by a JobRunner.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type JobRunner struct {
+	jobs []Job
+
+	runs        *CounterVec
+	duration    *HistogramVec
+	lastSuccess *GaugeVec
+	active      *GaugeVec
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+func NewJobRunner(reg *Registry) *JobRunner {
+	return &JobRunner{
+		runs: reg.NewCounterVec("junkboy_job_runs_total",
+			"Total number of background job runs by result.", "job", "result"),
+		duration: reg.NewHistogramVec("junkboy_job_duration_seconds",
+			"Background job run durations.", DefaultBuckets, "job"),
+		lastSuccess: reg.NewGaugeVec("junkboy_job_last_success_timestamp_seconds",
+			"Unix time of the last successful run of each background job.", "job"),
+		active: reg.NewGaugeVec("junkboy_job_active",
+			"Number of background jobs currently executing.", "job"),
+	}
+}
+
+// Add registers a job. Jobs must be added before Start.
+func (jr *JobRunner) Add(job Job) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jr.jobs = append(jr.jobs, job)
+}
+
+// Start runs every job in its own goroutine until Stop is called.
+func (jr *JobRunner) Start() {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if jr.running {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jr.cancel = cancel
+	jr.running = true
+
+	for _, job := range jr.jobs {
+		jr.wg.Add(1)
+
+		go jr.loop(ctx, job)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return, or for ctx to be
+// done.
+func (jr *JobRunner) Stop(ctx context.Context) error {
+	jr.mu.Lock()
+	if !jr.running {
+		jr.mu.Unlock()
+		return nil
+	}
+
+	jr.running = false
+	jr.cancel()
+	jr.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		jr.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Running reports whether the runner has been started and not stopped.
+func (jr *JobRunner) Running() bool {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	return jr.running
+}
+
+func (jr *JobRunner) loop(ctx context.Context, job Job) {
+	defer jr.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		jr.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (jr *JobRunner) runOnce(ctx context.Context, job Job) {
+	start := time.Now()
+
+	jr.active.Inc(job.Name)
+	defer jr.active.Dec(job.Name)
+
+	err := job.Run(ctx)
+
+	jr.duration.ObserveDuration(start, job.Name)
+
+	if err != nil {
+		jr.runs.Inc(job.Name, "error")
+		log.Printf("job %s failed: %v", job.Name, err)
+
+		return
+	}
+
+	jr.runs.Inc(job.Name, "success")
+	jr.lastSuccess.Set(float64(time.Now().Unix()), job.Name)
+}
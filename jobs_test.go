@@ -0,0 +1,46 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobRunner(t *testing.T) {
+	reg := NewRegistry()
+	jr := NewJobRunner(reg)
+
+	ran := make(chan struct{}, 10)
+
+	jr.Add(Job{
+		Name:     "ok",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			ran <- struct{}{}
+			return nil
+		},
+	})
+	jr.Add(Job{
+		Name:     "fail",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			ran <- struct{}{}
+			return errors.New("job failed")
+		},
+	})
+
+	jr.Start()
+	assertEqual(t, true, jr.Running())
+
+	<-ran
+	<-ran
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assertNoError(t, jr.Stop(ctx))
+	assertEqual(t, false, jr.Running())
+	assertEqual(t, float64(1), jr.runs.Value("ok", "success"))
+	assertEqual(t, float64(1), jr.runs.Value("fail", "error"))
+}
@@ -0,0 +1,650 @@
+// Package junkboytest provides tests that every junkboy storage backend
+// must pass.
+package junkboytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmaterer/junkboy"
+)
+
+// AnchorRepository is the interface the anchor service needs from a
+// storage backend.
+type AnchorRepository interface {
+	AddAnchor(ctx context.Context, a junkboy.Anchor) (int, error)
+	UpdateAnchor(ctx context.Context, a junkboy.Anchor) (junkboy.Anchor, error)
+	GetAnchor(ctx context.Context, id int) (junkboy.Anchor, error)
+	GetAnchors(ctx context.Context) ([]junkboy.Anchor, error)
+	ListAnchors(ctx context.Context, after, limit int) ([]junkboy.Anchor, error)
+	DeleteAnchor(ctx context.Context, id, version int) error
+	ListTrash(ctx context.Context) ([]junkboy.TrashedAnchor, error)
+	RestoreAnchor(ctx context.Context, id int) (junkboy.Anchor, error)
+	PurgeAnchor(ctx context.Context, id int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	AddRevision(ctx context.Context, rev junkboy.Revision) (junkboy.Revision, error)
+	ListRevisions(ctx context.Context, anchorID int) ([]junkboy.Revision, error)
+	GetRevision(ctx context.Context, anchorID, number int) (junkboy.Revision, error)
+	AddEvent(ctx context.Context, e junkboy.AnchorEvent) (junkboy.LoggedEvent, error)
+	ListEvents(ctx context.Context, after, limit int) ([]junkboy.LoggedEvent, error)
+	LastEventID(ctx context.Context) (int, error)
+	PruneEvents(ctx context.Context, upTo int) error
+}
+
+// AnchorRepositoryFactory returns an empty repository. It is called once
+// per subtest and should register any cleanup with t.Cleanup.
+type AnchorRepositoryFactory func(t *testing.T) AnchorRepository
+
+// RunAnchorRepositoryTests checks that the repositories returned by
+// factory behave like the reference SQLite implementation.
+func RunAnchorRepositoryTests(t *testing.T, factory AnchorRepositoryFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r AnchorRepository)
+	}{
+		{"CRUD", testCRUD},
+		{"NotFound", testNotFound},
+		{"Versions", testVersions},
+		{"Trash", testTrash},
+		{"Revisions", testRevisions},
+		{"Events", testEvents},
+		{"Ordering", testOrdering},
+		{"Pagination", testPagination},
+		{"Concurrency", testConcurrency},
+		{"Unicode", testUnicode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+func testCRUD(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+
+	if anchors == nil || len(anchors) != 0 {
+		t.Fatalf("expected an empty, non-nil list, got %#v", anchors)
+	}
+
+	// The ID of the anchor passed in is ignored.
+	id, err := r.AddAnchor(ctx, junkboy.Anchor{ID: 1000, URL: "https://example.com"})
+	assertNoError(t, err)
+
+	if id <= 0 {
+		t.Fatalf("expected a positive id, got %d", id)
+	}
+
+	anchor, err := r.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: "https://example.com", Version: 1}, anchor)
+
+	other, err := r.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com/other"})
+	assertNoError(t, err)
+
+	if other == id {
+		t.Fatalf("expected a new id, got %d twice", id)
+	}
+
+	anchor.URL = "https://example.com/updated"
+	updated, err := r.UpdateAnchor(ctx, anchor)
+	assertNoError(t, err)
+
+	got, err := r.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, updated, got)
+	assertEqual(t, junkboy.Anchor{ID: id, URL: anchor.URL, Version: 2}, got)
+
+	assertNoError(t, r.DeleteAnchor(ctx, id, 0))
+
+	anchors, err = r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+	assertEqual(t, other, anchors[0].ID)
+}
+
+func testNotFound(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	id, err := r.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+	assertNoError(t, r.DeleteAnchor(ctx, id, 0))
+
+	for _, missing := range []int{id, id + 1000, 0, -1} {
+		_, err := r.GetAnchor(ctx, missing)
+		assertNotFound(t, "GetAnchor", missing, err)
+
+		// A missing anchor is not found whatever version is asked for.
+		for _, version := range []int{0, 1} {
+			_, err = r.UpdateAnchor(ctx, junkboy.Anchor{ID: missing, URL: "https://example.com", Version: version})
+			assertNotFound(t, "UpdateAnchor", missing, err)
+
+			err = r.DeleteAnchor(ctx, missing, version)
+			assertNotFound(t, "DeleteAnchor", missing, err)
+		}
+	}
+}
+
+func testVersions(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	id, err := r.AddAnchor(ctx, junkboy.Anchor{URL: "https://example.com", Version: 7})
+	assertNoError(t, err)
+
+	anchor, err := r.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, 1, anchor.Version)
+
+	anchor.URL = "https://example.com/1"
+	anchor, err = r.UpdateAnchor(ctx, anchor)
+	assertNoError(t, err)
+	assertEqual(t, 2, anchor.Version)
+
+	// Version 0 updates whatever the current version is.
+	anchor, err = r.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/2"})
+	assertNoError(t, err)
+	assertEqual(t, 3, anchor.Version)
+
+	for _, stale := range []int{1, 2, 4} {
+		_, err = r.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com/stale", Version: stale})
+		assertVersionMismatch(t, "UpdateAnchor", stale, err)
+
+		err = r.DeleteAnchor(ctx, id, stale)
+		assertVersionMismatch(t, "DeleteAnchor", stale, err)
+	}
+
+	// Failed updates leave the anchor alone.
+	got, err := r.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, anchor, got)
+
+	assertNoError(t, r.DeleteAnchor(ctx, id, 3))
+
+	_, err = r.GetAnchor(ctx, id)
+	assertNotFound(t, "GetAnchor", id, err)
+}
+
+func testTrash(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+	ids := addAnchors(t, r, 3)
+
+	trash, err := r.ListTrash(ctx)
+	assertNoError(t, err)
+
+	if trash == nil || len(trash) != 0 {
+		t.Fatalf("expected an empty, non-nil trash, got %#v", trash)
+	}
+
+	before := time.Now().Add(-time.Second)
+
+	assertNoError(t, r.DeleteAnchor(ctx, ids[0], 0))
+	assertNoError(t, r.DeleteAnchor(ctx, ids[1], 1))
+
+	// Deleted anchors are hidden everywhere but the trash.
+	for _, id := range ids[:2] {
+		_, err := r.GetAnchor(ctx, id)
+		assertNotFound(t, "GetAnchor", id, err)
+
+		_, err = r.UpdateAnchor(ctx, junkboy.Anchor{ID: id, URL: "https://example.com"})
+		assertNotFound(t, "UpdateAnchor", id, err)
+
+		err = r.DeleteAnchor(ctx, id, 0)
+		assertNotFound(t, "DeleteAnchor", id, err)
+	}
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+
+	anchors, err = r.ListAnchors(ctx, 0, 10)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+
+	// The most recently deleted anchor comes first.
+	trash, err = r.ListTrash(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(trash))
+	assertEqual(t, ids[1], trash[0].ID)
+	assertEqual(t, ids[0], trash[1].ID)
+	assertEqual(t, 1, trash[0].Version)
+
+	for _, a := range trash {
+		if a.DeletedAt.Before(before) || a.DeletedAt.After(time.Now().Add(time.Second)) {
+			t.Errorf("anchor %d: unexpected deleted_at %v", a.ID, a.DeletedAt)
+		}
+	}
+
+	// Restoring makes a new version, so stale copies cannot overwrite it.
+	restored, err := r.RestoreAnchor(ctx, ids[0])
+	assertNoError(t, err)
+	assertEqual(t, junkboy.Anchor{ID: ids[0], URL: "https://example.com/0", Version: 2}, restored)
+
+	got, err := r.GetAnchor(ctx, ids[0])
+	assertNoError(t, err)
+	assertEqual(t, restored, got)
+
+	// Only anchors in the trash can be restored or purged.
+	for _, id := range []int{ids[0], ids[2], ids[2] + 1000} {
+		_, err = r.RestoreAnchor(ctx, id)
+		assertNotFound(t, "RestoreAnchor", id, err)
+
+		err = r.PurgeAnchor(ctx, id)
+		assertNotFound(t, "PurgeAnchor", id, err)
+	}
+
+	n, err := r.PurgeTrash(ctx, before)
+	assertNoError(t, err)
+	assertEqual(t, 0, n)
+
+	assertNoError(t, r.PurgeAnchor(ctx, ids[1]))
+
+	_, err = r.RestoreAnchor(ctx, ids[1])
+	assertNotFound(t, "RestoreAnchor", ids[1], err)
+
+	assertNoError(t, r.DeleteAnchor(ctx, ids[2], 0))
+
+	n, err = r.PurgeTrash(ctx, time.Now().Add(time.Second))
+	assertNoError(t, err)
+	assertEqual(t, 1, n)
+
+	trash, err = r.ListTrash(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(trash))
+}
+
+func testRevisions(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+	ids := addAnchors(t, r, 2)
+
+	revisions, err := r.ListRevisions(ctx, ids[0])
+	assertNoError(t, err)
+
+	if revisions == nil || len(revisions) != 0 {
+		t.Fatalf("expected no revisions, got %#v", revisions)
+	}
+
+	before := time.Now().Add(-time.Second)
+
+	var added []junkboy.Revision
+
+	for i, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		rev, err := r.AddRevision(ctx, junkboy.Revision{
+			AnchorID: ids[0],
+			Actor:    "alice",
+			Anchor:   junkboy.Anchor{ID: ids[0], URL: url, Version: i + 1},
+			Changes:  []junkboy.FieldChange{{Field: "url", Old: nil, New: url}},
+		})
+		assertNoError(t, err)
+		assertEqual(t, i+1, rev.Number)
+
+		if rev.CreatedAt.Before(before) || rev.CreatedAt.After(time.Now().Add(time.Second)) {
+			t.Errorf("revision %d: unexpected created_at %v", rev.Number, rev.CreatedAt)
+		}
+
+		added = append(added, rev)
+	}
+
+	// Every anchor numbers its revisions from 1.
+	other, err := r.AddRevision(ctx, junkboy.Revision{AnchorID: ids[1], Anchor: junkboy.Anchor{ID: ids[1], URL: "https://example.com/c", Version: 1}})
+	assertNoError(t, err)
+	assertEqual(t, 1, other.Number)
+
+	revisions, err = r.ListRevisions(ctx, ids[0])
+	assertNoError(t, err)
+	assertEqual(t, len(added), len(revisions))
+
+	for i := range added {
+		assertRevision(t, added[i], revisions[i])
+	}
+
+	got, err := r.GetRevision(ctx, ids[0], 2)
+	assertNoError(t, err)
+	assertRevision(t, added[1], got)
+
+	for _, missing := range [][2]int{{ids[0], 3}, {ids[0], 0}, {ids[1] + 1000, 1}} {
+		_, err := r.GetRevision(ctx, missing[0], missing[1])
+		if !errors.Is(err, junkboy.ErrRevisionNotFound) {
+			t.Fatalf("GetRevision(%d, %d): expected ErrRevisionNotFound, got %v", missing[0], missing[1], err)
+		}
+	}
+
+	// Revisions survive the trash but not a purge.
+	assertNoError(t, r.DeleteAnchor(ctx, ids[0], 0))
+
+	revisions, err = r.ListRevisions(ctx, ids[0])
+	assertNoError(t, err)
+	assertEqual(t, 2, len(revisions))
+
+	assertNoError(t, r.PurgeAnchor(ctx, ids[0]))
+
+	revisions, err = r.ListRevisions(ctx, ids[0])
+	assertNoError(t, err)
+	assertEqual(t, 0, len(revisions))
+
+	revisions, err = r.ListRevisions(ctx, ids[1])
+	assertNoError(t, err)
+	assertEqual(t, 1, len(revisions))
+}
+
+func assertRevision(t *testing.T, expected, got junkboy.Revision) {
+	t.Helper()
+
+	if expected.AnchorID != got.AnchorID || expected.Number != got.Number || expected.Actor != got.Actor ||
+		!expected.CreatedAt.Equal(got.CreatedAt) || expected.Anchor != got.Anchor || len(expected.Changes) != len(got.Changes) {
+		t.Fatalf("Not equal: \nexpected: %+v\ngot: %+v", expected, got)
+	}
+
+	for i := range expected.Changes {
+		assertEqual(t, expected.Changes[i], got.Changes[i])
+	}
+}
+
+func testEvents(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	last, err := r.LastEventID(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, last)
+
+	events, err := r.ListEvents(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	// Stores may keep times to the microsecond only.
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	var added []junkboy.LoggedEvent
+
+	for i, eventType := range []string{junkboy.AnchorCreated, junkboy.AnchorUpdated, junkboy.AnchorDeleted, junkboy.AnchorRestored} {
+		logged, err := r.AddEvent(ctx, junkboy.AnchorEvent{
+			Type:   eventType,
+			Time:   now.Add(time.Duration(i) * time.Second),
+			Actor:  "alice",
+			Anchor: junkboy.Anchor{ID: 7, URL: "https://example.com/ü", Version: i + 1},
+		})
+		assertNoError(t, err)
+
+		// IDs go up by one, with no gaps.
+		assertEqual(t, i+1, logged.ID)
+		added = append(added, logged)
+	}
+
+	events, err = r.ListEvents(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, len(added), len(events))
+
+	for i := range added {
+		assertEvent(t, added[i], events[i])
+	}
+
+	events, err = r.ListEvents(ctx, 1, 2)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(events))
+	assertEqual(t, 2, events[0].ID)
+	assertEqual(t, 3, events[1].ID)
+
+	events, err = r.ListEvents(ctx, 4, 0)
+	assertNoError(t, err)
+	assertEqual(t, 0, len(events))
+
+	// Pruning drops the oldest events but keeps the IDs going.
+	assertNoError(t, r.PruneEvents(ctx, 2))
+
+	events, err = r.ListEvents(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(events))
+	assertEvent(t, added[2], events[0])
+
+	assertNoError(t, r.PruneEvents(ctx, 4))
+
+	last, err = r.LastEventID(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 4, last)
+
+	logged, err := r.AddEvent(ctx, junkboy.AnchorEvent{Type: junkboy.AnchorCreated, Time: now, Anchor: junkboy.Anchor{ID: 7}})
+	assertNoError(t, err)
+	assertEqual(t, 5, logged.ID)
+}
+
+func assertEvent(t *testing.T, expected, got junkboy.LoggedEvent) {
+	t.Helper()
+
+	if expected.ID != got.ID || expected.Type != got.Type || expected.Actor != got.Actor ||
+		!expected.Time.Equal(got.Time) || expected.Anchor != got.Anchor {
+		t.Fatalf("Not equal: \nexpected: %+v\ngot: %+v", expected, got)
+	}
+}
+
+func testOrdering(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	ids := addAnchors(t, r, 10)
+
+	// Deleting and updating must not change the order of the rest.
+	assertNoError(t, r.DeleteAnchor(ctx, ids[3], 0))
+
+	_, err := r.UpdateAnchor(ctx, junkboy.Anchor{ID: ids[0], URL: "https://example.com/updated"})
+	assertNoError(t, err)
+
+	ids = append(ids[:3], ids[4:]...)
+	ids = append(ids, addAnchors(t, r, 1)...)
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, len(ids), len(anchors))
+
+	for i, anchor := range anchors {
+		assertEqual(t, ids[i], anchor.ID)
+
+		if i > 0 && anchors[i-1].ID >= anchor.ID {
+			t.Fatalf("anchors not in id order: %d before %d", anchors[i-1].ID, anchor.ID)
+		}
+	}
+}
+
+func testPagination(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	ids := addAnchors(t, r, 7)
+
+	var got []int
+
+	after := 0
+
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatalf("pagination did not terminate, got %v", got)
+		}
+
+		page, err := r.ListAnchors(ctx, after, 3)
+		assertNoError(t, err)
+
+		if len(page) > 3 {
+			t.Fatalf("expected at most 3 anchors, got %d", len(page))
+		}
+
+		if len(page) == 0 {
+			break
+		}
+
+		for _, anchor := range page {
+			got = append(got, anchor.ID)
+		}
+
+		after = page[len(page)-1].ID
+	}
+
+	assertEqual(t, fmt.Sprint(ids), fmt.Sprint(got))
+
+	all, err := r.ListAnchors(ctx, 0, 0)
+	assertNoError(t, err)
+	assertEqual(t, len(ids), len(all))
+
+	rest, err := r.ListAnchors(ctx, ids[4], 0)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(rest))
+	assertEqual(t, ids[5], rest[0].ID)
+
+	empty, err := r.ListAnchors(ctx, ids[len(ids)-1], 10)
+	assertNoError(t, err)
+
+	if empty == nil || len(empty) != 0 {
+		t.Fatalf("expected an empty, non-nil page, got %#v", empty)
+	}
+}
+
+func testConcurrency(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	const workers, perWorker = 8, 10
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[int]bool{}
+		errs = make(chan error, workers)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < perWorker; i++ {
+				url := fmt.Sprintf("https://example.com/%d/%d", w, i)
+
+				id, err := r.AddAnchor(ctx, junkboy.Anchor{URL: url})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				anchor, err := r.GetAnchor(ctx, id)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if anchor.URL != url {
+					errs <- fmt.Errorf("anchor %d has url %q, expected %q", id, anchor.URL, url)
+					return
+				}
+
+				if _, err := r.GetAnchors(ctx); err != nil {
+					errs <- err
+					return
+				}
+
+				mu.Lock()
+				duplicate := seen[id]
+				seen[id] = true
+				mu.Unlock()
+
+				if duplicate {
+					errs <- fmt.Errorf("id %d returned twice", id)
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, workers*perWorker, len(anchors))
+}
+
+func testUnicode(t *testing.T, r AnchorRepository) {
+	ctx := context.Background()
+
+	urls := []string{
+		"https://例え.テスト/パス?q=値",
+		"https://bücher.example/straße#äöü",
+		"https://example.com/🚀/✨?emoji=🎉",
+		"https://مثال.إختبار/مسار",
+		"https://example.com/" + strings.Repeat("长", 2048),
+		"https://example.com/it's \"quoted\"; DROP TABLE anchors; --",
+	}
+
+	for _, url := range urls {
+		id, err := r.AddAnchor(ctx, junkboy.Anchor{URL: url})
+		assertNoError(t, err)
+
+		anchor, err := r.GetAnchor(ctx, id)
+		assertNoError(t, err)
+
+		if anchor.URL != url {
+			t.Errorf("url did not round-trip:\nexpected %q\ngot      %q", url, anchor.URL)
+		}
+	}
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, len(urls), len(anchors))
+}
+
+// addAnchors adds n anchors and returns their ids in order.
+func addAnchors(t *testing.T, r AnchorRepository, n int) []int {
+	t.Helper()
+
+	ids := make([]int, n)
+
+	for i := range ids {
+		id, err := r.AddAnchor(context.Background(), junkboy.Anchor{URL: fmt.Sprintf("https://example.com/%d", i)})
+		assertNoError(t, err)
+
+		ids[i] = id
+	}
+
+	return ids
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func assertEqual(t *testing.T, expected, got interface{}) {
+	t.Helper()
+
+	if expected != got {
+		t.Fatalf("Not equal: \n"+
+			"expected: %+v\n"+
+			"got: %+v", expected, got)
+	}
+}
+
+func assertNotFound(t *testing.T, method string, id int, err error) {
+	t.Helper()
+
+	if !errors.Is(err, junkboy.ErrAnchorNotFound) {
+		t.Fatalf("%s(%d): expected ErrAnchorNotFound, got %v", method, id, err)
+	}
+}
+
+func assertVersionMismatch(t *testing.T, method string, version int, err error) {
+	t.Helper()
+
+	if !errors.Is(err, junkboy.ErrAnchorVersionMismatch) {
+		t.Fatalf("%s at version %d: expected ErrAnchorVersionMismatch, got %v", method, version, err)
+	}
+}
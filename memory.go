@@ -0,0 +1,449 @@
+package junkboy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AnchorMemoryRepository keeps anchors in a map. Like SQLite with
+// AUTOINCREMENT, IDs start at 1 and are never reused, and anchors are
+// listed in ID order. Deleted anchors move to a separate trash map. It is
+// safe for concurrent use.
+type AnchorMemoryRepository struct {
+	mu          sync.RWMutex
+	anchors     map[int]Anchor
+	trash       map[int]TrashedAnchor
+	revisions   map[int][]Revision
+	events      []LoggedEvent
+	lastID      int
+	lastEventID int
+	now         func() time.Time
+}
+
+func NewAnchorMemoryRepository() *AnchorMemoryRepository {
+	return &AnchorMemoryRepository{
+		anchors:   map[int]Anchor{},
+		trash:     map[int]TrashedAnchor{},
+		revisions: map[int][]Revision{},
+		now:       time.Now,
+	}
+}
+
+func (r *AnchorMemoryRepository) AddAnchor(ctx context.Context, a Anchor) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	a.ID = r.lastID
+	a.Version = 1
+	r.anchors[a.ID] = a
+
+	return a.ID, nil
+}
+
+func (r *AnchorMemoryRepository) UpdateAnchor(ctx context.Context, a Anchor) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return a, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.anchors[a.ID]
+	if !ok {
+		return a, ErrAnchorNotFound
+	}
+
+	if a.Version != 0 && a.Version != current.Version {
+		return a, ErrAnchorVersionMismatch
+	}
+
+	a.Version = current.Version + 1
+	r.anchors[a.ID] = a
+
+	return a, nil
+}
+
+func (r *AnchorMemoryRepository) GetAnchor(ctx context.Context, id int) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return Anchor{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	anchor, ok := r.anchors[id]
+	if !ok {
+		return Anchor{}, ErrAnchorNotFound
+	}
+
+	return anchor, nil
+}
+
+func (r *AnchorMemoryRepository) GetAnchors(ctx context.Context) ([]Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	anchors := make([]Anchor, 0, len(r.anchors))
+	for _, anchor := range r.anchors {
+		anchors = append(anchors, anchor)
+	}
+
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].ID < anchors[j].ID })
+
+	return anchors, nil
+}
+
+func (r *AnchorMemoryRepository) ListAnchors(ctx context.Context, after, limit int) ([]Anchor, error) {
+	anchors, err := r.GetAnchors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.Search(len(anchors), func(i int) bool { return anchors[i].ID > after })
+	anchors = anchors[i:]
+
+	if limit > 0 && len(anchors) > limit {
+		anchors = anchors[:limit]
+	}
+
+	return anchors, nil
+}
+
+func (r *AnchorMemoryRepository) DeleteAnchor(ctx context.Context, id, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.anchors[id]
+	if !ok {
+		return ErrAnchorNotFound
+	}
+
+	if version != 0 && version != current.Version {
+		return ErrAnchorVersionMismatch
+	}
+
+	delete(r.anchors, id)
+	r.trash[id] = TrashedAnchor{Anchor: current, DeletedAt: r.now().UTC()}
+
+	return nil
+}
+
+func (r *AnchorMemoryRepository) CountAnchors(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.anchors), nil
+}
+
+func (r *AnchorMemoryRepository) ListTrash(ctx context.Context) ([]TrashedAnchor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	anchors := make([]TrashedAnchor, 0, len(r.trash))
+	for _, anchor := range r.trash {
+		anchors = append(anchors, anchor)
+	}
+
+	sort.Slice(anchors, func(i, j int) bool {
+		if !anchors[i].DeletedAt.Equal(anchors[j].DeletedAt) {
+			return anchors[i].DeletedAt.After(anchors[j].DeletedAt)
+		}
+
+		return anchors[i].ID > anchors[j].ID
+	})
+
+	return anchors, nil
+}
+
+func (r *AnchorMemoryRepository) RestoreAnchor(ctx context.Context, id int) (Anchor, error) {
+	if err := ctx.Err(); err != nil {
+		return Anchor{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trashed, ok := r.trash[id]
+	if !ok {
+		return Anchor{}, ErrAnchorNotFound
+	}
+
+	anchor := trashed.Anchor
+	anchor.Version++
+
+	delete(r.trash, id)
+	r.anchors[id] = anchor
+
+	return anchor, nil
+}
+
+func (r *AnchorMemoryRepository) PurgeAnchor(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.trash[id]; !ok {
+		return ErrAnchorNotFound
+	}
+
+	delete(r.trash, id)
+	delete(r.revisions, id)
+
+	return nil
+}
+
+func (r *AnchorMemoryRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+
+	for id, anchor := range r.trash {
+		if anchor.DeletedAt.Before(before) {
+			delete(r.trash, id)
+			delete(r.revisions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (r *AnchorMemoryRepository) AddRevision(ctx context.Context, rev Revision) (Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return rev, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rev.Number = len(r.revisions[rev.AnchorID]) + 1
+	rev.CreatedAt = r.now().UTC()
+	r.revisions[rev.AnchorID] = append(r.revisions[rev.AnchorID], rev)
+
+	return rev, nil
+}
+
+func (r *AnchorMemoryRepository) ListRevisions(ctx context.Context, anchorID int) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Revision{}, r.revisions[anchorID]...), nil
+}
+
+func (r *AnchorMemoryRepository) GetRevision(ctx context.Context, anchorID, number int) (Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return Revision{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := r.revisions[anchorID]
+	if number < 1 || number > len(revisions) {
+		return Revision{}, ErrRevisionNotFound
+	}
+
+	return revisions[number-1], nil
+}
+
+func (r *AnchorMemoryRepository) AddEvent(ctx context.Context, e AnchorEvent) (LoggedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return LoggedEvent{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastEventID++
+	logged := LoggedEvent{ID: r.lastEventID, AnchorEvent: e}
+	r.events = append(r.events, logged)
+
+	return logged, nil
+}
+
+func (r *AnchorMemoryRepository) ListEvents(ctx context.Context, after, limit int) ([]LoggedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].ID > after })
+	events := r.events[i:]
+
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	return append([]LoggedEvent{}, events...), nil
+}
+
+func (r *AnchorMemoryRepository) LastEventID(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastEventID, nil
+}
+
+func (r *AnchorMemoryRepository) PruneEvents(ctx context.Context, upTo int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Copy rather than reslice so the dropped events can be freed.
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].ID > upTo })
+	r.events = append([]LoggedEvent(nil), r.events[i:]...)
+
+	return nil
+}
+
+// clone returns a copy of r. The caller must hold r.mu.
+func (r *AnchorMemoryRepository) clone() *AnchorMemoryRepository {
+	c := &AnchorMemoryRepository{
+		anchors:     make(map[int]Anchor, len(r.anchors)),
+		trash:       make(map[int]TrashedAnchor, len(r.trash)),
+		revisions:   make(map[int][]Revision, len(r.revisions)),
+		events:      r.events[:len(r.events):len(r.events)],
+		lastID:      r.lastID,
+		lastEventID: r.lastEventID,
+		now:         r.now,
+	}
+
+	for id, anchor := range r.anchors {
+		c.anchors[id] = anchor
+	}
+
+	for id, anchor := range r.trash {
+		c.trash[id] = anchor
+	}
+
+	// Appending to a shared slice could write into the original's array,
+	// which is why the events are capped too.
+	for id, revisions := range r.revisions {
+		c.revisions[id] = revisions[:len(revisions):len(revisions)]
+	}
+
+	return c
+}
+
+// replace takes over the contents of c. The caller must hold r.mu.
+func (r *AnchorMemoryRepository) replace(c *AnchorMemoryRepository) {
+	r.anchors, r.trash, r.revisions, r.lastID = c.anchors, c.trash, c.revisions, c.lastID
+	r.events, r.lastEventID = c.events, c.lastEventID
+}
+
+// MemoryStore holds the in-memory repositories. A transaction works on a
+// copy of them, which replaces the originals when it commits. Transactions
+// block every other call until they finish, so they are serializable.
+type MemoryStore struct {
+	Anchors *AnchorMemoryRepository
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Anchors: NewAnchorMemoryRepository(),
+	}
+}
+
+// Repositories returns the repositories outside of any transaction.
+func (s *MemoryStore) Repositories() Repositories {
+	return Repositories{
+		Anchors: s.Anchors,
+		tx:      s,
+	}
+}
+
+// WithTx runs fn on a copy of the repositories and keeps its changes only
+// if fn returns nil.
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.Anchors.mu.Lock()
+	defer s.Anchors.mu.Unlock()
+
+	return runMemoryTx(s.Anchors, fn)
+}
+
+// Close is a no-op, so that MemoryStore can be used like the SQL stores.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// memorySavepoint nests units of work inside a memory transaction.
+type memorySavepoint struct {
+	anchors *AnchorMemoryRepository
+}
+
+func (s *memorySavepoint) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.anchors.mu.Lock()
+	defer s.anchors.mu.Unlock()
+
+	return runMemoryTx(s.anchors, fn)
+}
+
+// runMemoryTx runs fn on a copy of anchors, which the caller has locked,
+// and keeps the copy if fn succeeds. A panic leaves anchors untouched.
+func runMemoryTx(anchors *AnchorMemoryRepository, fn func(Repositories) error) error {
+	tx := anchors.clone()
+
+	err := fn(Repositories{
+		Anchors: tx,
+		tx:      &memorySavepoint{anchors: tx},
+	})
+	if err != nil {
+		return err
+	}
+
+	anchors.replace(tx)
+
+	return nil
+}
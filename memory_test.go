@@ -0,0 +1,189 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAnchorMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	r := NewAnchorMemoryRepository()
+
+	id, err := r.AddAnchor(ctx, Anchor{ID: 42, URL: "https://example.com/a"})
+	assertNoError(t, err)
+	assertEqual(t, 1, id)
+
+	id, err = r.AddAnchor(ctx, Anchor{URL: "https://example.com/b"})
+	assertNoError(t, err)
+	assertEqual(t, 2, id)
+
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: 1, URL: "https://example.com/c"})
+	assertNoError(t, err)
+
+	anchor, err := r.GetAnchor(ctx, 1)
+	assertNoError(t, err)
+	assertEqual(t, "https://example.com/c", anchor.URL)
+
+	// IDs are not reused after the newest anchor is deleted.
+	assertNoError(t, r.DeleteAnchor(ctx, 2, 0))
+
+	id, err = r.AddAnchor(ctx, Anchor{URL: "https://example.com/d"})
+	assertNoError(t, err)
+	assertEqual(t, 3, id)
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(anchors))
+	assertEqual(t, 1, anchors[0].ID)
+	assertEqual(t, 3, anchors[1].ID)
+
+	_, err = r.GetAnchor(ctx, 2)
+	assertEqual(t, ErrAnchorNotFound, err)
+	_, err = r.UpdateAnchor(ctx, Anchor{ID: 2})
+	assertEqual(t, ErrAnchorNotFound, err)
+	assertEqual(t, ErrAnchorNotFound, r.DeleteAnchor(ctx, 2, 0))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = r.GetAnchors(cancelled)
+	assertEqual(t, context.Canceled, err)
+}
+
+func TestAnchorMemoryRepositoryConcurrent(t *testing.T) {
+	ctx := context.Background()
+	r := NewAnchorMemoryRepository()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			id, err := r.AddAnchor(ctx, testAnchor)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if _, err := r.GetAnchor(ctx, id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	count, err := r.CountAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 50, count)
+}
+
+func TestMemoryStoreWithTx(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	s := NewMemoryStore()
+
+	err := s.WithTx(ctx, func(repos Repositories) error {
+		if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+			return err
+		}
+
+		err := repos.WithTx(ctx, func(repos Repositories) error {
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			return errBoom
+		})
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+
+		return nil
+	})
+	assertNoError(t, err)
+
+	err = s.WithTx(ctx, func(repos Repositories) error {
+		if err := repos.Anchors.DeleteAnchor(ctx, 1, 0); err != nil {
+			return err
+		}
+
+		return errBoom
+	})
+	assertEqual(t, errBoom, err)
+
+	func() {
+		defer func() { recover() }()
+
+		//nolint:errcheck // The transaction panics.
+		s.Repositories().WithTx(ctx, func(repos Repositories) error {
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			panic("boom")
+		})
+	}()
+
+	anchors, err := s.Anchors.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(anchors))
+	assertEqual(t, 1, anchors[0].ID)
+}
+
+func TestAnchorServiceMemory(t *testing.T) {
+	ctx := context.Background()
+	s := NewAnchorService(NewAnchorMemoryRepository())
+
+	id, err := s.AddAnchor(ctx, testAnchor)
+	assertNoError(t, err)
+
+	anchor, err := s.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, Anchor{ID: id, URL: testAnchor.URL, Version: 1}, anchor)
+
+	assertNoError(t, s.DeleteAnchor(ctx, id, anchor.Version))
+
+	_, err = s.GetAnchor(ctx, id)
+	assertEqual(t, ErrAnchorNotFound, err)
+}
+
+func TestAnchorHTTPHandlerMemory(t *testing.T) {
+	router := NewRouter("/v1")
+	NewAnchorHTTPHandler(NewAnchorService(NewAnchorMemoryRepository())).RegisterRoutes(router)
+
+	tests := []struct {
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		responseBody   string
+	}{
+		{http.MethodPost, "/v1/anchor", `{"url":"https://example.com"}`, http.StatusCreated, `{"id":1}`},
+		{http.MethodGet, "/v1/anchor/1", "", http.StatusOK, `{"id":1,"url":"https://example.com","version":1}`},
+		{http.MethodPut, "/v1/anchor", `{"id":1,"url":"https://example.com/a"}`, http.StatusNoContent, ""},
+		{http.MethodGet, "/v1/anchors", "", http.StatusOK, `[{"id":1,"url":"https://example.com/a","version":2}]`},
+		{http.MethodDelete, "/v1/anchor/1", "", http.StatusNoContent, ""},
+		{http.MethodGet, "/v1/anchor/1", "", http.StatusNotFound, `{"status":404,"message":"anchor not found"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		assertNoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assertEqual(t, tt.expectedStatus, rr.Code)
+		assertEqual(t, tt.responseBody, rr.Body.String())
+	}
+}
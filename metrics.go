@@ -0,0 +1,537 @@
+package junkboy
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets used for latencies, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Labels are constant labels attached to a func-backed metric.
+type Labels map[string]string
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	suffix string
+	labels []labelPair
+	value  float64
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	typ        string
+	collectors []func() []sample
+}
+
+// Registry holds metrics and writes them in the Prometheus text exposition
+// format.
+type Registry struct {
+	mu       sync.Mutex
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: map[string]*metricFamily{},
+	}
+}
+
+func (reg *Registry) register(name, help, typ string, collect func() []sample) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	f, ok := reg.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, help: help, typ: typ}
+		reg.byName[name] = f
+		reg.families = append(reg.families, f)
+	}
+
+	if f.typ != typ {
+		panic(fmt.Sprintf("metric %s registered as both %s and %s", name, f.typ, typ))
+	}
+
+	f.collectors = append(f.collectors, collect)
+}
+
+// NewCounterVec registers a counter partitioned by the given label names.
+func (reg *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(labelNames)}
+	reg.register(name, help, "counter", c.collect)
+
+	return c
+}
+
+// NewGaugeVec registers a gauge partitioned by the given label names.
+func (reg *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(labelNames)}
+	reg.register(name, help, "gauge", g.collect)
+
+	return g
+}
+
+// NewHistogramVec registers a histogram partitioned by the given label
+// names. buckets must be sorted in increasing order.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(labelNames), buckets: buckets}
+	reg.register(name, help, "histogram", h.collect)
+
+	return h
+}
+
+// GaugeFunc registers a gauge whose value is computed by f at scrape time.
+// Registering the same name again with different labels adds a series.
+func (reg *Registry) GaugeFunc(name, help string, labels Labels, f func() float64) {
+	reg.register(name, help, "gauge", funcCollector(labels, f))
+}
+
+// CounterFunc is like GaugeFunc for values that only ever increase.
+func (reg *Registry) CounterFunc(name, help string, labels Labels, f func() float64) {
+	reg.register(name, help, "counter", funcCollector(labels, f))
+}
+
+func funcCollector(labels Labels, f func() float64) func() []sample {
+	pairs := make([]labelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, labelPair{name, value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].name < pairs[j].name })
+
+	return func() []sample {
+		return []sample{{labels: pairs, value: f()}}
+	}
+}
+
+// RegisterDBStats exposes the connection pool statistics of db, labelled
+// with pool.
+func (reg *Registry) RegisterDBStats(pool string, db *sql.DB) {
+	labels := Labels{"pool": pool}
+
+	reg.GaugeFunc("junkboy_db_max_open_connections", "Maximum number of open connections to the database.", labels,
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	reg.GaugeFunc("junkboy_db_open_connections", "Number of established connections to the database.", labels,
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	reg.GaugeFunc("junkboy_db_in_use_connections", "Number of connections currently in use.", labels,
+		func() float64 { return float64(db.Stats().InUse) })
+	reg.GaugeFunc("junkboy_db_idle_connections", "Number of idle connections.", labels,
+		func() float64 { return float64(db.Stats().Idle) })
+	reg.CounterFunc("junkboy_db_wait_count_total", "Total number of connections waited for.", labels,
+		func() float64 { return float64(db.Stats().WaitCount) })
+	reg.CounterFunc("junkboy_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", labels,
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	reg.CounterFunc("junkboy_db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", labels,
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	reg.CounterFunc("junkboy_db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", labels,
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if _, err := reg.WriteTo(w); err != nil {
+		log.Printf("Write failed: %v", err)
+	}
+}
+
+// WriteTo writes every registered metric to w in the Prometheus text format.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.mu.Lock()
+	families := make([]*metricFamily, len(reg.families))
+	copy(families, reg.families)
+	reg.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	for _, f := range families {
+		fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(cw, "# TYPE %s %s\n", f.name, f.typ)
+
+		for _, collect := range f.collectors {
+			for _, s := range collect() {
+				writeSample(cw, f.name, s)
+			}
+		}
+	}
+
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+
+	return cw.n, cw.err
+}
+
+func writeSample(w io.Writer, name string, s sample) {
+	var b strings.Builder
+
+	b.WriteString(name)
+	b.WriteString(s.suffix)
+
+	if len(s.labels) > 0 {
+		b.WriteByte('{')
+
+		for i, l := range s.labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteString(l.name)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabelValue(l.value))
+			b.WriteByte('"')
+		}
+
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(s.value))
+	b.WriteByte('\n')
+
+	fmt.Fprint(w, b.String())
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+
+	return n, err
+}
+
+// vec holds one child per combination of label values.
+type vec struct {
+	mu         sync.Mutex
+	labelNames []string
+	children   map[string]*vecChild
+}
+
+type vecChild struct {
+	labels []labelPair
+	value  interface{}
+}
+
+func newVec(labelNames []string) *vec {
+	return &vec{
+		labelNames: labelNames,
+		children:   map[string]*vecChild{},
+	}
+}
+
+// child returns the child for labelValues, creating it with newValue. It
+// must be called with v.mu held.
+func (v *vec) child(labelValues []string, newValue func() interface{}) *vecChild {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("expected %d label values, got %d", len(v.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	c, ok := v.children[key]
+	if !ok {
+		labels := make([]labelPair, len(labelValues))
+		for i, value := range labelValues {
+			labels[i] = labelPair{v.labelNames[i], value}
+		}
+
+		c = &vecChild{labels: labels, value: newValue()}
+		v.children[key] = c
+	}
+
+	return c
+}
+
+// sortedChildren returns the children ordered by label values. It must be
+// called with v.mu held.
+func (v *vec) sortedChildren() []*vecChild {
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	children := make([]*vecChild, len(keys))
+	for i, k := range keys {
+		children[i] = v.children[k]
+	}
+
+	return children
+}
+
+func newFloat() interface{} {
+	return new(float64)
+}
+
+type CounterVec struct {
+	*vec
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.child(labelValues, newFloat).value.(*float64) += delta
+}
+
+// Value returns the current value of the counter for labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return *c.child(labelValues, newFloat).value.(*float64)
+}
+
+func (c *CounterVec) collect() []sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var samples []sample
+	for _, child := range c.sortedChildren() {
+		samples = append(samples, sample{labels: child.labels, value: *child.value.(*float64)})
+	}
+
+	return samples
+}
+
+type GaugeVec struct {
+	*vec
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	*g.child(labelValues, newFloat).value.(*float64) = value
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	*g.child(labelValues, newFloat).value.(*float64) += delta
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value returns the current value of the gauge for labelValues.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return *g.child(labelValues, newFloat).value.(*float64)
+}
+
+func (g *GaugeVec) collect() []sample {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var samples []sample
+	for _, child := range g.sortedChildren() {
+		samples = append(samples, sample{labels: child.labels, value: *child.value.(*float64)})
+	}
+
+	return samples
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist := h.child(labelValues, func() interface{} {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	}).value.(*histogram)
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			hist.counts[i]++
+		}
+	}
+
+	hist.count++
+	hist.sum += value
+}
+
+// ObserveDuration records the time elapsed since start in seconds.
+func (h *HistogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) collect() []sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var samples []sample
+
+	for _, child := range h.sortedChildren() {
+		hist := child.value.(*histogram)
+
+		for i, upper := range h.buckets {
+			samples = append(samples, sample{
+				suffix: "_bucket",
+				labels: appendLabel(child.labels, "le", formatFloat(upper)),
+				value:  float64(hist.counts[i]),
+			})
+		}
+
+		samples = append(samples,
+			sample{suffix: "_bucket", labels: appendLabel(child.labels, "le", "+Inf"), value: float64(hist.count)},
+			sample{suffix: "_sum", labels: child.labels, value: hist.sum},
+			sample{suffix: "_count", labels: child.labels, value: float64(hist.count)},
+		)
+	}
+
+	return samples
+}
+
+func appendLabel(labels []labelPair, name, value string) []labelPair {
+	out := make([]labelPair, len(labels), len(labels)+1)
+	copy(out, labels)
+
+	return append(out, labelPair{name, value})
+}
+
+// routeMatch is filled in by Router with the pattern of the route that
+// handled the request, so middleware outside the router can label by it.
+// timedOut is set by writeServiceError when a deadline the handler set
+// itself ran out, which the request's context does not show.
+type routeMatch struct {
+	pattern  string
+	timedOut bool
+}
+
+type routeMatchKey struct{}
+
+type MetricsMiddleware struct {
+	handler   http.Handler
+	requests  *CounterVec
+	duration  *HistogramVec
+	inFlight  *GaugeVec
+	cancelled *CounterVec
+}
+
+func NewMetricsMiddleware(handler http.Handler, reg *Registry) *MetricsMiddleware {
+	return &MetricsMiddleware{
+		handler: handler,
+		requests: reg.NewCounterVec("junkboy_http_requests_total",
+			"Total number of HTTP requests by route pattern, method and status.", "route", "method", "status"),
+		duration: reg.NewHistogramVec("junkboy_http_request_duration_seconds",
+			"HTTP request latencies by route pattern, method and status.", DefaultBuckets, "route", "method", "status"),
+		inFlight: reg.NewGaugeVec("junkboy_http_requests_in_flight",
+			"Number of HTTP requests currently being served."),
+		cancelled: reg.NewCounterVec("junkboy_http_requests_cancelled_total",
+			"Total number of HTTP requests whose context was cancelled or timed out while being served.", "route", "reason"),
+	}
+}
+
+func (h *MetricsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	h.inFlight.Inc()
+	defer h.inFlight.Dec()
+
+	match := &routeMatch{}
+	sw := newStatusWriter(w)
+	ctx := context.WithValue(r.Context(), routeMatchKey{}, match)
+
+	defer func() {
+		route := match.pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := strconv.Itoa(sw.status)
+		h.requests.Inc(route, r.Method, status)
+		h.duration.ObserveDuration(start, route, r.Method, status)
+
+		switch err := ctx.Err(); {
+		case errors.Is(err, context.Canceled):
+			h.cancelled.Inc(route, "canceled")
+		case errors.Is(err, context.DeadlineExceeded) || match.timedOut:
+			h.cancelled.Inc(route, "deadline_exceeded")
+		}
+	}()
+
+	h.handler.ServeHTTP(sw, r.WithContext(ctx))
+}
@@ -0,0 +1,87 @@
+package junkboy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	reg := NewRegistry()
+
+	c := reg.NewCounterVec("test_requests_total", "Requests.", "code")
+	c.Inc("200")
+	c.Add(2, "500")
+	c.Inc("200")
+
+	g := reg.NewGaugeVec("test_in_flight", "In flight.")
+	g.Inc()
+
+	reg.GaugeFunc("test_pool", "Pool \"size\".", Labels{"pool": "a\"b"}, func() float64 { return 3 })
+	reg.GaugeFunc("test_pool", "Pool \"size\".", Labels{"pool": "c"}, func() float64 { return 4 })
+
+	h := reg.NewHistogramVec("test_duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	var buf bytes.Buffer
+	_, err := reg.WriteTo(&buf)
+	assertNoError(t, err)
+
+	expected := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="500"} 2
+# HELP test_in_flight In flight.
+# TYPE test_in_flight gauge
+test_in_flight 1
+# HELP test_pool Pool "size".
+# TYPE test_pool gauge
+test_pool{pool="a\"b"} 3
+test_pool{pool="c"} 4
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 1
+test_duration_seconds_bucket{route="/a",le="1"} 2
+test_duration_seconds_bucket{route="/a",le="+Inf"} 3
+test_duration_seconds_sum{route="/a"} 5.55
+test_duration_seconds_count{route="/a"} 3
+`
+	assertEqual(t, expected, buf.String())
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	reg := NewRegistry()
+	router := NewRouter("/v1")
+	router.AddRoute([]string{"GET"}, "/anchor/([^/]+)", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	// Services time out on a context of their own, not the request's.
+	router.AddRoute([]string{"GET"}, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Nanosecond)
+		defer cancel()
+
+		<-ctx.Done()
+		writeServiceError(w, r, ctx.Err())
+	})
+
+	mw := NewMetricsMiddleware(router, reg)
+
+	for _, path := range []string{"/v1/anchor/1", "/v1/anchor/2", "/v1/nope", "/v1/slow"} {
+		req, err := http.NewRequest(http.MethodGet, path, http.NoBody)
+		assertNoError(t, err)
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assertEqual(t, float64(2), mw.requests.Value("/v1/anchor/([^/]+)", "GET", "418"))
+	assertEqual(t, float64(1), mw.requests.Value("unmatched", "GET", "404"))
+	assertEqual(t, float64(1), mw.requests.Value("/v1/slow", "GET", "504"))
+	assertEqual(t, float64(1), mw.cancelled.Value("/v1/slow", "deadline_exceeded"))
+	assertEqual(t, float64(0), mw.cancelled.Value("/v1/anchor/([^/]+)", "deadline_exceeded"))
+	assertEqual(t, float64(0), mw.inFlight.Value())
+}
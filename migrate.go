@@ -0,0 +1,318 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed db/migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+//go:embed db/migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// ErrSchemaTooNew is returned when the database has been migrated by a
+// newer binary than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies the embedded schema migrations. Its bookkeeping table
+// has the same layout as the one used by golang-migrate, so databases
+// migrated with the migrate CLI are picked up where they left off.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewSQLiteMigrator returns a Migrator for the SQLite schema embedded in
+// the binary.
+func NewSQLiteMigrator(db *sql.DB) (*Migrator, error) {
+	return NewMigrator(db, sqliteMigrations, "db/migrations/sqlite")
+}
+
+// NewPostgresMigrator returns a Migrator for the PostgreSQL schema embedded
+// in the binary.
+func NewPostgresMigrator(db *sql.DB) (*Migrator, error) {
+	return NewMigrator(db, postgresMigrations, "db/migrations/postgres")
+}
+
+// NewMigrator reads migrations named <version>_<name>.(up|down).sql from
+// dir in fsys.
+func NewMigrator(db *sql.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := readMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+func readMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		m := migrationFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the newest known migration.
+func (m *Migrator) LatestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    dirty BOOLEAN NOT NULL
+)`)
+
+	return err
+}
+
+// Version returns the current schema version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+
+	var (
+		version int
+		dirty   bool
+	)
+
+	err := m.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return version, fmt.Errorf("database schema is dirty at version %d, fix it by hand and reset the dirty flag", version)
+	}
+
+	return version, nil
+}
+
+// CheckVersion returns an error unless the schema is exactly at the
+// latest version this binary knows about.
+func (m *Migrator) CheckVersion(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := m.LatestVersion()
+
+	switch {
+	case version > latest:
+		return fmt.Errorf("%w (schema version %d, latest known %d)", ErrSchemaTooNew, version, latest)
+	case version < latest:
+		return fmt.Errorf("database schema is at version %d, expected %d; run 'jbd migrate up'", version, latest)
+	}
+
+	return nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration, Applied: migration.Version <= version}
+	}
+
+	return statuses, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.LatestVersion())
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		return nil
+	}
+
+	target := 0
+
+	for _, migration := range m.migrations {
+		if migration.Version < version {
+			target = migration.Version
+		}
+	}
+
+	return m.To(ctx, target)
+}
+
+// To migrates up or down to version, one migration per transaction.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current > m.LatestVersion() {
+		return fmt.Errorf("%w (schema version %d, latest known %d)", ErrSchemaTooNew, current, m.LatestVersion())
+	}
+
+	if current != 0 && m.index(current) < 0 {
+		return fmt.Errorf("database schema is at unknown version %d", current)
+	}
+
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	for current < version {
+		next := m.migrations[m.index(current)+1]
+		if err := m.apply(ctx, next.Version, next.Up); err != nil {
+			return fmt.Errorf("migration %d_%s up failed: %w", next.Version, next.Name, err)
+		}
+
+		current = next.Version
+	}
+
+	for current > version {
+		i := m.index(current)
+		migration := m.migrations[i]
+
+		previous := 0
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+
+		if err := m.apply(ctx, previous, migration.Down); err != nil {
+			return fmt.Errorf("migration %d_%s down failed: %w", migration.Version, migration.Name, err)
+		}
+
+		current = previous
+	}
+
+	return nil
+}
+
+// index returns the position of version in m.migrations, -1 for version 0
+// or an unknown version.
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *Migrator) apply(ctx context.Context, version int, query string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//nolint:errcheck // Rollback after a successful Commit is a no-op.
+	defer tx.Rollback()
+
+	if strings.TrimSpace(query) != "" {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO schema_migrations (version, dirty) VALUES (%d, false)", version)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
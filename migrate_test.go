@@ -0,0 +1,83 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+var testMigrations = fstest.MapFS{
+	"m/000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+	"m/000001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"m/000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	"m/000002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"m/000003_broken.up.sql":     {Data: []byte("CREATE TABLE c (id INTEGER); NOT SQL;")},
+	"m/000003_broken.down.sql":   {Data: []byte("")},
+	"m/README":                   {Data: []byte("ignored")},
+}
+
+func tableExists(t *testing.T, m *Migrator, name string) bool {
+	t.Helper()
+
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&n)
+	assertNoError(t, err)
+
+	return n == 1
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewMigrator(newTestSQLiteDB(t).Write, testMigrations, "m")
+	assertNoError(t, err)
+
+	assertEqual(t, 3, m.LatestVersion())
+
+	assertNoError(t, m.To(ctx, 2))
+	assertEqual(t, true, tableExists(t, m, "a"))
+	assertEqual(t, true, tableExists(t, m, "b"))
+
+	// The broken migration is rolled back as a whole.
+	assertError(t, m.Up(ctx))
+	assertEqual(t, false, tableExists(t, m, "c"))
+
+	version, err := m.Version(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, version)
+	assertError(t, m.CheckVersion(ctx))
+
+	statuses, err := m.Status(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 3, len(statuses))
+	assertEqual(t, true, statuses[1].Applied)
+	assertEqual(t, false, statuses[2].Applied)
+
+	assertNoError(t, m.Down(ctx))
+	assertEqual(t, false, tableExists(t, m, "b"))
+
+	assertNoError(t, m.To(ctx, 0))
+	assertEqual(t, false, tableExists(t, m, "a"))
+
+	version, err = m.Version(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, version)
+
+	assertError(t, m.To(ctx, 7))
+}
+
+func TestMigratorSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDB(t)
+
+	m, err := NewSQLiteMigrator(db.Write)
+	assertNoError(t, err)
+	assertNoError(t, m.Up(ctx))
+	assertNoError(t, m.CheckVersion(ctx))
+
+	_, err = db.Write.Exec("UPDATE schema_migrations SET version = 99")
+	assertNoError(t, err)
+
+	assertEqual(t, true, errors.Is(m.CheckVersion(ctx), ErrSchemaTooNew))
+	assertEqual(t, true, errors.Is(m.Up(ctx), ErrSchemaTooNew))
+}
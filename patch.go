@@ -0,0 +1,356 @@
+package junkboy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to doc. Objects are
+// merged recursively, null removes a member and anything else replaces
+// the target outright.
+func mergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+			continue
+		}
+
+		docObject[key] = mergePatch(docObject[key], value)
+	}
+
+	return docObject
+}
+
+// jsonPatchOperation is one operation of an RFC 6902 JSON Patch. Value is
+// kept raw so that an explicit null can be told apart from a missing
+// value.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	value interface{}
+}
+
+// parseJSONPatch decodes and checks the shape of a JSON Patch document.
+func parseJSONPatch(data []byte) ([]jsonPatchOperation, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, errors.New("patch must be an array of operations")
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s requires a value", i, op.Op)
+			}
+
+			if err := json.Unmarshal(op.Value, &ops[i].value); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("operation %d: %s requires from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+
+		if op.Path == nil {
+			return nil, fmt.Errorf("operation %d: %s requires a path", i, op.Op)
+		}
+	}
+
+	return ops, nil
+}
+
+// applyJSONPatch applies ops to doc in order, failing as a whole if any
+// of them fails.
+func applyJSONPatch(doc interface{}, ops []jsonPatchOperation) (interface{}, error) {
+	var err error
+
+	for i, op := range ops {
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyJSONPatchOperation(doc interface{}, op jsonPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return jsonPointerAdd(doc, path, op.value)
+	case "remove":
+		doc, _, err = jsonPointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if doc, _, err = jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+
+		return jsonPointerAdd(doc, path, op.value)
+	case "test":
+		value, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(value, op.value) {
+			return nil, fmt.Errorf("test failed at %q", *op.Path)
+		}
+
+		return doc, nil
+	}
+
+	from, err := parseJSONPointer(*op.From)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	if op.Op == "move" {
+		if isJSONPointerPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("cannot move %q into itself", *op.From)
+		}
+
+		doc, value, err = jsonPointerRemove(doc, from)
+	} else {
+		value, err = jsonPointerGet(doc, from)
+		// Copies must not share maps or slices with the original.
+		value = copyJSON(value)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonPointerAdd(doc, path, value)
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into unescaped
+// reference tokens. The empty pointer refers to the whole document.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func isJSONPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", jsonPointerString(path[:i+1]))
+			}
+
+			doc = value
+		case []interface{}:
+			index, err := jsonArrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", jsonPointerString(path[:i+1]))
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonPointerAdd adds value at path and returns the new document, which
+// is value itself if path is empty.
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := jsonPointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			if index, err = jsonArrayIndex(token, len(node)); err != nil {
+				return nil, err
+			}
+		}
+
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+
+		return jsonPointerSet(doc, path[:len(path)-1], node), nil
+	default:
+		return nil, fmt.Errorf("path %q does not exist", jsonPointerString(path[:len(path)-1]))
+	}
+}
+
+// jsonPointerRemove removes the value at path, returning the new
+// document and the value removed.
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := jsonPointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q does not exist", jsonPointerString(path))
+		}
+
+		delete(node, token)
+
+		return doc, value, nil
+	case []interface{}:
+		index, err := jsonArrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+
+		return jsonPointerSet(doc, path[:len(path)-1], node), value, nil
+	default:
+		return nil, nil, fmt.Errorf("path %q does not exist", jsonPointerString(path))
+	}
+}
+
+// jsonPointerSet replaces the existing value at path, which arrays need
+// as appending may move them.
+func jsonPointerSet(doc interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	parent, _ := jsonPointerGet(doc, path[:len(path)-1])
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+	case []interface{}:
+		index, _ := strconv.Atoi(token)
+		node[index] = value
+	}
+
+	return doc
+}
+
+// jsonArrayIndex parses an array index token, which must be between 0
+// and max.
+func jsonArrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return index, nil
+}
+
+func jsonPointerString(path []string) string {
+	var b strings.Builder
+
+	for _, token := range path {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+
+	return b.String()
+}
+
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyJSON(value)
+		}
+
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyJSON(value)
+		}
+
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,126 @@
+package junkboy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// The examples from RFC 7396, appendix A.
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			got := mergePatch(decodeTestJSON(t, tt.doc), decodeTestJSON(t, tt.patch))
+			assertEqual(t, tt.want, encodeTestJSON(t, got))
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Mostly the examples from RFC 6902, appendix A.
+	tests := []struct {
+		name        string
+		doc         string
+		patch       string
+		want        string
+		errExpected bool
+	}{
+		{"Add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{"Add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{"Add to end", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, false},
+		{"Add null", `{}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`, false},
+		{"Remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{"Remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{"Replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{"Move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{"Move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, false},
+		{"Copy", `{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"},{"op":"replace","path":"/bar/a","value":2}]`, `{"bar":{"a":2},"foo":{"a":1}}`, false},
+		{"Escaped path", `{"/":1,"~":2}`, `[{"op":"replace","path":"/~1","value":3},{"op":"remove","path":"/~0"}]`, `{"/":3}`, false},
+		{"Replace whole document", `{"foo":1}`, `[{"op":"replace","path":"","value":{"bar":2}}]`, `{"bar":2}`, false},
+		{"Test ok", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{"Test failed", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", true},
+		{"Add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", true},
+		{"Remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", true},
+		{"Replace missing", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, "", true},
+		{"Array index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`, "", true},
+		{"Array index leading zero", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", true},
+		{"Move into itself", `{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, "", true},
+		{"Invalid path", `{}`, `[{"op":"add","path":"foo","value":1}]`, "", true},
+		{"Atomic", `{"foo":1}`, `[{"op":"replace","path":"/foo","value":2},{"op":"test","path":"/foo","value":1}]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := parseJSONPatch([]byte(tt.patch))
+			assertNoError(t, err)
+
+			got, err := applyJSONPatch(decodeTestJSON(t, tt.doc), ops)
+			if tt.errExpected {
+				assertError(t, err)
+				return
+			}
+
+			assertNoError(t, err)
+			assertEqual(t, tt.want, encodeTestJSON(t, got))
+		})
+	}
+}
+
+func TestParseJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"Not an array", `{"op":"add","path":"/a","value":1}`},
+		{"Unknown op", `[{"op":"merge","path":"/a"}]`},
+		{"Missing path", `[{"op":"remove"}]`},
+		{"Missing value", `[{"op":"add","path":"/a"}]`},
+		{"Missing from", `[{"op":"copy","path":"/a"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJSONPatch([]byte(tt.patch))
+			assertError(t, err)
+		})
+	}
+}
+
+func decodeTestJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	assertNoError(t, json.Unmarshal([]byte(s), &v))
+
+	return v
+}
+
+func encodeTestJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	js, err := json.Marshal(v)
+	assertNoError(t, err)
+
+	return string(js)
+}
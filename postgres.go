@@ -0,0 +1,136 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type PostgresOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func DefaultPostgresOptions() PostgresOptions {
+	return PostgresOptions{
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+	}
+}
+
+func (o PostgresOptions) Validate() error {
+	if o.MaxOpenConns < 1 {
+		return fmt.Errorf("max open connections must be at least 1")
+	}
+
+	if o.MaxIdleConns < 0 || o.MaxIdleConns > o.MaxOpenConns {
+		return fmt.Errorf("max idle connections must be between 0 and max open connections")
+	}
+
+	if o.ConnMaxLifetime < 0 {
+		return fmt.Errorf("connection max lifetime must not be negative")
+	}
+
+	return nil
+}
+
+// NewPostgresDB opens a PostgreSQL database through the "postgres" driver,
+// which the caller must register (e.g. by importing github.com/lib/pq).
+func NewPostgresDB(dsn string, opts PostgresOptions) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("dsn required")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// PostgresStore holds the PostgreSQL repositories and runs units of work
+// across them in a single transaction.
+type PostgresStore struct {
+	Anchors *AnchorPostgresRepository
+
+	tx *sqlTransactor
+}
+
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*PostgresStore, error) {
+	anchors, err := NewAnchorPostgresRepository(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PostgresStore{
+		Anchors: anchors,
+	}
+
+	s.tx = &sqlTransactor{
+		db:        db,
+		bind:      s.bind,
+		retryable: isPostgresRetryable,
+	}
+
+	return s, nil
+}
+
+func (s *PostgresStore) bind(ctx context.Context, tx *sql.Tx) Repositories {
+	return Repositories{
+		Anchors: s.Anchors.inTx(ctx, tx),
+	}
+}
+
+// Repositories returns the repositories outside of any transaction.
+func (s *PostgresStore) Repositories() Repositories {
+	return Repositories{
+		Anchors: s.Anchors,
+		tx:      s.tx,
+	}
+}
+
+// WithTx runs fn in a transaction, retrying it on serialization failures
+// and deadlocks.
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	return s.tx.WithTx(ctx, fn)
+}
+
+// Close closes the prepared statements of every repository.
+func (s *PostgresStore) Close() error {
+	return s.Anchors.Close()
+}
+
+// isPostgresRetryable reports whether err is a serialization failure or a
+// deadlock. Both lib/pq and pgx errors expose the SQLSTATE code.
+func isPostgresRetryable(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.SQLState() {
+	case "40001", "40P01":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,236 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresTestServer returns the DSN of a PostgreSQL server to test
+// against: the one in JUNKBOY_TEST_POSTGRES_DSN, or else one started for
+// the test from a local installation and stopped when it ends. The test is
+// skipped if there is neither. Tests must not touch the database the DSN
+// names directly, but work in a schema from PostgresTestSchema.
+//
+// It is exported for the conformance tests in package junkboy_test.
+func PostgresTestServer(t *testing.T) string {
+	t.Helper()
+
+	if dsn := os.Getenv("JUNKBOY_TEST_POSTGRES_DSN"); dsn != "" {
+		return dsn
+	}
+
+	initdb, postgres := findPostgres()
+	if initdb == "" || postgres == "" {
+		t.Skip("JUNKBOY_TEST_POSTGRES_DSN not set and no local postgres found")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("JUNKBOY_TEST_POSTGRES_DSN not set and a local postgres cannot run as root")
+	}
+
+	// The socket path is limited to about 100 bytes, which t.TempDir can
+	// exceed.
+	dir, err := os.MkdirTemp("", "junkboy-pg")
+	assertNoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	data := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "--no-sync", "--auth=trust", "--username=junkboy", "-D", data).CombinedOutput()
+	if err != nil {
+		t.Fatalf("initdb failed: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(postgres, "-D", data, "-k", dir, "-c", "listen_addresses=", "-c", "fsync=off")
+	assertNoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	})
+
+	dsn := fmt.Sprintf("host=%s user=junkboy dbname=postgres sslmode=disable", dir)
+
+	db, err := sql.Open("postgres", dsn)
+	assertNoError(t, err)
+	defer db.Close()
+
+	for start := time.Now(); db.Ping() != nil; time.Sleep(50 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("local postgres did not start")
+		}
+	}
+
+	return dsn
+}
+
+// findPostgres looks for the initdb and postgres binaries on the PATH and
+// where distributions put them.
+func findPostgres() (initdb, postgres string) {
+	dirs := []string{""}
+	found, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	dirs = append(dirs, found...)
+	dirs = append(dirs, "/usr/local/pgsql/bin")
+
+	for _, dir := range dirs {
+		initdb, _ = exec.LookPath(filepath.Join(dir, "initdb"))
+		postgres, _ = exec.LookPath(filepath.Join(dir, "postgres"))
+
+		if initdb != "" && postgres != "" {
+			return initdb, postgres
+		}
+	}
+
+	return "", ""
+}
+
+// PostgresTestSchema creates a schema of its own for the test on the
+// server at dsn, dropped when the test ends, and returns a DSN that works
+// in it, so tests never touch each other's tables or anyone else's.
+//
+// It is exported for the conformance tests in package junkboy_test.
+func PostgresTestSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	db, err := sql.Open("postgres", dsn)
+	assertNoError(t, err)
+
+	schema := "junkboy_test_" + newRequestID()
+
+	_, err = db.Exec("CREATE SCHEMA " + schema)
+	assertNoError(t, err)
+
+	t.Cleanup(func() {
+		defer db.Close()
+
+		if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// Unknown settings in the DSN are passed to the server, which makes
+	// the schema the only one unqualified names are looked up in.
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	assertNoError(t, err)
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// newTestPostgresStore returns a store migrated to the latest version in
+// a schema of its own.
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+
+	dsn := PostgresTestSchema(t, PostgresTestServer(t))
+	ctx := context.Background()
+
+	db, err := NewPostgresDB(dsn, DefaultPostgresOptions())
+	assertNoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewPostgresMigrator(db)
+	assertNoError(t, err)
+	assertNoError(t, m.Up(ctx))
+
+	s, err := NewPostgresStore(ctx, db)
+	assertNoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestAnchorPostgresRepository(t *testing.T) {
+	ctx := context.Background()
+	r := newTestPostgresStore(t).Anchors
+
+	id, err := r.AddAnchor(ctx, testAnchor)
+	assertNoError(t, err)
+
+	anchor, err := r.GetAnchor(ctx, id)
+	assertNoError(t, err)
+	assertEqual(t, testAnchor.URL, anchor.URL)
+
+	anchor.URL = "https://example.com/updated"
+	anchor, err = r.UpdateAnchor(ctx, anchor)
+	assertNoError(t, err)
+	assertEqual(t, 2, anchor.Version)
+
+	_, err = r.AddAnchor(ctx, Anchor{URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	anchors, err := r.GetAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(anchors))
+	assertEqual(t, anchor, anchors[0])
+
+	assertNoError(t, r.DeleteAnchor(ctx, id, anchor.Version))
+
+	count, err := r.CountAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, count)
+
+	_, err = r.GetAnchor(ctx, id)
+	assertEqual(t, ErrAnchorNotFound, err)
+
+	_, err = r.UpdateAnchor(ctx, anchor)
+	assertEqual(t, ErrAnchorNotFound, err)
+	assertEqual(t, ErrAnchorNotFound, r.DeleteAnchor(ctx, id, 0))
+}
+
+func TestPostgresStoreWithTx(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPostgresStore(t)
+	errBoom := errors.New("boom")
+
+	err := s.WithTx(ctx, func(repos Repositories) error {
+		if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+			return err
+		}
+
+		// The savepoint is rolled back, the outer insert is kept.
+		err := repos.WithTx(ctx, func(repos Repositories) error {
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			return errBoom
+		})
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+
+		return nil
+	})
+	assertNoError(t, err)
+
+	err = s.WithTx(ctx, func(repos Repositories) error {
+		if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+			return err
+		}
+
+		return errBoom
+	})
+	assertError(t, err)
+
+	count, err := s.Anchors.CountAnchors(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, count)
+}
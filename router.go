@@ -30,23 +30,23 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	for _, route := range rt.routes {
 		matches := route.regex.FindStringSubmatch(r.URL.Path)
-		if len(matches) > 0 {
-      for _, method := range route.methods {
-        if r.Method != method {
-          allow = append(allow, method)
-          continue
-        }
-      }
-      //if r.Method != route.method {
-			//	allow = append(allow, route.method)
-			//	continue
-			//}
-
-			ctx := context.WithValue(r.Context(), ctxKey{}, matches[1:])
-			route.handler(w, r.WithContext(ctx))
-
-			return
+		if len(matches) == 0 {
+			continue
 		}
+
+		if match, ok := r.Context().Value(routeMatchKey{}).(*routeMatch); ok && match.pattern == "" {
+			match.pattern = route.pattern
+		}
+
+		if !route.allows(r.Method) {
+			allow = appendMissing(allow, route.methods...)
+			continue
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKey{}, matches[1:])
+		route.handler(w, r.WithContext(ctx))
+
+		return
 	}
 
 	if len(allow) > 0 {
@@ -59,14 +59,44 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
+func appendMissing(s []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+
+		for _, existing := range s {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			s = append(s, v)
+		}
+	}
+
+	return s
+}
+
 type route struct {
-	methods  []string
+	methods []string
+	pattern string
 	regex   *regexp.Regexp
 	handler http.HandlerFunc
 }
 
 func newRoute(methods []string, pattern string, handler http.HandlerFunc) route {
-	return route{methods, regexp.MustCompile("^" + pattern + "$"), handler}
+	return route{methods, pattern, regexp.MustCompile("^" + pattern + "$"), handler}
+}
+
+func (rt route) allows(method string) bool {
+	for _, m := range rt.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getField(r *http.Request, index int) string {
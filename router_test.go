@@ -0,0 +1,69 @@
+package junkboy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter("/v1")
+	router.AddRoute([]string{"GET", "OPTIONS"}, "/anchor/([^/]+)", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "get "+getField(r, 0))
+	})
+	router.AddRoute([]string{"DELETE", "OPTIONS"}, "/anchor/([^/]+)", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "delete "+getField(r, 0))
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		handler        string
+		allow          string
+	}{
+		{
+			name:           "Get",
+			method:         http.MethodGet,
+			path:           "/v1/anchor/1",
+			expectedStatus: http.StatusOK,
+			handler:        "get 1",
+		},
+		{
+			name:           "Delete",
+			method:         http.MethodDelete,
+			path:           "/v1/anchor/2",
+			expectedStatus: http.StatusOK,
+			handler:        "delete 2",
+		},
+		{
+			name:           "Method not allowed",
+			method:         http.MethodPut,
+			path:           "/v1/anchor/1",
+			expectedStatus: http.StatusMethodNotAllowed,
+			allow:          "GET, OPTIONS, DELETE",
+		},
+		{
+			name:           "Not found",
+			method:         http.MethodGet,
+			path:           "/v1/anchors/1",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tt.method, tt.path, http.NoBody)
+			assertNoError(t, err)
+
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.handler, rr.Header().Get("X-Handler"))
+			assertEqual(t, tt.allow, rr.Header().Get("Allow"))
+		})
+	}
+}
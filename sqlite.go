@@ -1,16 +1,133 @@
 package junkboy
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 	// _ "github.com/mattn/go-sqlite3"
 )
 
-func NewSQLiteDB(dsn string) (*sql.DB, error) {
+type SQLiteOptions struct {
+	// JournalMode is one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF.
+	JournalMode string
+	BusyTimeout time.Duration
+	ForeignKeys bool
+	// Synchronous is one of OFF, NORMAL, FULL or EXTRA.
+	Synchronous string
+	// MaxReadConns limits the read pool. The write pool always has a
+	// single connection.
+	MaxReadConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func DefaultSQLiteOptions() SQLiteOptions {
+	maxReadConns := runtime.NumCPU()
+	if maxReadConns < 4 {
+		maxReadConns = 4
+	}
+
+	return SQLiteOptions{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		ForeignKeys:  true,
+		Synchronous:  "NORMAL",
+		MaxReadConns: maxReadConns,
+	}
+}
+
+func (o SQLiteOptions) Validate() error {
+	if !oneOf(o.JournalMode, "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF") {
+		return fmt.Errorf("invalid journal mode %q", o.JournalMode)
+	}
+
+	if !oneOf(o.Synchronous, "OFF", "NORMAL", "FULL", "EXTRA") {
+		return fmt.Errorf("invalid synchronous level %q", o.Synchronous)
+	}
+
+	if o.BusyTimeout < 0 {
+		return fmt.Errorf("busy timeout must not be negative")
+	}
+
+	if o.MaxReadConns < 1 {
+		return fmt.Errorf("max read connections must be at least 1")
+	}
+
+	return nil
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SQLiteDB is a SQLite database with a single-connection pool for writes
+// and a separate pool of read-only connections, so that with WAL readers
+// never wait on the writer and writers queue in Go rather than failing
+// with "database is locked".
+type SQLiteDB struct {
+	Write *sql.DB
+	Read  *sql.DB
+}
+
+// NewSQLiteDB opens dsn, which may be a file name or a file: URI. An
+// in-memory database cannot be shared between pools, so Read and Write
+// are the same single connection in that case.
+func NewSQLiteDB(dsn string, opts SQLiteOptions) (*SQLiteDB, error) {
 	if dsn == "" {
 		return nil, fmt.Errorf("dns required")
 	}
 
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	writeDSN, err := sqliteDSN(dsn, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	write, err := openSQLite(writeDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	write.SetMaxOpenConns(1)
+	write.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	if isInMemory(dsn) {
+		return &SQLiteDB{Write: write, Read: write}, nil
+	}
+
+	readDSN, err := sqliteDSN(dsn, opts, true)
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+
+	read, err := openSQLite(readDSN)
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+
+	read.SetMaxOpenConns(opts.MaxReadConns)
+	read.SetMaxIdleConns(opts.MaxReadConns)
+	read.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	return &SQLiteDB{Write: write, Read: read}, nil
+}
+
+func openSQLite(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
@@ -18,8 +135,129 @@ func NewSQLiteDB(dsn string) (*sql.DB, error) {
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+func isInMemory(dsn string) bool {
+	return strings.HasPrefix(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// sqliteDSN adds the connection settings to dsn as go-sqlite3 parameters,
+// which apply them to every new connection in the pool.
+func sqliteDSN(dsn string, opts SQLiteOptions, readOnly bool) (string, error) {
+	path, rawQuery := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, rawQuery = dsn[:i], dsn[i+1:]
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid dsn parameters: %w", err)
+	}
+
+	params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	params.Set("_foreign_keys", strconv.FormatBool(opts.ForeignKeys))
+	params.Set("_synchronous", strings.ToUpper(opts.Synchronous))
+
+	if readOnly {
+		// The writer has already set the journal mode, which a read-only
+		// connection could not change anyway.
+		params.Set("mode", "ro")
+	} else {
+		params.Set("_journal_mode", strings.ToUpper(opts.JournalMode))
+		// Take the write lock at BEGIN so transactions never fail to
+		// upgrade from a read lock halfway through.
+		params.Set("_txlock", "immediate")
+	}
+
+	if !strings.HasPrefix(path, "file:") && path != ":memory:" {
+		path = "file:" + path
+	}
+
+	return path + "?" + params.Encode(), nil
+}
+
+func (db *SQLiteDB) PingContext(ctx context.Context) error {
+	if err := db.Write.PingContext(ctx); err != nil {
+		return err
+	}
+
+	return db.Read.PingContext(ctx)
+}
+
+func (db *SQLiteDB) Close() error {
+	err := db.Write.Close()
+
+	if db.Read != db.Write {
+		if readErr := db.Read.Close(); err == nil {
+			err = readErr
+		}
+	}
+
+	return err
+}
+
+// SQLiteStore holds the SQLite repositories and runs units of work across
+// them in a single transaction on the write connection.
+type SQLiteStore struct {
+	Anchors *AnchorSQLiteRepository
+
+	tx *sqlTransactor
+}
+
+func NewSQLiteStore(ctx context.Context, db *SQLiteDB) (*SQLiteStore, error) {
+	anchors, err := NewAnchorSQLiteRepository(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLiteStore{
+		Anchors: anchors,
+	}
+
+	s.tx = &sqlTransactor{
+		db:        db.Write,
+		bind:      s.bind,
+		retryable: isSQLiteBusy,
+	}
+
+	return s, nil
+}
+
+func (s *SQLiteStore) bind(ctx context.Context, tx *sql.Tx) Repositories {
+	return Repositories{
+		Anchors: s.Anchors.inTx(ctx, tx),
+	}
+}
+
+// Repositories returns the repositories outside of any transaction.
+func (s *SQLiteStore) Repositories() Repositories {
+	return Repositories{
+		Anchors: s.Anchors,
+		tx:      s.tx,
+	}
+}
+
+// WithTx runs fn in a transaction, retrying it if the database is busy.
+// fn must only use the repositories it is given: the write pool has a
+// single connection, which the transaction holds.
+func (s *SQLiteStore) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	return s.tx.WithTx(ctx, fn)
+}
+
+// Close closes the prepared statements of every repository.
+func (s *SQLiteStore) Close() error {
+	return s.Anchors.Close()
+}
+
+// isSQLiteBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED, which
+// go-sqlite3 reports with these messages.
+func isSQLiteBusy(err error) bool {
+	msg := err.Error()
+
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked")
+}
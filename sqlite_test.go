@@ -0,0 +1,80 @@
+package junkboy
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestNewSQLiteDBPragmas(t *testing.T) {
+	db := newTestSQLiteDB(t)
+
+	var journalMode string
+	assertNoError(t, db.Read.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assertEqual(t, "wal", journalMode)
+
+	for _, pool := range []string{"write", "read"} {
+		conn := db.Write
+		if pool == "read" {
+			conn = db.Read
+		}
+
+		var foreignKeys, busyTimeout, synchronous int
+		assertNoError(t, conn.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+		assertNoError(t, conn.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+		assertNoError(t, conn.QueryRow("PRAGMA synchronous").Scan(&synchronous))
+		assertEqual(t, 1, foreignKeys)
+		assertEqual(t, 5000, busyTimeout)
+		assertEqual(t, 1, synchronous) // NORMAL
+	}
+
+	_, err := db.Read.Exec("CREATE TABLE nope (id INTEGER)")
+	assertError(t, err)
+	assertEqual(t, 1, db.Write.Stats().MaxOpenConnections)
+}
+
+func TestNewSQLiteDBInvalidOptions(t *testing.T) {
+	opts := DefaultSQLiteOptions()
+	opts.JournalMode = "SIDEWAYS"
+
+	_, err := NewSQLiteDB(filepath.Join(t.TempDir(), "junkboy.db"), opts)
+	assertError(t, err)
+}
+
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	r := newTestAnchorSQLiteRepository(t)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 200)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := r.AddAnchor(context.Background(), Anchor{URL: "https://example.com"})
+			errs <- err
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			_, err := r.GetAnchors(context.Background())
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assertNoError(t, err)
+	}
+
+	count, err := r.CountAnchors(context.Background())
+	assertNoError(t, err)
+	assertEqual(t, 100, count)
+}
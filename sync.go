@@ -0,0 +1,239 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// SyncItem is the state of one anchor in a sync download: the anchor as
+// it is now, or a tombstone if it was deleted.
+type SyncItem struct {
+	ID      int     `json:"id"`
+	Deleted bool    `json:"deleted,omitempty"`
+	Anchor  *Anchor `json:"anchor,omitempty"`
+}
+
+// SyncChanges is what changed since a sync token. Token is where the next
+// sync picks up. If Full is set the changes are every anchor there is, and
+// the client drops any it has that are not among them. If More is set
+// there are further changes to fetch straight away.
+type SyncChanges struct {
+	Token   int        `json:"token"`
+	Full    bool       `json:"full"`
+	More    bool       `json:"more"`
+	Changes []SyncItem `json:"changes"`
+}
+
+// SyncChange is a change a client made while offline. Updates and deletes
+// carry the version of the anchor the client last saw, and a client ID
+// lets the client match the anchors it created to the IDs they were given.
+type SyncChange struct {
+	Op          string `json:"op"`
+	ClientID    string `json:"client_id,omitempty"`
+	ID          int    `json:"id,omitempty"`
+	URL         string `json:"url,omitempty"`
+	BaseVersion int    `json:"base_version,omitempty"`
+}
+
+// Statuses of a SyncResult.
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncInvalid  = "invalid"
+	SyncError    = "error"
+)
+
+// SyncResult is the outcome of a SyncChange. For applied changes and
+// conflicts it has the anchor as the server now has it, or Deleted if the
+// server has none.
+type SyncResult struct {
+	ClientID string  `json:"client_id,omitempty"`
+	ID       int     `json:"id,omitempty"`
+	Status   string  `json:"status"`
+	Deleted  bool    `json:"deleted,omitempty"`
+	Anchor   *Anchor `json:"anchor,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// SyncService lets offline clients download what changed since they last
+// synced, by a token that is the ID of the last event in the event log
+// they have seen, and upload the changes they made. Events are stored with
+// their changes, so no committed change is missing from a sync.
+//
+// Conflicts are resolved in favour of the server: a change to an anchor
+// that is no longer at the version the client based it on is not applied,
+// and the result has the anchor as the server has it, for the client to
+// merge and upload again. A change that would leave the anchor as the
+// server already has it is not a conflict, and neither is deleting an
+// anchor that is already gone.
+type SyncService struct {
+	anchors *AnchorService
+	events  *EventLog
+}
+
+func NewSyncService(anchors *AnchorService, events *EventLog) *SyncService {
+	return &SyncService{anchors: anchors, events: events}
+}
+
+// Changes returns the anchors that changed after token as they are now,
+// reading at most limit events. A token of 0 gets every anchor. It returns
+// ErrEventsExpired if the token is too old to catch up from.
+//
+// Each anchor is read again rather than taken from its last event, so the
+// client gets it as it is now. An anchor that has changed again since
+// comes again in the next sync, which is harmless because each change is
+// the whole anchor.
+func (s *SyncService) Changes(ctx context.Context, token, limit int) (SyncChanges, error) {
+	if token == 0 {
+		return s.full(ctx)
+	}
+
+	events, err := s.events.Since(ctx, token, limit)
+	if err != nil {
+		return SyncChanges{}, err
+	}
+
+	changes := SyncChanges{Token: token, More: limit > 0 && len(events) == limit, Changes: []SyncItem{}}
+	latest := map[int]LoggedEvent{}
+
+	for _, e := range events {
+		latest[e.Anchor.ID] = e
+		changes.Token = e.ID
+	}
+
+	order := make([]LoggedEvent, 0, len(latest))
+	for _, e := range latest {
+		order = append(order, e)
+	}
+
+	sort.Slice(order, func(i, j int) bool { return order[i].ID < order[j].ID })
+
+	for _, e := range order {
+		item := SyncItem{ID: e.Anchor.ID}
+
+		a, err := s.anchors.GetAnchor(ctx, e.Anchor.ID)
+		switch {
+		case errors.Is(err, ErrAnchorNotFound):
+			item.Deleted = true
+		case err != nil:
+			return SyncChanges{}, err
+		default:
+			item.Anchor = &a
+		}
+
+		changes.Changes = append(changes.Changes, item)
+	}
+
+	return changes, nil
+}
+
+// full returns every anchor. The token is read first, so changes made
+// while the anchors are read come again in the next sync, which is
+// harmless because each change is the whole anchor.
+func (s *SyncService) full(ctx context.Context) (SyncChanges, error) {
+	token, err := s.events.LastID(ctx)
+	if err != nil {
+		return SyncChanges{}, err
+	}
+
+	anchors, err := s.anchors.GetAnchors(ctx)
+	if err != nil {
+		return SyncChanges{}, err
+	}
+
+	changes := SyncChanges{Token: token, Full: true, Changes: make([]SyncItem, len(anchors))}
+	for i := range anchors {
+		changes.Changes[i] = SyncItem{ID: anchors[i].ID, Anchor: &anchors[i]}
+	}
+
+	return changes, nil
+}
+
+// Apply makes the changes in order, each on its own, and returns their
+// outcomes at the same index. The client gets them back, along with
+// everyone else's, on its next download.
+func (s *SyncService) Apply(ctx context.Context, changes []SyncChange) ([]SyncResult, error) {
+	results := make([]SyncResult, len(changes))
+
+	// ops are the changes that go to Bulk, which were at indexes.
+	var (
+		ops     []BulkOperation
+		indexes []int
+	)
+
+	for i, c := range changes {
+		results[i] = SyncResult{ClientID: c.ClientID, ID: c.ID}
+
+		if (c.Op == "update" || c.Op == "delete") && c.BaseVersion <= 0 {
+			results[i].Status = SyncInvalid
+			results[i].Error = c.Op + " requires a base_version"
+
+			continue
+		}
+
+		ops = append(ops, BulkOperation{Op: c.Op, ID: c.ID, URL: c.URL, Version: c.BaseVersion})
+		indexes = append(indexes, i)
+	}
+
+	bulk, err := s.anchors.Bulk(ctx, ops, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range indexes {
+		results[i] = s.result(ctx, changes[i], results[i], bulk[j])
+	}
+
+	return results, nil
+}
+
+// result works out the outcome of a change from what Bulk made of it.
+func (s *SyncService) result(ctx context.Context, c SyncChange, result SyncResult, bulk BulkResult) SyncResult {
+	var opErr *BulkOperationError
+
+	err := bulk.Err
+
+	var current Anchor
+	if errors.Is(err, ErrAnchorVersionMismatch) {
+		// Whether it is a conflict depends on what the server has now.
+		current, err = s.anchors.GetAnchor(ctx, c.ID)
+		if err == nil {
+			err = ErrAnchorVersionMismatch
+		}
+	}
+
+	switch {
+	case err == nil && c.Op == "delete":
+		result.Status = SyncApplied
+		result.Deleted = true
+	case err == nil:
+		a := bulk.Anchor
+		result.ID = a.ID
+		result.Status = SyncApplied
+		result.Anchor = &a
+	case errors.As(err, &opErr):
+		result.Status = SyncInvalid
+		result.Error = err.Error()
+	case errors.Is(err, ErrAnchorNotFound):
+		// The anchor is gone, which is what a delete wanted.
+		result.Status = SyncConflict
+		if c.Op == "delete" {
+			result.Status = SyncApplied
+		}
+
+		result.Deleted = true
+	case errors.Is(err, ErrAnchorVersionMismatch):
+		result.Status = SyncConflict
+		if c.Op == "update" && current.URL == c.URL {
+			result.Status = SyncApplied
+		}
+
+		result.Anchor = &current
+	default:
+		result.Status = SyncError
+		result.Error = err.Error()
+	}
+
+	return result
+}
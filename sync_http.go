@@ -0,0 +1,126 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type syncService interface {
+	Changes(ctx context.Context, token, limit int) (SyncChanges, error)
+	Apply(ctx context.Context, changes []SyncChange) ([]SyncResult, error)
+}
+
+type SyncHTTPHandler struct {
+	service syncService
+
+	maxChanges   int
+	maxBodyBytes int64
+}
+
+// maxSyncPageSize is the largest limit accepted by GET /sync, and the
+// default.
+const maxSyncPageSize = 1000
+
+func NewSyncHTTPHandler(s syncService) *SyncHTTPHandler {
+	return &SyncHTTPHandler{
+		service:      s,
+		maxChanges:   DefaultMaxBulkOperations,
+		maxBodyBytes: DefaultMaxBulkBodyBytes,
+	}
+}
+
+// SetUploadLimits sets the most changes and the largest body accepted by
+// POST /sync.
+func (h *SyncHTTPHandler) SetUploadLimits(maxChanges int, maxBodyBytes int64) {
+	h.maxChanges = maxChanges
+	h.maxBodyBytes = maxBodyBytes
+}
+
+func (h *SyncHTTPHandler) RegisterRoutes(r *Router) {
+	r.AddRoute([]string{"GET", "OPTIONS"}, "/sync", h.getChangesHandler)
+	r.AddRoute([]string{"POST"}, "/sync", h.uploadChangesHandler)
+}
+
+// getChangesHandler returns the changes since the token parameter, or
+// every anchor without one. A token too old to catch up from gets 410
+// Gone, telling the client to sync again from scratch.
+func (h *SyncHTTPHandler) getChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	query := r.URL.Query()
+
+	token, err := queryInt(query, "token", 0)
+	if err != nil || token < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid token '%s'", query.Get("token")))
+		return
+	}
+
+	limit, err := queryInt(query, "limit", maxSyncPageSize)
+	if err != nil || limit < 1 || limit > maxSyncPageSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSyncPageSize))
+		return
+	}
+
+	changes, err := h.service.Changes(r.Context(), token, limit)
+	if errors.Is(err, ErrEventsExpired) {
+		writeError(w, http.StatusGone, "sync token expired, sync again without a token")
+		return
+	}
+
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// uploadChangesHandler applies the changes a client made offline and
+// reports the outcome of each in a result at the same index.
+func (h *SyncHTTPHandler) uploadChangesHandler(w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Changes []SyncChange `json:"changes"`
+	}
+
+	type Response struct {
+		Results []SyncResult `json:"results"`
+	}
+
+	if !contentTypeIsValid(w, r, "application/json") {
+		return
+	}
+
+	var req Request
+	if err := readJSONLimit(w, r, &req, h.maxBodyBytes); err != nil {
+		var tooLarge *bodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	switch {
+	case len(req.Changes) == 0:
+		writeError(w, http.StatusBadRequest, "changes must not be empty")
+		return
+	case len(req.Changes) > h.maxChanges:
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d changes are allowed per request", h.maxChanges))
+		return
+	}
+
+	results, err := h.service.Apply(r.Context(), req.Changes)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Results: results})
+}
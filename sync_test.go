@@ -0,0 +1,230 @@
+package junkboy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestSyncService(t *testing.T, maxEvents int) (*SyncService, *AnchorService, *EventLog) {
+	t.Helper()
+
+	anchors := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+	anchors.SetMaxEvents(maxEvents)
+	events := NewEventLog(anchors)
+
+	return NewSyncService(anchors, events), anchors, events
+}
+
+func TestSyncChanges(t *testing.T) {
+	ctx := context.Background()
+	sync, anchors, _ := newTestSyncService(t, 100)
+
+	a, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+	assertNoError(t, err)
+
+	b, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	full, err := sync.Changes(ctx, 0, 10)
+	assertNoError(t, err)
+	assertEqual(t, true, full.Full)
+	assertEqual(t, 2, full.Token)
+	assertEqual(t, 2, len(full.Changes))
+	assertEqual(t, Anchor{ID: a, URL: "https://example.com/a", Version: 1}, *full.Changes[0].Anchor)
+
+	_, err = anchors.UpdateAnchor(ctx, Anchor{ID: a, URL: "https://example.com/a2"})
+	assertNoError(t, err)
+	_, err = anchors.UpdateAnchor(ctx, Anchor{ID: a, URL: "https://example.com/a3"})
+	assertNoError(t, err)
+	assertNoError(t, anchors.DeleteAnchor(ctx, b, 0))
+
+	// Updates to an anchor collapse to its latest state, and deletions
+	// come as tombstones.
+	delta, err := sync.Changes(ctx, full.Token, 10)
+	assertNoError(t, err)
+	assertEqual(t, false, delta.Full)
+	assertEqual(t, false, delta.More)
+	assertEqual(t, 5, delta.Token)
+	assertEqual(t, 2, len(delta.Changes))
+	assertEqual(t, Anchor{ID: a, URL: "https://example.com/a3", Version: 3}, *delta.Changes[0].Anchor)
+	assertEqual(t, SyncItem{ID: b, Deleted: true}, delta.Changes[1])
+
+	page, err := sync.Changes(ctx, full.Token, 2)
+	assertNoError(t, err)
+	assertEqual(t, true, page.More)
+	assertEqual(t, 4, page.Token)
+
+	page, err = sync.Changes(ctx, page.Token, 2)
+	assertNoError(t, err)
+	assertEqual(t, false, page.More)
+	assertEqual(t, 1, len(page.Changes))
+
+	empty, err := sync.Changes(ctx, delta.Token, 10)
+	assertNoError(t, err)
+	assertEqual(t, delta.Token, empty.Token)
+	assertEqual(t, 0, len(empty.Changes))
+}
+
+// TestSyncChangesSharedStore makes changes through another service on the
+// same store, as another process sharing the database would.
+func TestSyncChangesSharedStore(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStore()
+	anchors := NewAnchorServiceWithRepositories(store.Repositories())
+	sync := NewSyncService(anchors, NewEventLog(anchors))
+	other := NewAnchorServiceWithRepositories(store.Repositories())
+
+	id, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/1"})
+	assertNoError(t, err)
+	_, err = other.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/2"})
+	assertNoError(t, err)
+
+	delta, err := sync.Changes(ctx, 1, 10)
+	assertNoError(t, err)
+	assertEqual(t, 2, delta.Token)
+	assertEqual(t, 1, len(delta.Changes))
+	assertEqual(t, Anchor{ID: id, URL: "https://example.com/2", Version: 2}, *delta.Changes[0].Anchor)
+}
+
+func TestSyncApply(t *testing.T) {
+	ctx := context.Background()
+	sync, anchors, _ := newTestSyncService(t, 100)
+
+	kept, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/kept"})
+	assertNoError(t, err)
+
+	edited, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/edited"})
+	assertNoError(t, err)
+	_, err = anchors.UpdateAnchor(ctx, Anchor{ID: edited, URL: "https://example.com/server"})
+	assertNoError(t, err)
+
+	gone, err := anchors.AddAnchor(ctx, Anchor{URL: "https://example.com/gone"})
+	assertNoError(t, err)
+	assertNoError(t, anchors.DeleteAnchor(ctx, gone, 0))
+
+	results, err := sync.Apply(ctx, []SyncChange{
+		{Op: "create", ClientID: "c1", URL: "https://example.com/new"},
+		{Op: "update", ID: kept, URL: "https://example.com/kept2", BaseVersion: 1},
+		{Op: "update", ID: edited, URL: "https://example.com/client", BaseVersion: 1},
+		{Op: "update", ID: edited, URL: "https://example.com/server", BaseVersion: 1},
+		{Op: "update", ID: gone, URL: "https://example.com/back", BaseVersion: 1},
+		{Op: "delete", ID: gone, BaseVersion: 1},
+		{Op: "delete", ID: kept},
+		{Op: "move", ID: kept},
+	})
+	assertNoError(t, err)
+	assertEqual(t, 8, len(results))
+
+	created := results[0]
+	assertEqual(t, "c1", created.ClientID)
+	assertEqual(t, SyncApplied, created.Status)
+	assertEqual(t, created.ID, created.Anchor.ID)
+	assertEqual(t, "https://example.com/new", created.Anchor.URL)
+
+	assertEqual(t, SyncApplied, results[1].Status)
+	assertEqual(t, Anchor{ID: kept, URL: "https://example.com/kept2", Version: 2}, *results[1].Anchor)
+
+	// The server's version wins, and is returned for the client to merge.
+	assertEqual(t, SyncConflict, results[2].Status)
+	assertEqual(t, Anchor{ID: edited, URL: "https://example.com/server", Version: 2}, *results[2].Anchor)
+
+	// Making the same change as the server is not a conflict.
+	assertEqual(t, SyncApplied, results[3].Status)
+	assertEqual(t, Anchor{ID: edited, URL: "https://example.com/server", Version: 2}, *results[3].Anchor)
+
+	assertEqual(t, SyncResult{ID: gone, Status: SyncConflict, Deleted: true}, results[4])
+	assertEqual(t, SyncResult{ID: gone, Status: SyncApplied, Deleted: true}, results[5])
+	assertEqual(t, SyncResult{ID: kept, Status: SyncInvalid, Error: "delete requires a base_version"}, results[6])
+	assertEqual(t, SyncResult{ID: kept, Status: SyncInvalid, Error: `unknown op "move"`}, results[7])
+
+	a, err := anchors.GetAnchor(ctx, edited)
+	assertNoError(t, err)
+	assertEqual(t, "https://example.com/server", a.URL)
+}
+
+func TestSyncHandlers(t *testing.T) {
+	sync, anchors, _ := newTestSyncService(t, 1)
+
+	router := NewRouter("/v1")
+	NewSyncHTTPHandler(sync).RegisterRoutes(router)
+
+	for i := 0; i < 3; i++ {
+		_, err := anchors.AddAnchor(context.Background(), Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "Expired token",
+			method:         http.MethodGet,
+			path:           "/v1/sync?token=1",
+			expectedStatus: http.StatusGone,
+			responseBody:   `{"status":410,"message":"sync token expired, sync again without a token"}`,
+		},
+		{
+			name:           "Latest token",
+			method:         http.MethodGet,
+			path:           "/v1/sync?token=3",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"token":3,"full":false,"more":false,"changes":[]}`,
+		},
+		{
+			name:           "Bad token",
+			method:         http.MethodGet,
+			path:           "/v1/sync?token=abc",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid token 'abc'"}`,
+		},
+		{
+			name:           "Upload",
+			method:         http.MethodPost,
+			path:           "/v1/sync",
+			body:           `{"changes":[{"op":"update","id":1,"url":"https://example.com/new","base_version":1}]}`,
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"results":[{"id":1,"status":"applied","anchor":{"id":1,"url":"https://example.com/new","version":2}}]}`,
+		},
+		{
+			name:           "Empty upload",
+			method:         http.MethodPost,
+			path:           "/v1/sync",
+			body:           `{"changes":[]}`,
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"changes must not be empty"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/sync", nil))
+	assertEqual(t, http.StatusOK, rr.Code)
+
+	var full SyncChanges
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &full))
+	assertEqual(t, true, full.Full)
+	assertEqual(t, 4, full.Token)
+	assertEqual(t, 3, len(full.Changes))
+}
@@ -0,0 +1,146 @@
+package junkboy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Repositories is the set of repositories a unit of work runs against.
+// Inside WithTx they are bound to the transaction, and calling WithTx on
+// them again nests the work in a savepoint.
+type Repositories struct {
+	Anchors anchorRepository
+
+	tx transactor
+}
+
+// ErrTxUnsupported is returned by WithTx for repositories that cannot run
+// transactions, such as those of the file store.
+var ErrTxUnsupported = errors.New("repositories do not support transactions")
+
+type transactor interface {
+	WithTx(ctx context.Context, fn func(Repositories) error) error
+}
+
+// WithTx runs fn in a transaction, or in a savepoint if r is already bound
+// to one. The work is rolled back if fn returns an error or panics.
+func (r Repositories) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	if r.tx == nil {
+		return ErrTxUnsupported
+	}
+
+	return r.tx.WithTx(ctx, fn)
+}
+
+const (
+	txMaxRetries   = 5
+	txRetryBackoff = 10 * time.Millisecond
+)
+
+// sqlTransactor runs units of work in database/sql transactions. bind
+// returns repositories whose queries go through tx.
+type sqlTransactor struct {
+	db        *sql.DB
+	bind      func(ctx context.Context, tx *sql.Tx) Repositories
+	retryable func(err error) bool
+}
+
+// WithTx retries the whole unit of work with backoff when it fails with an
+// error the database reports as transient, such as SQLITE_BUSY.
+func (t *sqlTransactor) WithTx(ctx context.Context, fn func(Repositories) error) error {
+	backoff := txRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := t.run(ctx, fn)
+		if err == nil || attempt == txMaxRetries || t.retryable == nil || !t.retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+func (t *sqlTransactor) run(ctx context.Context, fn func(Repositories) error) (err error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			//nolint:errcheck // The panic is more important than a failed rollback.
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	repos := t.bind(ctx, tx)
+	repos.tx = &sqlSavepoint{tx: tx, bind: t.bind, depth: 1}
+
+	if err := fn(repos); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqlSavepoint nests units of work inside an open transaction.
+type sqlSavepoint struct {
+	tx    *sql.Tx
+	bind  func(ctx context.Context, tx *sql.Tx) Repositories
+	depth int
+}
+
+func (s *sqlSavepoint) WithTx(ctx context.Context, fn func(Repositories) error) (err error) {
+	name := fmt.Sprintf("sp_%d", s.depth)
+
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	rollback := func() error {
+		if _, err := s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+
+		_, err := s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			//nolint:errcheck // The panic is more important than a failed rollback.
+			rollback()
+			panic(p)
+		}
+	}()
+
+	repos := s.bind(ctx, s.tx)
+	repos.tx = &sqlSavepoint{tx: s.tx, bind: s.bind, depth: s.depth + 1}
+
+	if err := fn(repos); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+
+		return err
+	}
+
+	_, err = s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+
+	return err
+}
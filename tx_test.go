@@ -0,0 +1,151 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	db := newTestSQLiteDB(t)
+
+	m, err := NewSQLiteMigrator(db.Write)
+	assertNoError(t, err)
+	assertNoError(t, m.Up(context.Background()))
+
+	s, err := NewSQLiteStore(context.Background(), db)
+	assertNoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func countAnchors(t *testing.T, s *SQLiteStore) int {
+	t.Helper()
+
+	count, err := s.Anchors.CountAnchors(context.Background())
+	assertNoError(t, err)
+
+	return count
+}
+
+func TestSQLiteStoreWithTx(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	t.Run("Commit", func(t *testing.T) {
+		s := newTestSQLiteStore(t)
+
+		err := s.WithTx(ctx, func(repos Repositories) error {
+			id, err := repos.Anchors.AddAnchor(ctx, testAnchor)
+			if err != nil {
+				return err
+			}
+
+			anchor, err := repos.Anchors.GetAnchor(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			anchor.URL = "https://example.com/updated"
+
+			_, err = repos.Anchors.UpdateAnchor(ctx, anchor)
+
+			return err
+		})
+		assertNoError(t, err)
+
+		anchors, err := s.Anchors.GetAnchors(ctx)
+		assertNoError(t, err)
+		assertEqual(t, 1, len(anchors))
+		assertEqual(t, "https://example.com/updated", anchors[0].URL)
+	})
+
+	t.Run("Rollback on error", func(t *testing.T) {
+		s := newTestSQLiteStore(t)
+
+		err := s.WithTx(ctx, func(repos Repositories) error {
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			return errBoom
+		})
+		assertEqual(t, errBoom, err)
+		assertEqual(t, 0, countAnchors(t, s))
+	})
+
+	t.Run("Rollback on panic", func(t *testing.T) {
+		s := newTestSQLiteStore(t)
+
+		func() {
+			defer func() {
+				assertEqual(t, "boom", recover())
+			}()
+
+			//nolint:errcheck // The call panics.
+			s.WithTx(ctx, func(repos Repositories) error {
+				if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+					return err
+				}
+
+				panic("boom")
+			})
+		}()
+
+		assertEqual(t, 0, countAnchors(t, s))
+
+		// The write connection must have been released.
+		_, err := s.Anchors.AddAnchor(ctx, testAnchor)
+		assertNoError(t, err)
+	})
+
+	t.Run("Nested savepoint", func(t *testing.T) {
+		s := newTestSQLiteStore(t)
+
+		err := s.WithTx(ctx, func(repos Repositories) error {
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			err := repos.WithTx(ctx, func(repos Repositories) error {
+				if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+					return err
+				}
+
+				return errBoom
+			})
+			assertEqual(t, errBoom, err)
+
+			return repos.WithTx(ctx, func(repos Repositories) error {
+				_, err := repos.Anchors.AddAnchor(ctx, testAnchor)
+				return err
+			})
+		})
+		assertNoError(t, err)
+		assertEqual(t, 2, countAnchors(t, s))
+	})
+
+	t.Run("Retry when busy", func(t *testing.T) {
+		s := newTestSQLiteStore(t)
+		attempts := 0
+
+		err := s.WithTx(ctx, func(repos Repositories) error {
+			attempts++
+			if _, err := repos.Anchors.AddAnchor(ctx, testAnchor); err != nil {
+				return err
+			}
+
+			if attempts < 3 {
+				return errors.New("database is locked")
+			}
+
+			return nil
+		})
+		assertNoError(t, err)
+		assertEqual(t, 3, attempts)
+		assertEqual(t, 1, countAnchors(t, s))
+	})
+}
@@ -0,0 +1,960 @@
+package junkboy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrWebhookNotFound is returned when no subscription has the
+	// requested ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when a subscription has no delivery
+	// with the requested ID.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// WebhookSubscription asks for the events of the given types to be posted
+// to URL, signed with Secret.
+type WebhookSubscription struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	// Secret is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// States of a WebhookDelivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event on its way to a subscription, with the
+// attempts made to post it so far. Deliveries stay pending until the
+// receiver answers with a 2xx status or they run out of attempts.
+type WebhookDelivery struct {
+	ID             int `json:"id"`
+	SubscriptionID int `json:"subscription_id"`
+	// EventID is the ID of the event in the event log.
+	EventID int         `json:"event_id"`
+	Event   AnchorEvent `json:"event"`
+	State   string      `json:"state"`
+	// RedeliveryOf is the delivery this one repeats, if any.
+	RedeliveryOf int              `json:"redelivery_of,omitempty"`
+	NextAttempt  *time.Time       `json:"next_attempt,omitempty"`
+	Attempts     []WebhookAttempt `json:"attempts"`
+}
+
+// WebhookAttempt is one try at posting a delivery. StatusCode is 0 if no
+// response was received, in which case Error says why.
+type WebhookAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Headers of webhook requests.
+const (
+	WebhookEventHeader     = "X-Junkboy-Event"
+	WebhookDeliveryHeader  = "X-Junkboy-Delivery"
+	WebhookSignatureHeader = "X-Junkboy-Signature"
+)
+
+// SignWebhookPayload returns the signature header value of body for a
+// subscription with secret: "sha256=" and the hex HMAC-SHA256 of body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether signature is the signature of
+// body for secret, for receivers to check.
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(SignWebhookPayload(secret, body)))
+}
+
+// Default retry policy of webhook deliveries.
+const (
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookBackoff     = 30 * time.Second
+	DefaultWebhookMaxBackoff  = time.Hour
+	DefaultWebhookTimeout     = 10 * time.Second
+)
+
+// DefaultWebhookConcurrency is how many deliveries are posted to each
+// subscription at once by default.
+const DefaultWebhookConcurrency = 4
+
+// maxWebhookDeliveryLog is how many finished deliveries are kept for each
+// subscription.
+const maxWebhookDeliveryLog = 100
+
+// webhookFanOutBatch is how many events are read from the event log at a
+// time to be queued as deliveries.
+const webhookFanOutBatch = 1000
+
+// webhookState is what Webhooks knows. Cursor is the ID of the last event
+// queued for delivery.
+type webhookState struct {
+	LastSubscriptionID int
+	LastDeliveryID     int
+	Cursor             int
+	Subscriptions      []WebhookSubscription
+	Deliveries         []WebhookDelivery
+}
+
+// webhookRecord is a line of the journal Webhooks appends its changes to.
+// Each sets one thing; replaying them in order rebuilds the state.
+type webhookRecord struct {
+	Cursor             int                  `json:"cursor,omitempty"`
+	LastSubscriptionID int                  `json:"last_subscription_id,omitempty"`
+	LastDeliveryID     int                  `json:"last_delivery_id,omitempty"`
+	Subscription       *WebhookSubscription `json:"subscription,omitempty"`
+	Unsubscribe        int                  `json:"unsubscribe,omitempty"`
+	Delivery           *WebhookDelivery     `json:"delivery,omitempty"`
+}
+
+// Webhooks posts anchor events to the URLs subscribed to them. It relays
+// the event log, which the anchor service writes in the same transaction
+// as each change, so it is the outbox: DeliverDue queues the events logged
+// since it last ran as deliveries, then posts those that are due,
+// retrying failures with exponential backoff. Subscriptions and
+// deliveries are appended to a journal file as they change, so nothing
+// queued is lost to a restart; a delivery interrupted by one is posted
+// again.
+type Webhooks struct {
+	events *EventLog
+	path   string
+	client *http.Client
+	now    func() time.Time
+
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	concurrency int
+
+	mu    sync.Mutex
+	state webhookState
+	file  *os.File
+	lines int
+}
+
+// NewWebhooks returns webhooks for the events of l, loading the journal at
+// path, or keeping them in memory if path is empty. Without a journal
+// they start from the latest event.
+func NewWebhooks(ctx context.Context, l *EventLog, path string) (*Webhooks, error) {
+	w := &Webhooks{
+		events:      l,
+		path:        path,
+		client:      &http.Client{Timeout: DefaultWebhookTimeout},
+		now:         time.Now,
+		maxAttempts: DefaultWebhookMaxAttempts,
+		backoff:     DefaultWebhookBackoff,
+		maxBackoff:  DefaultWebhookMaxBackoff,
+		concurrency: DefaultWebhookConcurrency,
+	}
+
+	loaded, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if !loaded {
+		w.state.Cursor, err = l.LastID(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		return w, nil
+	}
+
+	// Starting from a compacted journal also drops a line cut short by a
+	// crash, which later lines would otherwise be appended to.
+	if err := w.compact(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// load replays the journal, if there is one, and reports whether there
+// was.
+func (w *Webhooks) load() (bool, error) {
+	if w.path == "" {
+		return false, nil
+	}
+
+	b, err := os.ReadFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	lines := bytes.Split(b, []byte("\n"))
+
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec webhookRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// Only the last line can have been cut short by a crash.
+			if i == len(lines)-1 {
+				break
+			}
+
+			return false, fmt.Errorf("%s:%d: %w", w.path, i+1, err)
+		}
+
+		w.apply(rec)
+	}
+
+	return true, nil
+}
+
+// Close closes the journal.
+func (w *Webhooks) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	return w.file.Close()
+}
+
+// SetClient sets the client deliveries are posted with.
+func (w *Webhooks) SetClient(client *http.Client) {
+	w.client = client
+}
+
+// SetRetryPolicy sets how many times a delivery is attempted and the
+// backoff before the second attempt, which doubles with each failure up
+// to maxBackoff.
+func (w *Webhooks) SetRetryPolicy(maxAttempts int, backoff, maxBackoff time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.maxAttempts = maxAttempts
+	w.backoff = backoff
+	w.maxBackoff = maxBackoff
+}
+
+// SetConcurrency sets how many deliveries are posted to each subscription
+// at once. n < 1 means DefaultWebhookConcurrency.
+func (w *Webhooks) SetConcurrency(n int) {
+	if n < 1 {
+		n = DefaultWebhookConcurrency
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.concurrency = n
+}
+
+// apply makes the change recorded by rec. It must be called with mu held,
+// or before w is shared.
+func (w *Webhooks) apply(rec webhookRecord) {
+	if rec.Cursor > w.state.Cursor {
+		w.state.Cursor = rec.Cursor
+	}
+
+	if rec.LastSubscriptionID > w.state.LastSubscriptionID {
+		w.state.LastSubscriptionID = rec.LastSubscriptionID
+	}
+
+	if rec.LastDeliveryID > w.state.LastDeliveryID {
+		w.state.LastDeliveryID = rec.LastDeliveryID
+	}
+
+	if sub := rec.Subscription; sub != nil {
+		if sub.ID > w.state.LastSubscriptionID {
+			w.state.LastSubscriptionID = sub.ID
+		}
+
+		w.state.Subscriptions = append(w.state.Subscriptions, *sub)
+	}
+
+	if id := rec.Unsubscribe; id != 0 {
+		subs := []WebhookSubscription{}
+		for _, sub := range w.state.Subscriptions {
+			if sub.ID != id {
+				subs = append(subs, sub)
+			}
+		}
+
+		deliveries := []WebhookDelivery{}
+		for _, d := range w.state.Deliveries {
+			if d.SubscriptionID != id {
+				deliveries = append(deliveries, d)
+			}
+		}
+
+		w.state.Subscriptions = subs
+		w.state.Deliveries = deliveries
+	}
+
+	if d := rec.Delivery; d != nil {
+		if d.ID > w.state.LastDeliveryID {
+			w.state.LastDeliveryID = d.ID
+		}
+
+		replaced := false
+		for i := range w.state.Deliveries {
+			if w.state.Deliveries[i].ID == d.ID {
+				w.state.Deliveries[i] = *d
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			w.state.Deliveries = append(w.state.Deliveries, *d)
+		}
+
+		if d.State != DeliveryPending {
+			w.pruneDeliveries(d.SubscriptionID)
+		}
+	}
+}
+
+// write appends recs to the journal, if there is one, and applies them.
+// The journal is compacted once most of its lines are out of date; it
+// holds the subscriptions' secrets, so only its owner may read it. It must
+// be called with mu held.
+func (w *Webhooks) write(recs ...webhookRecord) error {
+	if w.file != nil {
+		var buf bytes.Buffer
+
+		for _, rec := range recs {
+			line, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+
+		if _, err := w.file.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
+
+		w.lines += len(recs)
+	}
+
+	for _, rec := range recs {
+		w.apply(rec)
+	}
+
+	if w.file != nil && w.lines >= 2*(1+len(w.state.Subscriptions)+len(w.state.Deliveries)) {
+		if err := w.compact(); err != nil {
+			log.Printf("failed to compact %s: %v", w.path, err)
+		}
+	}
+
+	return nil
+}
+
+// compact replaces the journal with one holding just the current state.
+// It must be called with mu held, or before w is shared.
+func (w *Webhooks) compact() error {
+	var buf bytes.Buffer
+
+	recs := []webhookRecord{{
+		Cursor:             w.state.Cursor,
+		LastSubscriptionID: w.state.LastSubscriptionID,
+		LastDeliveryID:     w.state.LastDeliveryID,
+	}}
+
+	for i := range w.state.Subscriptions {
+		recs = append(recs, webhookRecord{Subscription: &w.state.Subscriptions[i]})
+	}
+
+	for i := range w.state.Deliveries {
+		recs = append(recs, webhookRecord{Delivery: &w.state.Deliveries[i]})
+	}
+
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), "."+filepath.Base(w.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// The new file is written through rather than reopened, so that a
+	// failure leaves the old one in use.
+	err = func() error {
+		if err := tmp.Chmod(0o600); err != nil {
+			return err
+		}
+
+		if _, err := tmp.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+
+		return os.Rename(tmp.Name(), w.path)
+	}()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.file = tmp
+	w.lines = len(recs)
+
+	return nil
+}
+
+// WebhookValidationError is returned for a subscription that is
+// malformed.
+type WebhookValidationError struct {
+	msg string
+}
+
+func (e *WebhookValidationError) Error() string {
+	return e.msg
+}
+
+// validateSubscription checks that sub has an absolute HTTP(S) URL and
+// only known event types, removing duplicate types.
+func validateSubscription(sub *WebhookSubscription) error {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &WebhookValidationError{fmt.Sprintf("invalid webhook url '%s'", sub.URL)}
+	}
+
+	if len(sub.Events) == 0 {
+		return &WebhookValidationError{"events must not be empty"}
+	}
+
+	seen := map[string]bool{}
+	events := []string{}
+
+	for _, event := range sub.Events {
+		known := false
+		for _, t := range AnchorEventTypes {
+			known = known || event == t
+		}
+
+		if !known {
+			return &WebhookValidationError{fmt.Sprintf("unknown event type '%s'", event)}
+		}
+
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	sub.Events = events
+
+	return nil
+}
+
+// Subscribe adds a subscription and returns it with its secret, which is
+// generated if sub has none.
+func (w *Webhooks) Subscribe(ctx context.Context, sub WebhookSubscription) (WebhookSubscription, error) {
+	if err := validateSubscription(&sub); err != nil {
+		return sub, err
+	}
+
+	if sub.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return sub, err
+		}
+
+		sub.Secret = hex.EncodeToString(secret)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Events logged before the subscription are queued for the ones that
+	// existed then.
+	if err := w.fanOut(ctx); err != nil {
+		return sub, err
+	}
+
+	sub.ID = w.state.LastSubscriptionID + 1
+	sub.CreatedAt = w.now().UTC()
+
+	if err := w.write(webhookRecord{Subscription: &sub}); err != nil {
+		return sub, err
+	}
+
+	return sub, nil
+}
+
+// ListSubscriptions returns the subscriptions, without their secrets.
+func (w *Webhooks) ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	subs := make([]WebhookSubscription, len(w.state.Subscriptions))
+	for i, sub := range w.state.Subscriptions {
+		sub.Secret = ""
+		subs[i] = sub
+	}
+
+	return subs, nil
+}
+
+// GetSubscription returns the subscription id, without its secret.
+func (w *Webhooks) GetSubscription(ctx context.Context, id int) (WebhookSubscription, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sub, ok := w.subscription(id)
+	if !ok {
+		return WebhookSubscription{}, ErrWebhookNotFound
+	}
+
+	sub.Secret = ""
+
+	return sub, nil
+}
+
+func (w *Webhooks) subscription(id int) (WebhookSubscription, bool) {
+	for _, sub := range w.state.Subscriptions {
+		if sub.ID == id {
+			return sub, true
+		}
+	}
+
+	return WebhookSubscription{}, false
+}
+
+// DeleteSubscription removes the subscription id with its deliveries,
+// including pending ones.
+func (w *Webhooks) DeleteSubscription(ctx context.Context, id int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscription(id); !ok {
+		return ErrWebhookNotFound
+	}
+
+	return w.write(webhookRecord{Unsubscribe: id})
+}
+
+// ListDeliveries returns the deliveries of the subscription id, newest
+// first. Events logged since DeliverDue last ran are queued first, so that
+// every change made so far is listed.
+func (w *Webhooks) ListDeliveries(ctx context.Context, id int) ([]WebhookDelivery, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscription(id); !ok {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err := w.fanOut(ctx); err != nil {
+		return nil, err
+	}
+
+	deliveries := []WebhookDelivery{}
+	for i := len(w.state.Deliveries) - 1; i >= 0; i-- {
+		if d := w.state.Deliveries[i]; d.SubscriptionID == id {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues the event of a delivery to be posted again, as a new
+// delivery, whatever became of the original.
+func (w *Webhooks) Redeliver(ctx context.Context, id, deliveryID int) (WebhookDelivery, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.subscription(id); !ok {
+		return WebhookDelivery{}, ErrWebhookNotFound
+	}
+
+	for _, d := range w.state.Deliveries {
+		if d.ID == deliveryID && d.SubscriptionID == id {
+			redelivery := w.newDelivery(id, d.EventID, d.Event)
+			redelivery.RedeliveryOf = d.ID
+
+			if err := w.write(webhookRecord{Delivery: &redelivery}); err != nil {
+				return WebhookDelivery{}, err
+			}
+
+			return redelivery, nil
+		}
+	}
+
+	return WebhookDelivery{}, ErrDeliveryNotFound
+}
+
+// newDelivery returns a pending delivery of the event eventID to the
+// subscription id, due now, with the next delivery ID. It must be called
+// with mu held.
+func (w *Webhooks) newDelivery(id, eventID int, e AnchorEvent) WebhookDelivery {
+	now := w.now().UTC()
+
+	return WebhookDelivery{
+		ID:             w.state.LastDeliveryID + 1,
+		SubscriptionID: id,
+		EventID:        eventID,
+		Event:          e,
+		State:          DeliveryPending,
+		NextAttempt:    &now,
+		Attempts:       []WebhookAttempt{},
+	}
+}
+
+// fanOut queues the events logged since the cursor for every subscription
+// to their type. Events that expired from the log before they could be
+// queued are skipped, and logged. It must be called with mu held.
+func (w *Webhooks) fanOut(ctx context.Context) error {
+	// A crash can leave deliveries written without the cursor that
+	// follows them, so those are not queued twice.
+	queued := map[[2]int]bool{}
+	for _, d := range w.state.Deliveries {
+		if d.EventID > w.state.Cursor && d.RedeliveryOf == 0 {
+			queued[[2]int{d.SubscriptionID, d.EventID}] = true
+		}
+	}
+
+	for {
+		events, err := w.events.Since(ctx, w.state.Cursor, webhookFanOutBatch)
+		if errors.Is(err, ErrEventsExpired) {
+			last, lastErr := w.events.LastID(ctx)
+			if lastErr != nil {
+				return lastErr
+			}
+
+			log.Printf("webhook deliveries of the events after %d up to %d were lost: %v", w.state.Cursor, last, err)
+
+			if err := w.write(webhookRecord{Cursor: last}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		var recs []webhookRecord
+
+		next := w.state.LastDeliveryID
+
+		for _, e := range events {
+			for _, sub := range w.state.Subscriptions {
+				if !sub.subscribed(e.Type) || queued[[2]int{sub.ID, e.ID}] {
+					continue
+				}
+
+				d := w.newDelivery(sub.ID, e.ID, e.AnchorEvent)
+				next++
+				d.ID = next
+				recs = append(recs, webhookRecord{Delivery: &d})
+			}
+		}
+
+		recs = append(recs, webhookRecord{Cursor: events[len(events)-1].ID})
+
+		if err := w.write(recs...); err != nil {
+			return err
+		}
+	}
+}
+
+// subscribed reports whether sub asks for events of type eventType.
+func (sub WebhookSubscription) subscribed(eventType string) bool {
+	for _, event := range sub.Events {
+		if event == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeliverDue queues the events logged since it last ran, then posts every
+// pending delivery that is due and returns how many were delivered. Up to
+// the concurrency limit of deliveries are posted to each subscription at
+// once, so they may arrive out of order.
+func (w *Webhooks) DeliverDue(ctx context.Context) (int, error) {
+	w.mu.Lock()
+
+	if err := w.fanOut(ctx); err != nil {
+		w.mu.Unlock()
+		return 0, err
+	}
+
+	now := w.now()
+	concurrency := w.concurrency
+
+	var subs []WebhookSubscription
+
+	due := map[int][]WebhookDelivery{}
+
+	for _, d := range w.state.Deliveries {
+		if d.State != DeliveryPending || d.NextAttempt == nil || d.NextAttempt.After(now) {
+			continue
+		}
+
+		sub, ok := w.subscription(d.SubscriptionID)
+		if !ok {
+			continue
+		}
+
+		if len(due[sub.ID]) == 0 {
+			subs = append(subs, sub)
+		}
+
+		due[sub.ID] = append(due[sub.ID], d)
+	}
+	w.mu.Unlock()
+
+	var (
+		wg        sync.WaitGroup
+		delivered int64
+		errOnce   sync.Once
+		firstErr  error
+	)
+
+	for _, sub := range subs {
+		queue := make(chan WebhookDelivery, len(due[sub.ID]))
+		for _, d := range due[sub.ID] {
+			queue <- d
+		}
+		close(queue)
+
+		for i := 0; i < concurrency && i < len(due[sub.ID]); i++ {
+			wg.Add(1)
+
+			go func(sub WebhookSubscription) {
+				defer wg.Done()
+
+				for d := range queue {
+					if ctx.Err() != nil {
+						return
+					}
+
+					attempt := w.post(ctx, sub, d)
+					if attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+						atomic.AddInt64(&delivered, 1)
+					}
+
+					if err := w.record(d.ID, attempt); err != nil {
+						errOnce.Do(func() { firstErr = err })
+						return
+					}
+				}
+			}(sub)
+		}
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return int(delivered), firstErr
+	}
+
+	return int(delivered), ctx.Err()
+}
+
+// post makes one attempt at posting d to sub.
+func (w *Webhooks) post(ctx context.Context, sub WebhookSubscription, d WebhookDelivery) WebhookAttempt {
+	attempt := WebhookAttempt{Time: w.now().UTC()}
+	start := time.Now()
+
+	defer func() {
+		attempt.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "junkboy-webhooks")
+	req.Header.Set(WebhookEventHeader, d.Event.Type)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(sub.Secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	// Drain some of the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = resp.Status
+	}
+
+	return attempt
+}
+
+// record adds attempt to the delivery id and works out what happens next:
+// nothing if it succeeded or was the last one allowed, another attempt
+// after the backoff otherwise.
+func (w *Webhooks) record(id int, attempt WebhookAttempt) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	i := -1
+	for j, d := range w.state.Deliveries {
+		if d.ID == id {
+			i = j
+		}
+	}
+
+	// The subscription was deleted while the delivery was posted.
+	if i < 0 {
+		return nil
+	}
+
+	d := w.state.Deliveries[i]
+	d.Attempts = append(d.Attempts[:len(d.Attempts):len(d.Attempts)], attempt)
+	d.NextAttempt = nil
+
+	switch {
+	case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		d.State = DeliveryDelivered
+	case len(d.Attempts) >= w.maxAttempts:
+		d.State = DeliveryFailed
+	default:
+		next := w.now().UTC().Add(w.backoffAfter(len(d.Attempts)))
+		d.NextAttempt = &next
+	}
+
+	return w.write(webhookRecord{Delivery: &d})
+}
+
+// backoffAfter is how long to wait after the given number of failed
+// attempts.
+func (w *Webhooks) backoffAfter(failures int) time.Duration {
+	d := w.backoff
+	for i := 1; i < failures && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+
+	return d
+}
+
+// pruneDeliveries drops the oldest finished deliveries of the subscription
+// id beyond maxWebhookDeliveryLog. It must be called with mu held.
+func (w *Webhooks) pruneDeliveries(id int) {
+	var finished []int
+	for _, d := range w.state.Deliveries {
+		if d.SubscriptionID == id && d.State != DeliveryPending {
+			finished = append(finished, d.ID)
+		}
+	}
+
+	if len(finished) <= maxWebhookDeliveryLog {
+		return
+	}
+
+	sort.Ints(finished)
+	drop := map[int]bool{}
+
+	for _, deliveryID := range finished[:len(finished)-maxWebhookDeliveryLog] {
+		drop[deliveryID] = true
+	}
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range w.state.Deliveries {
+		if !drop[d.ID] {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	w.state.Deliveries = deliveries
+}
+
+// NewWebhookDeliveryJob returns a job that posts the webhook deliveries
+// that are due.
+func NewWebhookDeliveryJob(w *Webhooks, interval time.Duration) Job {
+	return Job{
+		Name:     "deliver_webhooks",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			_, err := w.DeliverDue(ctx)
+			return err
+		},
+	}
+}
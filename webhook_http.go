@@ -0,0 +1,187 @@
+package junkboy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type webhookService interface {
+	Subscribe(ctx context.Context, sub WebhookSubscription) (WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id int) (WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int) error
+	ListDeliveries(ctx context.Context, id int) ([]WebhookDelivery, error)
+	Redeliver(ctx context.Context, id, deliveryID int) (WebhookDelivery, error)
+}
+
+// WebhookHTTPHandler manages webhook subscriptions. Subscriptions make the
+// server post to any URL, so only administrators may manage them; see
+// adminAuthorized.
+type WebhookHTTPHandler struct {
+	service webhookService
+	token   string
+}
+
+func NewWebhookHTTPHandler(s webhookService, token string) *WebhookHTTPHandler {
+	return &WebhookHTTPHandler{service: s, token: token}
+}
+
+func (h *WebhookHTTPHandler) RegisterRoutes(r *Router) {
+	r.AddRoute([]string{"POST"}, "/webhooks", h.addWebhookHandler)
+	r.AddRoute([]string{"GET"}, "/webhooks", h.getWebhooksHandler)
+	r.AddRoute([]string{"GET"}, "/webhooks/([^/]+)", h.getWebhookHandler)
+	r.AddRoute([]string{"DELETE"}, "/webhooks/([^/]+)", h.deleteWebhookHandler)
+	r.AddRoute([]string{"GET"}, "/webhooks/([^/]+)/deliveries", h.getDeliveriesHandler)
+	r.AddRoute([]string{"POST"}, "/webhooks/([^/]+)/deliveries/([^/]+)/redeliver", h.redeliverHandler)
+}
+
+// webhookID parses the subscription ID in the path, writing 400 if it is
+// not a number.
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	idField := getField(r, 0)
+
+	id, err := strconv.Atoi(idField)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid webhook id '%s'", idField))
+		return 0, false
+	}
+
+	return id, true
+}
+
+// addWebhookHandler creates a subscription. The response is the only one
+// that includes its secret.
+func (h *WebhookHTTPHandler) addWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	if !contentTypeIsValid(w, r, "application/json") {
+		return
+	}
+
+	var sub WebhookSubscription
+	if err := readJSON(w, r, &sub); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub, err := h.service.Subscribe(r.Context(), sub)
+
+	var invalid *WebhookValidationError
+	if errors.As(err, &invalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (h *WebhookHTTPHandler) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	subs, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (h *WebhookHTTPHandler) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetSubscription(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *WebhookHTTPHandler) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSubscription(r.Context(), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getDeliveriesHandler returns the delivery log of a subscription, newest
+// first, with the response to each attempt.
+func (h *WebhookHTTPHandler) getDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// redeliverHandler queues a delivery to be posted again and returns the
+// new delivery, which the next run of the delivery job picks up.
+func (h *WebhookHTTPHandler) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r, h.token) {
+		return
+	}
+
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryField := getField(r, 1)
+
+	deliveryID, err := strconv.Atoi(deliveryField)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid delivery id '%s'", deliveryField))
+		return
+	}
+
+	delivery, err := h.service.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
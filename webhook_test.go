@@ -0,0 +1,489 @@
+package junkboy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAnchorServiceEvents(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+
+	var events []AnchorEvent
+	s.AddListener(func(ctx context.Context, e AnchorEvent) {
+		events = append(events, e)
+	})
+
+	id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+	assertNoError(t, err)
+
+	_, err = s.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	_, err = s.RevertAnchor(ctx, id, 1, 0)
+	assertNoError(t, err)
+
+	// Failed changes are not events.
+	_, err = s.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/c", Version: 1})
+	assertEqual(t, true, errors.Is(err, ErrAnchorVersionMismatch))
+
+	assertNoError(t, s.DeleteAnchor(ctx, id, 0))
+
+	_, err = s.RestoreAnchor(ctx, id)
+	assertNoError(t, err)
+
+	// Neither is anything in a bulk transaction that was rolled back.
+	_, err = s.Bulk(ctx, []BulkOperation{
+		{Op: "create", URL: "https://example.com/d"},
+		{Op: "delete", ID: 99},
+	}, true)
+	assertNoError(t, err)
+
+	_, err = s.Bulk(ctx, []BulkOperation{
+		{Op: "create", URL: "https://example.com/e"},
+		{Op: "delete", ID: 99},
+	}, false)
+	assertNoError(t, err)
+
+	want := []struct {
+		eventType string
+		anchor    Anchor
+	}{
+		{AnchorCreated, Anchor{ID: id, URL: "https://example.com/a", Version: 1}},
+		{AnchorUpdated, Anchor{ID: id, URL: "https://example.com/b", Version: 2}},
+		{AnchorUpdated, Anchor{ID: id, URL: "https://example.com/a", Version: 3}},
+		{AnchorDeleted, Anchor{ID: id}},
+		{AnchorRestored, Anchor{ID: id, URL: "https://example.com/a", Version: 4}},
+		{AnchorCreated, Anchor{ID: id + 1, URL: "https://example.com/e", Version: 1}},
+	}
+
+	assertEqual(t, len(want), len(events))
+
+	for i, w := range want {
+		assertEqual(t, w.eventType, events[i].Type)
+		assertEqual(t, w.anchor, events[i].Anchor)
+		assertEqual(t, "alice", events[i].Actor)
+	}
+}
+
+// webhookReceiver is an httptest server that records the deliveries it is
+// sent and answers with the statuses it is given, then 204.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	statuses []int
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	rcv := &webhookReceiver{statuses: statuses}
+
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, body)
+
+		status := http.StatusNoContent
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+
+	return rcv
+}
+
+// newTestWebhooks returns webhooks for the events of a new service, which
+// it returns too.
+func newTestWebhooks(t *testing.T, path string) (*Webhooks, *AnchorService) {
+	t.Helper()
+
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+
+	webhooks, err := NewWebhooks(context.Background(), NewEventLog(s), path)
+	assertNoError(t, err)
+	t.Cleanup(func() { webhooks.Close() })
+
+	return webhooks, s
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	webhooks, s := newTestWebhooks(t, "")
+	webhooks.SetConcurrency(1)
+
+	all := newWebhookReceiver(t)
+	deletes := newWebhookReceiver(t)
+
+	// Changes made before a subscription are not sent to it.
+	_, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com/before"})
+	assertNoError(t, err)
+
+	sub, err := webhooks.Subscribe(ctx, WebhookSubscription{URL: all.URL, Secret: "s3cret", Events: AnchorEventTypes})
+	assertNoError(t, err)
+
+	deleteSub, err := webhooks.Subscribe(ctx, WebhookSubscription{URL: deletes.URL, Events: []string{AnchorDeleted, AnchorDeleted}})
+	assertNoError(t, err)
+	assertEqual(t, 64, len(deleteSub.Secret))
+	assertEqual(t, 1, len(deleteSub.Events))
+
+	id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+	assertNoError(t, s.DeleteAnchor(ctx, id, 0))
+
+	delivered, err := webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 3, delivered)
+
+	assertEqual(t, 2, len(all.requests))
+	assertEqual(t, 1, len(deletes.requests))
+
+	req, body := all.requests[0], all.bodies[0]
+	assertEqual(t, "application/json", req.Header.Get("Content-Type"))
+	assertEqual(t, AnchorCreated, req.Header.Get(WebhookEventHeader))
+	assertEqual(t, "1", req.Header.Get(WebhookDeliveryHeader))
+	assertEqual(t, true, VerifyWebhookSignature("s3cret", body, req.Header.Get(WebhookSignatureHeader)))
+	assertEqual(t, false, VerifyWebhookSignature("wrong", body, req.Header.Get(WebhookSignatureHeader)))
+
+	var event AnchorEvent
+	assertNoError(t, json.Unmarshal(body, &event))
+	assertEqual(t, AnchorCreated, event.Type)
+	assertEqual(t, Anchor{ID: id, URL: "https://example.com", Version: 1}, event.Anchor)
+
+	assertEqual(t, true, VerifyWebhookSignature(deleteSub.Secret, deletes.bodies[0], deletes.requests[0].Header.Get(WebhookSignatureHeader)))
+
+	deliveries, err := webhooks.ListDeliveries(ctx, sub.ID)
+	assertNoError(t, err)
+	assertEqual(t, 2, len(deliveries))
+	assertEqual(t, AnchorDeleted, deliveries[0].Event.Type)
+	assertEqual(t, 3, deliveries[0].EventID)
+	assertEqual(t, DeliveryDelivered, deliveries[0].State)
+	assertEqual(t, 1, len(deliveries[0].Attempts))
+	assertEqual(t, http.StatusNoContent, deliveries[0].Attempts[0].StatusCode)
+
+	// Nothing is left to deliver.
+	delivered, err = webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, delivered)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	ctx := context.Background()
+	rcv := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	webhooks, s := newTestWebhooks(t, "")
+	webhooks.SetRetryPolicy(3, time.Minute, 90*time.Second)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	webhooks.now = func() time.Time { return now }
+
+	sub, err := webhooks.Subscribe(ctx, WebhookSubscription{URL: rcv.URL, Events: []string{AnchorCreated}})
+	assertNoError(t, err)
+
+	id, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com/a"})
+	assertNoError(t, err)
+	_, err = s.UpdateAnchor(ctx, Anchor{ID: id, URL: "https://example.com/b"})
+	assertNoError(t, err)
+
+	delivery := func() WebhookDelivery {
+		deliveries, err := webhooks.ListDeliveries(ctx, sub.ID)
+		assertNoError(t, err)
+		assertEqual(t, 1, len(deliveries))
+
+		return deliveries[0]
+	}
+
+	for i, wait := range []time.Duration{time.Minute, 90 * time.Second} {
+		_, err := webhooks.DeliverDue(ctx)
+		assertNoError(t, err)
+		assertEqual(t, i+1, len(rcv.requests))
+
+		d := delivery()
+		assertEqual(t, DeliveryPending, d.State)
+		assertEqual(t, true, d.NextAttempt.Equal(now.Add(wait)))
+
+		// Not due yet.
+		now = now.Add(wait - time.Second)
+		_, err = webhooks.DeliverDue(ctx)
+		assertNoError(t, err)
+		assertEqual(t, i+1, len(rcv.requests))
+
+		now = now.Add(time.Second)
+	}
+
+	_, err = webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+
+	d := delivery()
+	assertEqual(t, DeliveryFailed, d.State)
+	assertEqual(t, true, d.NextAttempt == nil)
+	assertEqual(t, 3, len(d.Attempts))
+	assertEqual(t, http.StatusBadGateway, d.Attempts[1].StatusCode)
+	assertEqual(t, "502 Bad Gateway", d.Attempts[1].Error)
+
+	redelivery, err := webhooks.Redeliver(ctx, sub.ID, d.ID)
+	assertNoError(t, err)
+	assertEqual(t, d.ID, redelivery.RedeliveryOf)
+	assertEqual(t, DeliveryPending, redelivery.State)
+
+	delivered, err := webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, delivered)
+	assertBytesEqual(t, rcv.bodies[0], rcv.bodies[3])
+
+	_, err = webhooks.Redeliver(ctx, sub.ID, 99)
+	assertEqual(t, true, errors.Is(err, ErrDeliveryNotFound))
+}
+
+func TestWebhookConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu                sync.Mutex
+		inFlight, highest int
+	)
+
+	rcv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > highest {
+			highest = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	t.Cleanup(rcv.Close)
+
+	webhooks, s := newTestWebhooks(t, "")
+	webhooks.SetConcurrency(2)
+
+	_, err := webhooks.Subscribe(ctx, WebhookSubscription{URL: rcv.URL, Events: []string{AnchorCreated}})
+	assertNoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+		assertNoError(t, err)
+	}
+
+	delivered, err := webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 6, delivered)
+	assertEqual(t, 2, highest)
+}
+
+func TestWebhooksPersist(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhooks.jsonl")
+	rcv := newWebhookReceiver(t)
+
+	s := NewAnchorServiceWithRepositories(NewMemoryStore().Repositories())
+	events := NewEventLog(s)
+
+	webhooks, err := NewWebhooks(ctx, events, path)
+	assertNoError(t, err)
+
+	sub, err := webhooks.Subscribe(ctx, WebhookSubscription{URL: rcv.URL, Events: []string{AnchorCreated}})
+	assertNoError(t, err)
+
+	// The file holds the secret, so only its owner may read it.
+	info, err := os.Stat(path)
+	assertNoError(t, err)
+	assertEqual(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// A change made while jbd is down is delivered once it is back, signed
+	// with the same secret.
+	assertNoError(t, webhooks.Close())
+
+	_, err = s.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	webhooks, err = NewWebhooks(ctx, events, path)
+	assertNoError(t, err)
+
+	delivered, err := webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, delivered)
+	assertEqual(t, true, VerifyWebhookSignature(sub.Secret, rcv.bodies[0], rcv.requests[0].Header.Get(WebhookSignatureHeader)))
+	assertNoError(t, webhooks.Close())
+
+	// A line cut short by a crash is dropped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assertNoError(t, err)
+	_, err = f.WriteString(`{"delivery":{"id":`)
+	assertNoError(t, err)
+	assertNoError(t, f.Close())
+
+	webhooks, err = NewWebhooks(ctx, events, path)
+	assertNoError(t, err)
+
+	deliveries, err := webhooks.ListDeliveries(ctx, sub.ID)
+	assertNoError(t, err)
+	assertEqual(t, 1, len(deliveries))
+	assertEqual(t, DeliveryDelivered, deliveries[0].State)
+
+	// Nothing is delivered twice.
+	delivered, err = webhooks.DeliverDue(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 0, delivered)
+
+	assertNoError(t, webhooks.DeleteSubscription(ctx, sub.ID))
+	assertNoError(t, webhooks.Close())
+
+	webhooks, err = NewWebhooks(ctx, events, path)
+	assertNoError(t, err)
+	defer webhooks.Close()
+
+	_, err = webhooks.ListDeliveries(ctx, sub.ID)
+	assertEqual(t, true, errors.Is(err, ErrWebhookNotFound))
+
+	// IDs are not reused.
+	sub, err = webhooks.Subscribe(ctx, WebhookSubscription{URL: rcv.URL, Events: []string{AnchorCreated}})
+	assertNoError(t, err)
+	assertEqual(t, 2, sub.ID)
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	ctx := context.Background()
+
+	webhooks, s := newTestWebhooks(t, "")
+
+	router := NewRouter("/v1")
+	NewWebhookHTTPHandler(webhooks, "admin").RegisterRoutes(router)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/v1/webhooks", "", `{"url":"https://example.com/hook","events":["anchor.created"]}`)
+	assertEqual(t, http.StatusUnauthorized, rr.Code)
+
+	rr = do(http.MethodPost, "/v1/webhooks", "admin", `{"url":"https://example.com/hook","secret":"s3cret","events":["anchor.created"]}`)
+	assertEqual(t, http.StatusCreated, rr.Code)
+
+	var sub WebhookSubscription
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &sub))
+	assertEqual(t, 1, sub.ID)
+	assertEqual(t, "s3cret", sub.Secret)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		responseBody   string
+	}{
+		{
+			name:           "Invalid url",
+			method:         http.MethodPost,
+			path:           "/v1/webhooks",
+			body:           `{"url":"/hook","events":["anchor.created"]}`,
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid webhook url '/hook'"}`,
+		},
+		{
+			name:           "Unknown event",
+			method:         http.MethodPost,
+			path:           "/v1/webhooks",
+			body:           `{"url":"https://example.com/hook","events":["anchor.read"]}`,
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"unknown event type 'anchor.read'"}`,
+		},
+		{
+			name:           "Get without secret",
+			method:         http.MethodGet,
+			path:           "/v1/webhooks/1",
+			expectedStatus: http.StatusOK,
+			responseBody:   `{"id":1,"url":"https://example.com/hook","events":["anchor.created"],"created_at":"` + sub.CreatedAt.Format(time.RFC3339Nano) + `"}`,
+		},
+		{
+			name:           "Get missing",
+			method:         http.MethodGet,
+			path:           "/v1/webhooks/9",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"webhook not found"}`,
+		},
+		{
+			name:           "Bad id",
+			method:         http.MethodGet,
+			path:           "/v1/webhooks/one/deliveries",
+			expectedStatus: http.StatusBadRequest,
+			responseBody:   `{"status":400,"message":"invalid webhook id 'one'"}`,
+		},
+		{
+			name:           "Redeliver missing",
+			method:         http.MethodPost,
+			path:           "/v1/webhooks/1/deliveries/9/redeliver",
+			expectedStatus: http.StatusNotFound,
+			responseBody:   `{"status":404,"message":"delivery not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.path, "admin", tt.body)
+			assertEqual(t, tt.expectedStatus, rr.Code)
+			assertEqual(t, tt.responseBody, rr.Body.String())
+		})
+	}
+
+	_, err := s.AddAnchor(ctx, Anchor{URL: "https://example.com"})
+	assertNoError(t, err)
+
+	rr = do(http.MethodGet, "/v1/webhooks/1/deliveries", "admin", "")
+	assertEqual(t, http.StatusOK, rr.Code)
+
+	var deliveries []WebhookDelivery
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &deliveries))
+	assertEqual(t, 1, len(deliveries))
+
+	rr = do(http.MethodPost, "/v1/webhooks/1/deliveries/1/redeliver", "admin", "")
+	assertEqual(t, http.StatusAccepted, rr.Code)
+
+	var redelivery WebhookDelivery
+	assertNoError(t, json.Unmarshal(rr.Body.Bytes(), &redelivery))
+	assertEqual(t, 2, redelivery.ID)
+	assertEqual(t, 1, redelivery.RedeliveryOf)
+
+	rr = do(http.MethodDelete, "/v1/webhooks/1", "admin", "")
+	assertEqual(t, http.StatusNoContent, rr.Code)
+
+	rr = do(http.MethodGet, "/v1/webhooks", "admin", "")
+	assertEqual(t, `[]`, rr.Body.String())
+}